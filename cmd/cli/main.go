@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"letshare-server/internal/config"
+	"letshare-server/internal/service"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `LetShare 命令行工具
+
+用法:
+  cli gen-auth [-user <用户ID>]                 生成签名AuthToken（有效期为auth.token_ttl_seconds）；
+                                                不带-user时生成固定AuthToken（SERVER_AUTH_SECRET的SHA256）
+  cli gen-jwt -user <用户ID> [-type 类型] [-room 房间]  生成JWT（使用配置中的jwt.secret和有效期）
+  cli verify <token>                            校验token（自动识别JWT、签名AuthToken或固定AuthToken）
+
+与服务器使用相同的配置加载方式：MODE选择configs下的配置文件，LETSHARE_*环境变量覆盖配置，
+当前目录下的.env会先被加载。`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	// .env不存在时使用系统环境变量
+	_ = godotenv.Load()
+	cfg := config.Load()
+	authService := service.NewAuthService(cfg.Auth)
+	jwtService := service.NewJWTService(cfg.JWT.Secret, cfg.JWT.ExpirationHours, cfg.JWT.LeewaySeconds)
+
+	var err error
+	switch os.Args[1] {
+	case "gen-auth":
+		err = genAuth(authService, os.Args[2:])
+	case "gen-jwt":
+		err = genJWT(jwtService, os.Args[2:])
+	case "verify":
+		err = verify(authService, jwtService, os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Println(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "未知的子命令: %s\n\n%s\n", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// genAuth 为指定用户签发签名AuthToken，未指定用户时输出固定AuthToken；使用默认密钥时给出提示
+func genAuth(authService *service.AuthService, args []string) error {
+	flags := flag.NewFlagSet("gen-auth", flag.ContinueOnError)
+	userID := flags.String("user", "", "用户ID，指定时生成签名AuthToken")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if authService.UsesDefaultSecret() {
+		fmt.Fprintln(os.Stderr, "注意: 未设置 SERVER_AUTH_SECRET，使用公开的默认密钥，仅适用于本地开发")
+	}
+	if *userID != "" {
+		token, err := authService.GenerateSignedToken(*userID)
+		if err != nil {
+			return fmt.Errorf("生成签名AuthToken失败: %w", err)
+		}
+		fmt.Println(token)
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, "注意: 固定AuthToken不含用户和有效期，仅在 auth.allow_static_token 为 true 时被接受，建议使用 -user 生成签名AuthToken")
+	token, err := authService.GenerateAuthToken()
+	if err != nil {
+		return fmt.Errorf("生成AuthToken失败: %w", err)
+	}
+	fmt.Println(token)
+	return nil
+}
+
+// genJWT 为指定用户签发JWT
+func genJWT(jwtService *service.JWTService, args []string) error {
+	flags := flag.NewFlagSet("gen-jwt", flag.ContinueOnError)
+	userID := flags.String("user", "", "用户ID（必填）")
+	userType := flags.String("type", "", "客户端类型，如mobile")
+	roomID := flags.String("room", "", "限定连接只能订阅的房间")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userID == "" {
+		return fmt.Errorf("缺少 -user 参数")
+	}
+
+	if jwtService.UsesDefaultSecret() {
+		fmt.Fprintln(os.Stderr, "注意: jwt.secret 仍为默认值，仅适用于本地开发")
+	}
+	token, err := jwtService.GenerateToken(*userID, *userType, *roomID)
+	if err != nil {
+		return fmt.Errorf("生成JWT失败: %w", err)
+	}
+	fmt.Println(token)
+	return nil
+}
+
+// verify 按服务器的规则校验token并输出其信息
+func verify(authService *service.AuthService, jwtService *service.JWTService, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("用法: cli verify <token>")
+	}
+
+	claims, err := service.VerifyToken(authService, jwtService, args[0])
+	if err != nil {
+		return fmt.Errorf("token校验失败（%s）: %w", service.TokenErrorReason(err), err)
+	}
+	if claims == nil {
+		fmt.Println("有效的AuthToken")
+		return nil
+	}
+
+	if service.TokenAuthMethod(args[0]) == service.AuthMethodSignedToken {
+		fmt.Println("有效的签名AuthToken")
+	} else {
+		fmt.Println("有效的JWT")
+	}
+	fmt.Printf("  user_id:    %s\n", claims.UserID)
+	if claims.UserType != "" {
+		fmt.Printf("  user_type:  %s\n", claims.UserType)
+	}
+	if claims.RoomID != "" {
+		fmt.Printf("  room_id:    %s\n", claims.RoomID)
+	}
+	fmt.Printf("  expires_at: %s\n", time.Unix(claims.ExpiresAt, 0).Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+	"letshare-server/internal/config"
+	"letshare-server/internal/service"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStdout 执行fn并返回其写到标准输出的内容
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	runErr := fn()
+	os.Stdout = stdout
+	w.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), runErr
+}
+
+func TestGenerateAndVerify(t *testing.T) {
+	authService := service.NewAuthService(config.Auth{TokenTTLSeconds: 3600, AllowStaticToken: true})
+	jwtService := service.NewJWTService("cli-test-secret", 1, 0)
+
+	tests := []struct {
+		name       string
+		generate   func() error
+		wantVerify string
+	}{
+		{"固定AuthToken", func() error { return genAuth(authService, nil) }, "有效的AuthToken"},
+		{"签名AuthToken", func() error { return genAuth(authService, []string{"-user", "alice"}) }, "有效的签名AuthToken"},
+		{"JWT", func() error { return genJWT(jwtService, []string{"-user", "alice", "-room", "lobby"}) }, "有效的JWT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := captureStdout(t, tt.generate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := captureStdout(t, func() error {
+				return verify(authService, jwtService, []string{strings.TrimSpace(token)})
+			})
+			if err != nil || !strings.HasPrefix(out, tt.wantVerify) {
+				t.Fatalf("verify() = (%q, %v), want 以%q开头", out, err, tt.wantVerify)
+			}
+			if tt.wantVerify != "有效的AuthToken" && !strings.Contains(out, "user_id:    alice") {
+				t.Fatalf("verify输出缺少user_id: %q", out)
+			}
+		})
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	authService := service.NewAuthService(config.Auth{AllowStaticToken: true})
+	jwtService := service.NewJWTService("cli-test-secret", 1, 0)
+
+	tests := []struct {
+		name    string
+		run     func() error
+		wantErr string
+	}{
+		{"gen-jwt缺少用户", func() error { return genJWT(jwtService, nil) }, "-user"},
+		{"verify缺少参数", func() error { return verify(authService, jwtService, nil) }, "用法"},
+		{"verify无效token", func() error { return verify(authService, jwtService, []string{"bogus"}) }, "token校验失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := captureStdout(t, tt.run); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want 包含%q", err, tt.wantErr)
+			}
+		})
+	}
+}
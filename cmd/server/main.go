@@ -1,16 +1,21 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"letshare-server/internal/config"
 	"letshare-server/internal/handler"
 	"letshare-server/internal/middleware"
 	"letshare-server/internal/service"
+	"letshare-server/pkg/certreload"
 	"letshare-server/pkg/logger"
+	"net/http"
+	_ "net/http/pprof"
 	"os"
 	"os/signal"
-	"regexp"
-	"strings"
 	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -22,7 +27,18 @@ func main() {
 	cfg := config.Load()
 
 	// 初始化日志
-	logger.Init(cfg.Log.Level, cfg.Log.MaxEntries)
+	logger.Init(logger.Options{
+		Level:           cfg.Log.Level,
+		MaxEntries:      cfg.Log.MaxEntries,
+		MaxRewriteBytes: cfg.Log.MaxRewriteBytes,
+		FileEnabled:     cfg.Log.FileEnabled,
+		MaxFileBytes:    cfg.Log.MaxFileBytes,
+		MaxBackups:      cfg.Log.MaxBackups,
+		HashUserIDs:     cfg.Log.HashUserIDs,
+		UserIDSalt:      cfg.Log.UserIDSalt,
+	})
+
+	logConfigSources()
 
 	// 根据模式设置Gin
 	if cfg.Mode == "production" {
@@ -30,8 +46,10 @@ func main() {
 	}
 
 	// 创建服务
-	wsService := service.NewWebSocketService(cfg.WebSocket.MaxRoomUsers)
-	authService := service.NewAuthService()
+	wsService := service.NewWebSocketService(cfg.WebSocket)
+	authService := service.NewAuthService(cfg.Auth)
+	jwtService := service.NewJWTService(cfg.JWT.Secret, cfg.JWT.ExpirationHours, cfg.JWT.LeewaySeconds)
+	featureService := service.NewFeatureService(cfg.Features)
 
 	// 创建路由
 	r := gin.New()
@@ -42,36 +60,16 @@ func main() {
 	r.Use(middleware.ErrorHandler())
 
 	// CORS配置
+	originMatcher := middleware.NewOriginMatcher(cfg.CORS.AllowedOrigins, cfg.CORS.AllowedCIDRs, cfg.CORS.AllowedOriginPatterns)
 	corsConfig := cors.Config{
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Upgrade", "Connection", "Sec-WebSocket-Key", "Sec-WebSocket-Version", "Sec-WebSocket-Protocol"},
 		AllowCredentials: true,
 		AllowOriginFunc: func(origin string) bool {
-			logrus.WithField("origin", origin).Debug("检查CORS来源")
-
-			// 检查配置文件中的允许来源
-			for _, allowedOrigin := range cfg.CORS.AllowedOrigins {
-				if origin == allowedOrigin {
-					logrus.WithField("origin", origin).Debug("CORS允许：配置文件匹配")
-					return true
-				}
-			}
-
-			// 检查是否是192.168.1.*网段
-			if origin != "" {
-				// 使用正则表达式匹配 http(s)://192.168.1.xxx:端口
-				pattern := `^https?://192\.168\.1\.\d{1,3}(:\d+)?/?$`
-				matched, err := regexp.MatchString(pattern, origin)
-				if err == nil && matched {
-					logrus.WithField("origin", origin).Debug("CORS允许：192.168.1.*网段匹配")
-					return true
-				}
-
-				// 额外检查：简单的字符串前缀匹配作为备用
-				if strings.HasPrefix(origin, "http://192.168.1.") || strings.HasPrefix(origin, "https://192.168.1.") {
-					logrus.WithField("origin", origin).Debug("CORS允许：192.168.1.*前缀匹配")
-					return true
-				}
+			// 精确匹配allowed_origins，其次检查allowed_cidrs网段，最后匹配allowed_origin_patterns
+			if originMatcher.Allowed(origin) {
+				logrus.WithField("origin", origin).Debug("CORS允许")
+				return true
 			}
 
 			logrus.WithField("origin", origin).Warn("CORS拒绝：未匹配任何规则")
@@ -81,49 +79,219 @@ func main() {
 	r.Use(cors.New(corsConfig))
 
 	// 创建处理器
-	wsHandler := handler.NewWebSocketHandler(wsService, authService)
-	healthHandler := handler.NewHealthHandler(wsService)
+	wsHandler := handler.NewWebSocketHandler(wsService, authService, jwtService, featureService, cfg.WebSocket, cfg.Security, originMatcher)
+	healthHandler := handler.NewHealthHandler(wsService, cfg.Health)
+	roomHandler := handler.NewRoomHandler(wsService)
+	adminHandler := handler.NewAdminHandler(wsService, cfg.WebSocket)
+
+	// 公共路由和管理路由（配置了admin_port时管理路由在独立端口上提供）
+	admin := registerRoutes(r, cfg, wsHandler, healthHandler, roomHandler, adminHandler)
+
+	// 生产环境要求显式密钥时，拒绝使用公开的默认密钥启动
+	if err := checkSecretRequirement(cfg, authService, jwtService); err != nil {
+		logrus.WithError(err).Fatal("拒绝以默认认证密钥启动服务器")
+	}
+
+	// 生产环境要求TLS时，拒绝以明文方式启动
+	if err := checkTLSRequirement(cfg); err != nil {
+		logrus.WithError(err).Fatal("拒绝以明文模式启动服务器")
+	}
 
-	// 路由
-	r.GET("/health", healthHandler.Health)
-	r.GET("/metrics", healthHandler.Metrics)
-	r.GET("/ws", wsHandler.HandleWebSocket)
-	r.GET("/", wsHandler.HandleWebSocket)
 	// 启动服务器
 	logrus.WithField("port", cfg.Server.Port).Info("启动WebSocket服务器")
 
-	// 优雅关闭
-	go func() {
-		if cfg.TLS.Enabled {
-			// 检查证书文件是否存在
-			if _, err := os.Stat(cfg.TLS.CertFile); err == nil {
-				logrus.WithFields(logrus.Fields{
-					"port":   cfg.Server.Port,
-					"domain": cfg.TLS.Domain,
-				}).Info("启动 HTTPS/WSS 服务器")
-				if err := r.RunTLS(":"+cfg.Server.Port, cfg.TLS.CertFile, cfg.TLS.KeyFile); err != nil {
-					logrus.WithError(err).Fatal("HTTPS 服务器启动失败")
-				}
-			} else {
-				logrus.WithError(err).Warn("SSL证书文件不存在，降级为HTTP模式")
-				if err := r.Run(":" + cfg.Server.Port); err != nil {
-					logrus.WithError(err).Fatal("服务器启动失败")
-				}
+	server := &http.Server{
+		Addr:    ":" + cfg.Server.Port,
+		Handler: r,
+		// 请求头迟迟不完整的连接不会进入处理器，由服务器层面的超时兜底
+		ReadHeaderTimeout: time.Duration(cfg.WebSocket.HandshakeTimeoutSeconds) * time.Second,
+	}
+
+	// TLS证书（支持热重载）
+	var certReloader *certreload.Reloader
+	if cfg.TLS.Enabled {
+		// 检查证书文件是否存在
+		if _, err := os.Stat(cfg.TLS.CertFile); err == nil {
+			certReloader, err = certreload.New(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+			if err != nil {
+				logrus.WithError(err).Fatal("加载TLS证书失败")
 			}
+			server.TLSConfig = &tls.Config{GetCertificate: certReloader.GetCertificate}
+		} else {
+			logrus.WithError(err).Warn("SSL证书文件不存在，降级为HTTP模式")
+		}
+	}
+
+	go func() {
+		var err error
+		if certReloader != nil {
+			logrus.WithFields(logrus.Fields{
+				"port":   cfg.Server.Port,
+				"domain": cfg.TLS.Domain,
+			}).Info("启动 HTTPS/WSS 服务器")
+			err = server.ListenAndServeTLS("", "")
 		} else {
 			logrus.Info("启动 HTTP/WS 服务器")
-			if err := r.Run(":" + cfg.Server.Port); err != nil {
-				logrus.WithError(err).Fatal("服务器启动失败")
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Fatal("服务器启动失败")
+		}
+	}()
+
+	// 收到SIGHUP时热重载TLS证书和功能开关，无需重启
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			logrus.Info("收到SIGHUP，重新加载配置")
+			if certReloader != nil {
+				if err := certReloader.Reload(); err != nil {
+					logrus.WithError(err).Error("重新加载TLS证书失败")
+				}
+			}
+			features, err := config.ReloadFeatures()
+			if err != nil {
+				logrus.WithError(err).Error("重新加载功能开关失败")
+				continue
 			}
+			featureService.Update(features)
 		}
 	}()
 
+	var adminServer *http.Server
+	if admin != nil {
+		adminServer = &http.Server{
+			Addr:    ":" + cfg.Server.AdminPort,
+			Handler: admin,
+		}
+		go func() {
+			logrus.WithField("port", cfg.Server.AdminPort).Info("启动管理端口服务器")
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logrus.WithError(err).Fatal("管理端口服务器启动失败")
+			}
+		}()
+	}
+
 	// 等待中断信号
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	logrus.Info("正在关闭服务器...")
-	wsService.Shutdown()
+	// 配置了迁移目标时，先引导客户端迁移到新实例
+	if target := cfg.WebSocket.MigrationTargetURL; target != "" && !wsService.Draining() {
+		deadline := time.Duration(cfg.WebSocket.MigrationDeadlineSeconds) * time.Second
+		wsService.Migrate(target, deadline)
+		// 客户端全部迁移后立即继续关闭，无需等满截止时间
+		if wsService.WaitDrained(deadline) {
+			logrus.Info("所有客户端已迁移")
+		}
+	}
+	// 先关闭WebSocket连接（已被劫持的连接不受http.Server.Shutdown管理）
+	wsService.Shutdown("server shutdown")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logrus.WithError(err).Error("关闭HTTP服务器失败")
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			logrus.WithError(err).Error("关闭管理端口服务器失败")
+		}
+	}
 	logrus.Info("服务器已关闭")
 }
+
+// registerRoutes 在公共路由上挂载WebSocket、健康检查等接口。配置了admin_port时，管理接口挂载到返回的独立路由上，
+// 公共路由不提供任何管理接口；未配置时返回nil，只有/metrics和/metrics/prometheus保留在公共路由上（与此前一致），其余管理接口不可用
+func registerRoutes(r *gin.Engine, cfg *config.Config, wsHandler *handler.WebSocketHandler, healthHandler *handler.HealthHandler, roomHandler *handler.RoomHandler, adminHandler *handler.AdminHandler) *gin.Engine {
+	r.GET("/health", healthHandler.Health)
+	r.GET("/ready", healthHandler.Ready)
+	r.GET("/load", healthHandler.Load)
+	r.GET("/auth/verify", wsHandler.VerifyToken)
+	r.GET("/ws", wsHandler.HandleWebSocket)
+	r.GET("/", wsHandler.HandleWebSocket)
+
+	if cfg.Server.AdminPort == "" {
+		logrus.Info("未配置server.admin_port，/metrics保留在公共端口，其余管理接口不可用")
+		r.GET("/metrics", healthHandler.Metrics)
+		r.GET("/metrics/prometheus", healthHandler.PrometheusMetrics)
+		return nil
+	}
+
+	admin := gin.New()
+	admin.Use(gin.Recovery())
+	admin.Use(middleware.Logger())
+	admin.Use(middleware.ErrorHandler())
+	admin.GET("/debug/pprof/*any", gin.WrapH(http.DefaultServeMux))
+	admin.POST("/migrate", adminHandler.Migrate)
+	admin.POST("/broadcast", adminHandler.Broadcast)
+	admin.GET("/metrics", healthHandler.Metrics)
+	admin.GET("/metrics/prometheus", healthHandler.PrometheusMetrics)
+	admin.GET("/clients", adminHandler.Clients)
+	admin.DELETE("/clients/:id", adminHandler.Kick)
+	admin.GET("/config", adminHandler.Config)
+	admin.GET("/rooms", roomHandler.List)
+	admin.GET("/rooms/:name/members", roomHandler.Members)
+	admin.GET("/logs", adminHandler.Logs)
+	admin.GET("/rooms/:name/snapshot", adminHandler.RoomSnapshot)
+	admin.GET("/clients/:id/ratelimit", adminHandler.RateLimit)
+	admin.DELETE("/clients/:id/ratelimit", adminHandler.ResetRateLimit)
+	return admin
+}
+
+// logConfigSources 启动诊断：记录被环境变量和配置文件覆盖的配置项数量和env覆盖的键，Debug级别下逐项输出值和来源
+func logConfigSources() {
+	counts := make(map[string]int)
+	var envKeys []string
+	for _, source := range config.Sources() {
+		counts[source.Source]++
+		if source.Source == config.SourceEnv {
+			envKeys = append(envKeys, source.Key)
+		}
+		logrus.WithFields(logrus.Fields{
+			"key":    source.Key,
+			"value":  source.Value,
+			"source": source.Source,
+		}).Debug("配置项")
+	}
+	logrus.WithFields(logrus.Fields{
+		"env":      counts[config.SourceEnv],
+		"file":     counts[config.SourceFile],
+		"default":  counts[config.SourceDefault],
+		"env_keys": envKeys,
+	}).Info("配置已加载")
+}
+
+// checkSecretRequirement 检查生产模式下是否配置了非默认的认证密钥
+func checkSecretRequirement(cfg *config.Config, authService *service.AuthService, jwtService *service.JWTService) error {
+	if cfg.Mode != "production" || !cfg.Security.RequireExplicitSecret {
+		return nil
+	}
+	if authService.UsesDefaultSecret() {
+		return fmt.Errorf("生产模式要求显式配置认证密钥，但 SERVER_AUTH_SECRET 未设置或仍为默认值")
+	}
+	if jwtService.UsesDefaultSecret() {
+		return fmt.Errorf("生产模式要求显式配置认证密钥，但 jwt.secret 未设置或仍为默认值")
+	}
+	return nil
+}
+
+// checkTLSRequirement 检查生产模式下是否满足强制TLS的要求
+func checkTLSRequirement(cfg *config.Config) error {
+	if cfg.Mode != "production" || !cfg.TLS.RequireInProduction {
+		return nil
+	}
+	if !cfg.TLS.Enabled {
+		return fmt.Errorf("生产模式要求启用TLS，但 tls.enabled 为 false")
+	}
+	if _, err := os.Stat(cfg.TLS.CertFile); err != nil {
+		return fmt.Errorf("生产模式要求启用TLS，但证书文件不可用: %w", err)
+	}
+	if _, err := os.Stat(cfg.TLS.KeyFile); err != nil {
+		return fmt.Errorf("生产模式要求启用TLS，但私钥文件不可用: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"letshare-server/internal/config"
+	"letshare-server/internal/handler"
+	"letshare-server/internal/middleware"
+	"letshare-server/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckTLSRequirement(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.WriteFile(file, []byte("test"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing := filepath.Join(dir, "missing.pem")
+
+	tests := []struct {
+		name    string
+		mode    string
+		tls     config.TLS
+		wantErr bool
+	}{
+		{"生产模式要求TLS但未启用", "production", config.TLS{RequireInProduction: true}, true},
+		{"生产模式要求TLS但证书缺失", "production", config.TLS{RequireInProduction: true, Enabled: true, CertFile: missing, KeyFile: keyFile}, true},
+		{"生产模式要求TLS但私钥缺失", "production", config.TLS{RequireInProduction: true, Enabled: true, CertFile: certFile, KeyFile: missing}, true},
+		{"生产模式证书齐全", "production", config.TLS{RequireInProduction: true, Enabled: true, CertFile: certFile, KeyFile: keyFile}, false},
+		{"生产模式未要求TLS", "production", config.TLS{Enabled: true, CertFile: missing, KeyFile: missing}, false},
+		{"本地模式证书缺失", "local", config.TLS{RequireInProduction: true, Enabled: true, CertFile: missing, KeyFile: missing}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Mode: tt.mode, TLS: tt.tls}
+			if err := checkTLSRequirement(cfg); (err != nil) != tt.wantErr {
+				t.Fatalf("checkTLSRequirement() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckSecretRequirement(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		require    bool
+		authSecret string
+		jwtSecret  string
+		wantErr    bool
+	}{
+		{"生产模式默认AuthToken密钥", "production", true, "", "explicit-jwt", true},
+		{"生产模式默认JWT密钥", "production", true, "explicit-auth", "", true},
+		{"生产模式显式密钥", "production", true, "explicit-auth", "explicit-jwt", false},
+		{"生产模式未要求显式密钥", "production", false, "", "", false},
+		{"本地模式默认密钥", "local", true, "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SERVER_AUTH_SECRET", tt.authSecret)
+			cfg := &config.Config{Mode: tt.mode, Security: config.Security{RequireExplicitSecret: tt.require}}
+			authService := service.NewAuthService(config.Auth{AllowStaticToken: true})
+			jwtService := service.NewJWTService(tt.jwtSecret, 1, 0)
+			if err := checkSecretRequirement(cfg, authService, jwtService); (err != nil) != tt.wantErr {
+				t.Fatalf("checkSecretRequirement() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newTestRoutes 按配置挂载路由，返回公共路由和管理路由（未配置admin_port时为nil）
+func newTestRoutes(t *testing.T, cfg *config.Config) (*gin.Engine, *gin.Engine) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	wsService := service.NewWebSocketService(cfg.WebSocket)
+	t.Cleanup(func() { wsService.Shutdown("test") })
+
+	wsHandler := handler.NewWebSocketHandler(wsService, service.NewAuthService(config.Auth{AllowStaticToken: true}), service.NewJWTService("", 1, 0), service.NewFeatureService(cfg.Features), cfg.WebSocket, cfg.Security, middleware.NewOriginMatcher(nil, nil, nil))
+	r := gin.New()
+	admin := registerRoutes(r, cfg, wsHandler, handler.NewHealthHandler(wsService, cfg.Health), handler.NewRoomHandler(wsService), handler.NewAdminHandler(wsService, cfg.WebSocket))
+	return r, admin
+}
+
+// statusOf 返回路由对GET请求的响应状态码
+func statusOf(engine *gin.Engine, path string) int {
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder.Code
+}
+
+func TestRegisterRoutesAdminPort(t *testing.T) {
+	public, admin := newTestRoutes(t, &config.Config{Server: config.Server{AdminPort: "9090"}})
+	if admin == nil {
+		t.Fatal("配置了admin_port时应返回管理路由")
+	}
+
+	for _, path := range []string{"/metrics", "/metrics/prometheus", "/clients", "/config", "/rooms", "/logs"} {
+		if status := statusOf(public, path); status != http.StatusNotFound {
+			t.Errorf("公共端口 %s 状态码 = %d, want 404", path, status)
+		}
+		if status := statusOf(admin, path); status != http.StatusOK {
+			t.Errorf("管理端口 %s 状态码 = %d, want 200", path, status)
+		}
+	}
+	for _, path := range []string{"/clients/unknown/ratelimit", "/rooms/lobby/snapshot", "/rooms/lobby/members"} {
+		if status := statusOf(public, path); status != http.StatusNotFound {
+			t.Errorf("公共端口 %s 状态码 = %d, want 404", path, status)
+		}
+	}
+	if status := statusOf(public, "/health"); status != http.StatusOK {
+		t.Errorf("公共端口 /health 状态码 = %d, want 200", status)
+	}
+	if status := statusOf(admin, "/health"); status != http.StatusNotFound {
+		t.Errorf("管理端口不应提供 /health，状态码 = %d", status)
+	}
+}
+
+func TestRegisterRoutesWithoutAdminPort(t *testing.T) {
+	public, admin := newTestRoutes(t, &config.Config{})
+	if admin != nil {
+		t.Fatal("未配置admin_port时不应返回管理路由")
+	}
+
+	// /metrics与此前一样留在公共端口，其余管理接口不可用
+	for _, path := range []string{"/metrics", "/metrics/prometheus"} {
+		if status := statusOf(public, path); status != http.StatusOK {
+			t.Errorf("公共端口 %s 状态码 = %d, want 200", path, status)
+		}
+	}
+	for _, path := range []string{"/clients", "/config", "/rooms", "/logs", "/rooms/lobby/members"} {
+		if status := statusOf(public, path); status != http.StatusNotFound {
+			t.Errorf("公共端口 %s 状态码 = %d, want 404", path, status)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"strings"
@@ -8,6 +9,9 @@ import (
 	"github.com/spf13/viper"
 )
 
+// DefaultJWTSecret 未配置jwt.secret时使用的公开默认密钥，仅适用于本地开发
+const DefaultJWTSecret = "letshare-jwt-secret-key-2024"
+
 type Config struct {
 	Mode      string    `mapstructure:"mode"`
 	Server    Server    `mapstructure:"server"`
@@ -15,10 +19,16 @@ type Config struct {
 	CORS      CORS      `mapstructure:"cors"`
 	Log       Log       `mapstructure:"log"`
 	WebSocket WebSocket `mapstructure:"websocket"`
+	Features  Features  `mapstructure:"features"`
+	Security  Security  `mapstructure:"security"`
+	JWT       JWT       `mapstructure:"jwt"`
+	Auth      Auth      `mapstructure:"auth"`
+	Health    Health    `mapstructure:"health"`
 }
 
 type Server struct {
-	Port string `mapstructure:"port"`
+	Port      string `mapstructure:"port"`
+	AdminPort string `mapstructure:"admin_port"` // 管理接口的独立监听端口，为空时只有/metrics留在公共端口
 }
 
 type TLS struct {
@@ -27,19 +37,149 @@ type TLS struct {
 	KeyFile  string `mapstructure:"key_file"`
 	AutoCert bool   `mapstructure:"auto_cert"`
 	Domain   string `mapstructure:"domain"`
+	// RequireInProduction 生产模式下禁止降级为明文HTTP/WS
+	RequireInProduction bool `mapstructure:"require_in_production"`
+}
+
+type JWT struct {
+	Secret          string `mapstructure:"secret"`
+	ExpirationHours int    `mapstructure:"expiration_hours"`
+	// LeewaySeconds 校验exp/nbf时容忍的时钟偏差（秒）
+	LeewaySeconds int `mapstructure:"leeway_seconds"`
+}
+
+type Auth struct {
+	// TokenTTLSeconds 签名AuthToken的有效期（秒），0表示使用默认的24小时
+	TokenTTLSeconds int `mapstructure:"token_ttl_seconds"`
+	// AllowStaticToken 是否仍接受旧的固定AuthToken（SERVER_AUTH_SECRET的SHA256），客户端迁移到签名AuthToken后应关闭
+	AllowStaticToken bool `mapstructure:"allow_static_token"`
+}
+
+type Health struct {
+	// MaxGoroutines goroutine数超过该值时/health返回503（degraded），0表示不检查
+	MaxGoroutines int `mapstructure:"max_goroutines"`
+	// MaxHeapMB 堆内存分配超过该值（MB）时/health返回503（degraded），0表示不检查
+	MaxHeapMB int `mapstructure:"max_heap_mb"`
+}
+
+type Security struct {
+	// RequireExplicitSecret 生产模式下认证密钥仍为默认值时拒绝启动
+	RequireExplicitSecret bool `mapstructure:"require_explicit_secret"`
+	// StrictOriginCheck WebSocket升级时要求Origin的主机与请求Host一致，或来源在cors.allowed_origins中/匹配cors.allowed_origin_patterns
+	StrictOriginCheck bool `mapstructure:"strict_origin_check"`
+	// VerboseAuthErrors token校验失败时是否向客户端返回原因和详细信息，默认关闭，只返回通用错误
+	VerboseAuthErrors bool `mapstructure:"verbose_auth_errors"`
 }
 
 type CORS struct {
 	AllowedOrigins []string `mapstructure:"allowed_origins"`
+	// AllowedCIDRs 主机为这些网段内IP（如192.168.0.0/16、fd00::/8）的http/https来源也允许，域名来源不检查网段
+	AllowedCIDRs []string `mapstructure:"allowed_cidrs"`
+	// AllowedOriginPatterns 额外允许的来源正则表达式，无效的模式启动时记录错误并跳过
+	AllowedOriginPatterns []string `mapstructure:"allowed_origin_patterns"`
 }
 
 type Log struct {
-	Level      string `mapstructure:"level"`
-	MaxEntries int    `mapstructure:"max_entries"`
+	Level           string `mapstructure:"level"`
+	MaxEntries      int    `mapstructure:"max_entries"`
+	MaxRewriteBytes int64  `mapstructure:"max_rewrite_bytes"`
+	FileEnabled     bool   `mapstructure:"file_enabled"`
+	MaxFileBytes    int64  `mapstructure:"max_file_bytes"` // errors.log超过该大小时轮转，0表示只按日期轮转（此时仍按max_entries整理）
+	MaxBackups      int    `mapstructure:"max_backups"`    // 最多保留的轮转文件数，0表示轮转时直接丢弃旧文件
+	HashUserIDs     bool   `mapstructure:"hash_user_ids"`  // 为true时日志中的用户ID替换为加盐哈希（同一ID哈希相同，可用于关联）
+	UserIDSalt      string `mapstructure:"user_id_salt"`   // 用户ID哈希的盐值，为空时每次启动随机生成
 }
 
 type WebSocket struct {
-	MaxRoomUsers int `mapstructure:"max_room_users"`
+	MaxRoomUsers      int  `mapstructure:"max_room_users"`
+	MaxConnections    int  `mapstructure:"max_connections"`     // 单实例最大连接数，超出时拒绝新连接（503），也用于负载上报，0表示不限制
+	MaxTrackedOrigins int  `mapstructure:"max_tracked_origins"` // 按Origin统计连接数时最多跟踪的Origin数量，超出部分计入other
+	StrictDecoding    bool `mapstructure:"strict_decoding"`     // 严格模式下拒绝包含未知字段的消息
+	// MaxRoomsOwnedPerUser 单个用户最多可同时创建（拥有）的房间数，0表示不限制；
+	// JWT或签名AuthToken认证的用户按用户ID计数，自行声明userId的连接按连接计数
+	MaxRoomsOwnedPerUser int `mapstructure:"max_rooms_owned_per_user"`
+	// MaxRoomsPerClient 单个连接最多可同时订阅的房间数，0表示不限制
+	MaxRoomsPerClient int `mapstructure:"max_rooms_per_client"`
+	// CloseOnProtocolErrors 为true时，不支持的消息类型、缺少频道和消息过大在回复错误后以对应关闭码断开连接
+	CloseOnProtocolErrors bool `mapstructure:"close_on_protocol_errors"`
+	// PingIntervalSeconds 服务端发送ping控制帧的间隔（秒）
+	PingIntervalSeconds int `mapstructure:"ping_interval_seconds"`
+	// PongTimeoutSeconds 超过该时间未收到pong或消息即断开（秒），至少为ping间隔的两倍
+	PongTimeoutSeconds int `mapstructure:"pong_timeout_seconds"`
+	// ServerHeartbeatSeconds 服务端应用层心跳间隔（秒），0表示关闭
+	ServerHeartbeatSeconds int `mapstructure:"server_heartbeat_seconds"`
+	// NormalizeEvents 订阅signal:all后移除同一房间内冗余的具体事件订阅
+	NormalizeEvents bool `mapstructure:"normalize_events"`
+	// HandshakeTimeoutSeconds 完成升级并发送第一条消息的时限（秒），0表示不限制
+	HandshakeTimeoutSeconds int `mapstructure:"handshake_timeout_seconds"`
+	// InactiveTimeoutSeconds 客户端超过该时间无活动即被清理（秒），应大于ping间隔
+	InactiveTimeoutSeconds int `mapstructure:"inactive_timeout_seconds"`
+	// SubscribeTimeoutSeconds 连接后超过该时间仍未订阅任何房间的客户端被断开（关闭码4003），0表示不限制
+	SubscribeTimeoutSeconds int `mapstructure:"subscribe_timeout_seconds"`
+	// TokenExpiryGraceSeconds JWT过期后连接转为只读（可接收、不能发布和订阅）的宽限期，期间刷新token即恢复；0表示过期后直接断开
+	TokenExpiryGraceSeconds int `mapstructure:"token_expiry_grace_seconds"`
+	// MaintenanceIntervalSeconds 维护任务（清理非活跃客户端、日志等）的执行间隔（秒）
+	MaintenanceIntervalSeconds int `mapstructure:"maintenance_interval_seconds"`
+	// SendBufferSize 每个客户端发送队列的容量，写满时视为慢客户端并断开
+	SendBufferSize int `mapstructure:"send_buffer_size"`
+	// BroadcastAllRooms 匹配这些模式（path.Match语法，如chat-*）的房间向所有成员广播，忽略事件订阅
+	BroadcastAllRooms []string `mapstructure:"broadcast_all_rooms"`
+	// BufferedRooms 匹配这些模式的房间为会话挂起中的成员缓存消息，恢复会话时补发（需开启session_resume_seconds）
+	BufferedRooms []string `mapstructure:"buffered_rooms"`
+	// RoomUserLimits 按房间名模式（path.Match语法）覆盖max_room_users，如 meeting-*: 200
+	RoomUserLimits map[string]int `mapstructure:"room_user_limits"`
+	// RoomMessageBytes 按房间名模式（path.Match语法）覆盖publish数据的最大字节数，如 chat-*: 4096；不能超过max_message_bytes
+	RoomMessageBytes map[string]int `mapstructure:"room_message_bytes"`
+	// RoomHistorySize 订阅时带history: true创建的房间，每个事件保留的最近消息数，0表示禁用
+	RoomHistorySize int `mapstructure:"room_history_size"`
+	// ChatMaxLength chat消息文本的最大字符数，0表示不限制
+	ChatMaxLength int `mapstructure:"chat_max_length"`
+	// MaxConcurrentHandshakes 同时进行中的握手（token校验和升级）数上限，超出的请求排队片刻后返回503，0表示不限制
+	MaxConcurrentHandshakes int `mapstructure:"max_concurrent_handshakes"`
+	// MaxConnectionsPerIP 单个IP的最大连接数，超出时拒绝新连接（429），0表示不限制
+	MaxConnectionsPerIP int `mapstructure:"max_connections_per_ip"`
+	// RoomIdleTimeoutSeconds 超过该时间没有成员加入/离开、也没有消息的房间会被关闭（成员收到room:idle_closed），0表示不关闭
+	RoomIdleTimeoutSeconds int `mapstructure:"room_idle_timeout_seconds"`
+	// SendOverflowPolicy 发送队列写满时的处理：disconnect（断开）、drop_oldest、drop_newest，连接时可用overflowPolicy参数覆盖
+	SendOverflowPolicy string `mapstructure:"send_overflow_policy"`
+	// RoomFullSuggestions 房间已满时建议备选房间的策略：空为不建议（普通错误），numeric_suffix为追加数字后缀
+	RoomFullSuggestions string `mapstructure:"room_full_suggestions"`
+	// PublishRatePerSecond 单个连接每秒允许发布的消息数，0表示不限流
+	PublishRatePerSecond float64 `mapstructure:"publish_rate_per_second"`
+	// PublishBurst 允许的突发消息数（令牌桶容量）
+	PublishBurst int `mapstructure:"publish_burst"`
+	// MaxGlobalPublishesPerSecond 全服务器每秒允许的publish总数，超出的消息返回429，0表示不限制
+	MaxGlobalPublishesPerSecond int `mapstructure:"max_global_publishes_per_second"`
+	// MigrationTargetURL 迁移时引导客户端连接的目标实例地址，为空时关闭服务不发送迁移通知
+	MigrationTargetURL string `mapstructure:"migration_target_url"`
+	// MigrationDeadlineSeconds 客户端完成迁移的时限（秒），超时后关闭连接
+	MigrationDeadlineSeconds int `mapstructure:"migration_deadline_seconds"`
+	// CaptureHeaders 连接时复制到客户端元数据中的请求头（如X-Tenant-ID），可在/clients中查看
+	CaptureHeaders []string `mapstructure:"capture_headers"`
+	// ShutdownGraceSeconds 关闭服务时发送server:shutdown通知后等待写出的最长时间（秒）
+	ShutdownGraceSeconds int `mapstructure:"shutdown_grace_seconds"`
+	// ShutdownReconnectDelaySeconds server:shutdown通知中建议客户端等待多久再重连（秒）
+	ShutdownReconnectDelaySeconds int `mapstructure:"shutdown_reconnect_delay_seconds"`
+	// MaxSubscribeBatch 单条subscribe消息的channels最多包含的房间数，0表示不限制
+	MaxSubscribeBatch int `mapstructure:"max_subscribe_batch"`
+	// MessageSizeLimits 按消息类型限制的最大字节数（如subscribe: 4096），未列出的类型只受连接级读限制
+	MessageSizeLimits map[string]int `mapstructure:"message_size_limits"`
+	// MaxMessageBytes publish数据的最大字节数，超出时返回413错误；连接级读限制比它多64KB，超过读限制时连接被关闭
+	MaxMessageBytes int `mapstructure:"max_message_bytes"`
+	// MessageWorkers 每个连接并发处理消息的worker数，同一频道的消息保持顺序；1表示串行处理
+	MessageWorkers int `mapstructure:"message_workers"`
+	// SessionResumeSeconds 异常断开的客户端凭sessionId重连恢复订阅的宽限期（秒），0表示不开启
+	SessionResumeSeconds int `mapstructure:"session_resume_seconds"`
+	// MaxResumeSessions 同时挂起等待恢复的会话数上限，满时淘汰最早的会话，0表示不限制
+	MaxResumeSessions int `mapstructure:"max_resume_sessions"`
+	// ResumeTokens 开启后每次连接在connected中下发一次性恢复令牌，恢复会话时必须携带上次连接下发的令牌
+	ResumeTokens bool `mapstructure:"resume_tokens"`
+}
+
+// Features 下发给客户端的功能开关（注意：viper会将键名转为小写，建议使用snake_case）
+type Features struct {
+	Defaults  map[string]interface{}            `mapstructure:"defaults"`
+	Overrides map[string]map[string]interface{} `mapstructure:"overrides"` // userType -> 覆盖的开关
 }
 
 func Load() *Config {
@@ -74,13 +214,37 @@ func Load() *Config {
 	return &cfg
 }
 
+// ReloadFeatures 重新读取配置文件中的功能开关（用于SIGHUP热重载）
+func ReloadFeatures() (Features, error) {
+	var features Features
+	if err := viper.ReadInConfig(); err != nil {
+		return features, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	if err := viper.UnmarshalKey("features", &features); err != nil {
+		return features, fmt.Errorf("解析功能开关失败: %w", err)
+	}
+	return features, nil
+}
+
 func setDefaults() {
 	viper.SetDefault("server.port", "8080")
+	viper.SetDefault("server.admin_port", "")
 	viper.SetDefault("tls.enabled", false)
 	viper.SetDefault("tls.cert_file", "/etc/letsencrypt/live/ecs.letshare.fun/fullchain.pem")
 	viper.SetDefault("tls.key_file", "/etc/letsencrypt/live/ecs.letshare.fun/privkey.pem")
 	viper.SetDefault("tls.auto_cert", true)
 	viper.SetDefault("tls.domain", "ecs.letshare.fun")
+	viper.SetDefault("tls.require_in_production", false)
+	viper.SetDefault("security.require_explicit_secret", false)
+	viper.SetDefault("security.strict_origin_check", false)
+	viper.SetDefault("security.verbose_auth_errors", false)
+	viper.SetDefault("health.max_goroutines", 0)
+	viper.SetDefault("health.max_heap_mb", 0)
+	viper.SetDefault("jwt.secret", DefaultJWTSecret)
+	viper.SetDefault("jwt.expiration_hours", 720)
+	viper.SetDefault("jwt.leeway_seconds", 30)
+	viper.SetDefault("auth.token_ttl_seconds", 86400)
+	viper.SetDefault("auth.allow_static_token", true)
 	viper.SetDefault("cors.allowed_origins", []string{
 		"https://letshare.fun",
 		"https://www.letshare.fun",
@@ -88,7 +252,65 @@ func setDefaults() {
 		"http://localhost:3000",
 		"http://localhost:5173",
 	})
+	viper.SetDefault("cors.allowed_cidrs", []string{"192.168.1.0/24"})
+	viper.SetDefault("cors.allowed_origin_patterns", []string{})
 	viper.SetDefault("log.level", "info")
 	viper.SetDefault("log.max_entries", 200)
+	viper.SetDefault("log.max_rewrite_bytes", 1<<20)
+	viper.SetDefault("log.file_enabled", true)
+	viper.SetDefault("log.max_file_bytes", 0)
+	viper.SetDefault("log.max_backups", 7)
+	viper.SetDefault("log.hash_user_ids", false)
+	viper.SetDefault("log.user_id_salt", "")
 	viper.SetDefault("websocket.max_room_users", 50)
+	viper.SetDefault("websocket.max_connections", 0)
+	viper.SetDefault("websocket.max_tracked_origins", 100)
+	viper.SetDefault("websocket.strict_decoding", false)
+	viper.SetDefault("websocket.max_rooms_owned_per_user", 0)
+	viper.SetDefault("websocket.max_rooms_per_client", 20)
+	viper.SetDefault("websocket.close_on_protocol_errors", false)
+	viper.SetDefault("websocket.ping_interval_seconds", 30)
+	viper.SetDefault("websocket.pong_timeout_seconds", 60)
+	viper.SetDefault("websocket.server_heartbeat_seconds", 0)
+	viper.SetDefault("websocket.normalize_events", false)
+	viper.SetDefault("websocket.handshake_timeout_seconds", 0)
+	viper.SetDefault("websocket.inactive_timeout_seconds", 300)
+	viper.SetDefault("websocket.subscribe_timeout_seconds", 0)
+	viper.SetDefault("websocket.token_expiry_grace_seconds", 0)
+	viper.SetDefault("websocket.maintenance_interval_seconds", 30)
+	viper.SetDefault("websocket.send_buffer_size", 256)
+	viper.SetDefault("websocket.broadcast_all_rooms", []string{})
+	viper.SetDefault("websocket.buffered_rooms", []string{})
+	viper.SetDefault("websocket.room_user_limits", map[string]int{})
+	viper.SetDefault("websocket.room_message_bytes", map[string]int{})
+	viper.SetDefault("websocket.room_history_size", 0)
+	viper.SetDefault("websocket.chat_max_length", 2000)
+	viper.SetDefault("websocket.send_overflow_policy", "disconnect")
+	viper.SetDefault("websocket.max_concurrent_handshakes", 0)
+	viper.SetDefault("websocket.max_connections_per_ip", 0)
+	viper.SetDefault("websocket.room_idle_timeout_seconds", 0)
+	viper.SetDefault("websocket.room_full_suggestions", "")
+	viper.SetDefault("websocket.publish_rate_per_second", 0)
+	viper.SetDefault("websocket.max_global_publishes_per_second", 0)
+	viper.SetDefault("websocket.publish_burst", 0)
+	viper.SetDefault("websocket.migration_target_url", "")
+	viper.SetDefault("websocket.migration_deadline_seconds", 10)
+	viper.SetDefault("websocket.capture_headers", []string{})
+	viper.SetDefault("websocket.shutdown_grace_seconds", 2)
+	viper.SetDefault("websocket.shutdown_reconnect_delay_seconds", 5)
+	viper.SetDefault("websocket.max_subscribe_batch", 0)
+	viper.SetDefault("websocket.message_size_limits", map[string]int{
+		"subscribe":       4096,
+		"unsubscribe":     4096,
+		"list_rooms":      1024,
+		"disconnect":      1024,
+		"refresh":         4096,
+		"whoami":          1024,
+		"presence_resync": 1024,
+	})
+	viper.SetDefault("websocket.session_resume_seconds", 0)
+	viper.SetDefault("websocket.max_resume_sessions", 10000)
+	viper.SetDefault("websocket.resume_tokens", false)
+	viper.SetDefault("websocket.max_message_bytes", 512*1024)
+	viper.SetDefault("websocket.message_workers", 1)
 }
\ No newline at end of file
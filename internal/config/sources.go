@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// 配置项的来源，优先级从高到低为env、file、default
+const (
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceDefault = "default"
+)
+
+// redactedValue 敏感配置项输出时的替代值
+const redactedValue = "[REDACTED]"
+
+// sensitiveKeyParts 配置项名（最后一段）包含这些片段且值为非空字符串时视为敏感信息
+var sensitiveKeyParts = []string{"secret", "salt", "password", "token"}
+
+// KeySource 配置项的最终值及其来源
+type KeySource struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// Sources 列出所有配置项的最终值和来源（按键名排序），敏感值已脱敏
+func Sources() []KeySource {
+	keys := viper.AllKeys()
+	sort.Strings(keys)
+
+	sources := make([]KeySource, 0, len(keys))
+	for _, key := range keys {
+		sources = append(sources, KeySource{
+			Key:    key,
+			Value:  redact(key, viper.Get(key)),
+			Source: keySource(key),
+		})
+	}
+	return sources
+}
+
+// keySource 判断配置项的来源：与Load中的环境变量规则一致（LETSHARE_前缀，.替换为_）
+func keySource(key string) string {
+	envKey := "LETSHARE_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+	if _, ok := os.LookupEnv(envKey); ok {
+		return SourceEnv
+	}
+	if viper.InConfig(key) {
+		return SourceFile
+	}
+	return SourceDefault
+}
+
+// redact 敏感配置项的非空字符串值替换为[REDACTED]
+func redact(key string, value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok || str == "" {
+		return value
+	}
+	name := key[strings.LastIndex(key, ".")+1:]
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(name, part) {
+			return redactedValue
+		}
+	}
+	return value
+}
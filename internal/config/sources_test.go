@@ -0,0 +1,62 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSources(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "configs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	yaml := "jwt:\n  secret: file-secret\nlog:\n  level: debug\n"
+	if err := os.WriteFile(filepath.Join(dir, "configs", "sources-test.yaml"), []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		viper.Reset()
+	})
+	t.Setenv("MODE", "sources-test")
+	t.Setenv("LETSHARE_SERVER_PORT", "9090")
+	viper.Reset()
+	Load()
+
+	sources := make(map[string]KeySource)
+	for _, source := range Sources() {
+		sources[source.Key] = source
+	}
+	tests := []struct {
+		key        string
+		wantValue  interface{}
+		wantSource string
+	}{
+		{"server.port", "9090", SourceEnv},
+		{"log.level", "debug", SourceFile},
+		{"jwt.secret", redactedValue, SourceFile}, // 敏感值脱敏
+		{"jwt.expiration_hours", 720, SourceDefault},
+		{"log.user_id_salt", "", SourceDefault}, // 空值无需脱敏
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, ok := sources[tt.key]
+			if !ok {
+				t.Fatalf("缺少配置项%s", tt.key)
+			}
+			if got.Value != tt.wantValue || got.Source != tt.wantSource {
+				t.Fatalf("%s = (%v, %s), want (%v, %s)", tt.key, got.Value, got.Source, tt.wantValue, tt.wantSource)
+			}
+		})
+	}
+}
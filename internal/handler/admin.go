@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"letshare-server/internal/config"
+	"letshare-server/internal/service"
+	"letshare-server/pkg/logger"
+	"letshare-server/pkg/response"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type AdminHandler struct {
+	wsService *service.WebSocketService
+	cfg       config.WebSocket
+}
+
+func NewAdminHandler(wsService *service.WebSocketService, cfg config.WebSocket) *AdminHandler {
+	return &AdminHandler{
+		wsService: wsService,
+		cfg:       cfg,
+	}
+}
+
+// Clients 列出所有在线客户端及其元数据
+func (h *AdminHandler) Clients(c *gin.Context) {
+	clients := h.wsService.GetClients()
+	response.Success(c, http.StatusOK, gin.H{
+		"count":   len(clients),
+		"clients": clients,
+	})
+}
+
+// RoomSnapshot 返回房间的完整状态（成员、事件订阅数、历史消息），用于排查单个会话
+func (h *AdminHandler) RoomSnapshot(c *gin.Context) {
+	roomName := c.Param("name")
+
+	snapshot, exists := h.wsService.GetRoomSnapshot(roomName)
+	if !exists {
+		response.Error(c, http.StatusNotFound, "房间不存在: "+roomName)
+		return
+	}
+	response.Success(c, http.StatusOK, snapshot)
+}
+
+// defaultLogsLimit /logs未指定limit时返回的条数
+const defaultLogsLimit = 100
+
+// Logs 返回内存中最近的日志（包括info级别），level为最低级别（默认info），最新的在前
+func (h *AdminHandler) Logs(c *gin.Context) {
+	level := c.DefaultQuery("level", "info")
+	if _, err := logrus.ParseLevel(level); err != nil {
+		response.Error(c, http.StatusBadRequest, "无效的日志级别: "+level)
+		return
+	}
+	limit := defaultLogsLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			response.Error(c, http.StatusBadRequest, "limit必须为正整数")
+			return
+		}
+		limit = parsed
+	}
+
+	logs := logger.GetRecentLogs(level, limit)
+	response.Success(c, http.StatusOK, gin.H{
+		"count": len(logs),
+		"logs":  logs,
+	})
+}
+
+// Config 列出所有配置项的最终值及来源（default/file/env），敏感值已脱敏
+func (h *AdminHandler) Config(c *gin.Context) {
+	sources := config.Sources()
+	response.Success(c, http.StatusOK, gin.H{
+		"count": len(sources),
+		"keys":  sources,
+	})
+}
+
+// migrateRequest 迁移请求，字段为空时使用配置中的默认值
+type migrateRequest struct {
+	Target          string `json:"target"`
+	DeadlineSeconds int    `json:"deadline_seconds"`
+}
+
+// Migrate 通知所有客户端迁移到目标实例（滚动发布时使用）
+func (h *AdminHandler) Migrate(c *gin.Context) {
+	var req migrateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Error(c, http.StatusBadRequest, "请求格式错误: "+err.Error())
+			return
+		}
+	}
+
+	if req.Target == "" {
+		req.Target = h.cfg.MigrationTargetURL
+	}
+	if req.Target == "" {
+		response.Error(c, http.StatusBadRequest, "未指定迁移目标实例")
+		return
+	}
+	if req.DeadlineSeconds <= 0 {
+		req.DeadlineSeconds = h.cfg.MigrationDeadlineSeconds
+	}
+
+	deadline := time.Duration(req.DeadlineSeconds) * time.Second
+	notified := h.wsService.Migrate(req.Target, deadline)
+
+	response.Success(c, http.StatusOK, gin.H{
+		"target":      req.Target,
+		"deadline_ms": deadline.Milliseconds(),
+		"notified":    notified,
+	})
+}
+
+// RateLimit 查看客户端当前的限流令牌状态
+func (h *AdminHandler) RateLimit(c *gin.Context) {
+	clientID := c.Param("id")
+	limiters, err := h.wsService.GetRateLimitState(clientID)
+	if err != nil {
+		h.clientError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, gin.H{
+		"client_id": clientID,
+		"limiters":  limiters,
+	})
+}
+
+// ResetRateLimit 重置客户端的限流令牌，返回重置后的状态
+func (h *AdminHandler) ResetRateLimit(c *gin.Context) {
+	clientID := c.Param("id")
+	if err := h.wsService.ResetRateLimit(clientID); err != nil {
+		h.clientError(c, err)
+		return
+	}
+	limiters, err := h.wsService.GetRateLimitState(clientID)
+	if err != nil {
+		h.clientError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, gin.H{
+		"client_id": clientID,
+		"limiters":  limiters,
+	})
+}
+
+// Kick 踢出客户端，客户端收到关闭码4001后断开
+func (h *AdminHandler) Kick(c *gin.Context) {
+	clientID := c.Param("id")
+	if err := h.wsService.KickClient(clientID); err != nil {
+		h.clientError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, gin.H{
+		"client_id": clientID,
+		"kicked":    true,
+	})
+}
+
+// clientError 将按客户端查询时的错误转换为HTTP响应
+func (h *AdminHandler) clientError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrClientNotFound) {
+		response.Error(c, http.StatusNotFound, err.Error())
+		return
+	}
+	response.Error(c, http.StatusInternalServerError, err.Error())
+}
+
+// broadcastRequest 按标签广播的请求
+type broadcastRequest struct {
+	Tag   string          `json:"tag" binding:"required"`
+	Value string          `json:"value" binding:"required"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Broadcast 向带有指定标签值的所有在线客户端推送消息（如所有mobile客户端）
+func (h *AdminHandler) Broadcast(c *gin.Context) {
+	var req broadcastRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "请求格式错误: "+err.Error())
+		return
+	}
+
+	recipients := h.wsService.BroadcastToTag(req.Tag, req.Value, req.Event, req.Data)
+	response.Success(c, http.StatusOK, gin.H{
+		"tag":        req.Tag,
+		"value":      req.Value,
+		"recipients": recipients,
+	})
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// dispatcherQueueSize 每个处理通道排队的消息数，排满时读循环阻塞（对客户端形成背压）
+const dispatcherQueueSize = 32
+
+// messageDispatcher 单个连接的有界消息处理池：同一频道的消息固定交给同一个worker，
+// 保证同一频道内按接收顺序处理，不同频道之间（以及与无频道的控制消息之间）不保证顺序
+type messageDispatcher struct {
+	clientID string
+	lanes    []chan func()
+	wg       sync.WaitGroup
+}
+
+func newMessageDispatcher(clientID string, workers int) *messageDispatcher {
+	d := &messageDispatcher{
+		clientID: clientID,
+		lanes:    make([]chan func(), workers),
+	}
+	for i := range d.lanes {
+		lane := make(chan func(), dispatcherQueueSize)
+		d.lanes[i] = lane
+		d.wg.Add(1)
+		go d.run(lane)
+	}
+	return d
+}
+
+// dispatch 按频道（忽略大小写和首尾空格）选择worker，无频道的消息共用同一个worker
+func (d *messageDispatcher) dispatch(channel string, task func()) {
+	hash := fnv.New32a()
+	hash.Write([]byte(strings.ToLower(strings.TrimSpace(channel))))
+	d.lanes[hash.Sum32()%uint32(len(d.lanes))] <- task
+}
+
+// stop 停止接收新消息，等待已排队的消息处理完
+func (d *messageDispatcher) stop() {
+	for _, lane := range d.lanes {
+		close(lane)
+	}
+	d.wg.Wait()
+}
+
+func (d *messageDispatcher) run(lane chan func()) {
+	defer d.wg.Done()
+	for task := range lane {
+		d.execute(task)
+	}
+}
+
+// execute 执行单条消息的处理，panic只影响该条消息
+func (d *messageDispatcher) execute(task func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.WithFields(logrus.Fields{
+				"client_id": d.clientID,
+				"panic":     r,
+			}).Error("消息处理发生panic")
+		}
+	}()
+	task()
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"testing"
+	"time"
+)
+
+// laneOf 返回频道在workers个处理通道中对应的下标（与dispatch的选择方式一致）
+func laneOf(channel string, workers int) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(channel))
+	return hash.Sum32() % uint32(workers)
+}
+
+func TestDispatcherSlowChannelDoesNotBlockOthers(t *testing.T) {
+	const workers = 2
+	d := newMessageDispatcher("c1", workers)
+	defer d.stop()
+
+	// 找一个与无频道的控制消息不在同一处理通道的频道
+	slowChannel := ""
+	for i := 0; slowChannel == ""; i++ {
+		if channel := fmt.Sprintf("room-%d", i); laneOf(channel, workers) != laneOf("", workers) {
+			slowChannel = channel
+		}
+	}
+
+	release := make(chan struct{})
+	d.dispatch(slowChannel, func() { <-release })
+	done := make(chan struct{})
+	d.dispatch("", func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("慢频道的消息阻塞了控制消息")
+	}
+	close(release)
+}
+
+func TestDispatcherKeepsChannelOrder(t *testing.T) {
+	d := newMessageDispatcher("c1", 4)
+	results := make(chan int, 100)
+	for i := 0; i < 100; i++ {
+		i := i
+		// 频道名大小写和首尾空格不同时仍视为同一频道
+		channel := "Lobby"
+		if i%2 == 0 {
+			channel = " lobby "
+		}
+		d.dispatch(channel, func() { results <- i })
+	}
+	d.stop()
+	close(results)
+
+	want := 0
+	for got := range results {
+		if got != want {
+			t.Fatalf("第%d条处理的是 %d，同一频道应按接收顺序处理", want, got)
+		}
+		want++
+	}
+	if want != 100 {
+		t.Fatalf("stop后处理了 %d 条, want 100", want)
+	}
+}
+
+func TestDispatcherRecoversPanic(t *testing.T) {
+	d := newMessageDispatcher("c1", 1)
+	done := make(chan struct{})
+	d.dispatch("room", func() { panic("boom") })
+	d.dispatch("room", func() { close(done) })
+	d.stop()
+
+	select {
+	case <-done:
+	default:
+		t.Fatal("panic之后的消息应继续处理")
+	}
+}
+
+func TestDispatcherBackpressure(t *testing.T) {
+	d := newMessageDispatcher("c1", 1)
+	release := make(chan struct{})
+	d.dispatch("room", func() { <-release })
+
+	// 队列排满后dispatch阻塞，而不是丢弃消息
+	queued := make(chan struct{})
+	go func() {
+		for i := 0; i < dispatcherQueueSize+1; i++ {
+			d.dispatch("room", func() {})
+		}
+		close(queued)
+	}()
+	select {
+	case <-queued:
+		t.Fatal("队列已满时dispatch应阻塞")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-queued:
+	case <-time.After(time.Second):
+		t.Fatal("队列腾出空间后dispatch应继续")
+	}
+	d.stop()
+}
@@ -1,7 +1,9 @@
 package handler
 
 import (
+	"letshare-server/internal/config"
 	"letshare-server/internal/service"
+	"letshare-server/pkg/response"
 	"net/http"
 	"runtime"
 	"time"
@@ -12,50 +14,85 @@ import (
 type HealthHandler struct {
 	wsService *service.WebSocketService
 	startTime time.Time
+	cfg       config.Health
 }
 
-func NewHealthHandler(wsService *service.WebSocketService) *HealthHandler {
+func NewHealthHandler(wsService *service.WebSocketService, cfg config.Health) *HealthHandler {
 	return &HealthHandler{
 		wsService: wsService,
 		startTime: time.Now(),
+		cfg:       cfg,
 	}
 }
 
 // Health 健康检查端点
 func (h *HealthHandler) Health(c *gin.Context) {
 	uptime := time.Since(h.startTime)
-	
+
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
-	
-	c.JSON(http.StatusOK, gin.H{
-		"status":    "healthy",
+
+	// 维护任务超过两个周期未运行，说明清理已停止
+	status := "healthy"
+	lastMaintenance, maintenanceOK := h.wsService.MaintenanceStatus()
+	if !maintenanceOK {
+		status = "degraded"
+	}
+
+	// 资源超过阈值时返回503，让负载均衡器摘除该实例
+	httpStatus := http.StatusOK
+	goroutines := runtime.NumGoroutine()
+	heapMB := bToMb(m.HeapAlloc)
+	breached := []string{}
+	if h.cfg.MaxGoroutines > 0 && goroutines > h.cfg.MaxGoroutines {
+		breached = append(breached, "goroutines")
+	}
+	if h.cfg.MaxHeapMB > 0 && heapMB > uint64(h.cfg.MaxHeapMB) {
+		breached = append(breached, "heap")
+	}
+	if len(breached) > 0 {
+		status = "degraded"
+		httpStatus = http.StatusServiceUnavailable
+	}
+
+	response.Success(c, httpStatus, gin.H{
+		"status":    status,
 		"timestamp": time.Now().Format(time.RFC3339),
 		"uptime":    uptime.String(),
+		"maintenance": gin.H{
+			"last_run": lastMaintenance.Format(time.RFC3339),
+			"healthy":  maintenanceOK,
+		},
 		"memory": gin.H{
-			"alloc_mb":      bToMb(m.Alloc),
+			"alloc_mb":       bToMb(m.Alloc),
 			"total_alloc_mb": bToMb(m.TotalAlloc),
-			"sys_mb":        bToMb(m.Sys),
-			"num_gc":        m.NumGC,
+			"sys_mb":         bToMb(m.Sys),
+			"num_gc":         m.NumGC,
+			"heap_alloc_mb":  heapMB,
+		},
+		"goroutines": goroutines,
+		"resources": gin.H{
+			"max_goroutines": h.cfg.MaxGoroutines,
+			"max_heap_mb":    h.cfg.MaxHeapMB,
+			"breached":       breached,
 		},
-		"goroutines": runtime.NumGoroutine(),
 	})
 }
 
 // Metrics 监控指标端点
 func (h *HealthHandler) Metrics(c *gin.Context) {
 	stats := h.wsService.GetStats()
-	
+
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
-	
+
 	uptime := time.Since(h.startTime)
-	
-	c.JSON(http.StatusOK, gin.H{
+
+	metrics := gin.H{
 		"server": gin.H{
-			"uptime":     uptime.String(),
+			"uptime":         uptime.String(),
 			"uptime_seconds": int64(uptime.Seconds()),
-			"timestamp":  time.Now().Format(time.RFC3339),
+			"timestamp":      time.Now().Format(time.RFC3339),
 		},
 		"websocket": stats,
 		"system": gin.H{
@@ -67,14 +104,35 @@ func (h *HealthHandler) Metrics(c *gin.Context) {
 				"heap_sys_mb":    bToMb(m.HeapSys),
 				"num_gc":         m.NumGC,
 			},
-			"goroutines":     runtime.NumGoroutine(),
-			"cpu_count":      runtime.NumCPU(),
-			"go_version":     runtime.Version(),
+			"goroutines": runtime.NumGoroutine(),
+			"cpu_count":  runtime.NumCPU(),
+			"go_version": runtime.Version(),
 		},
-	})
+	}
+
+	// 房间列表可能较大且包含房间名，只在显式请求时返回
+	if c.Query("detailed") == "true" {
+		metrics["rooms"] = h.wsService.GetRoomStats()
+	}
+
+	response.Success(c, http.StatusOK, metrics)
+}
+
+// Ready 就绪探针：初始化完成前、关闭或迁移中返回503，编排系统据此停止向该实例转发流量
+func (h *HealthHandler) Ready(c *gin.Context) {
+	if !h.wsService.Ready() {
+		response.Success(c, http.StatusServiceUnavailable, gin.H{"status": "not_ready"})
+		return
+	}
+	response.Success(c, http.StatusOK, gin.H{"status": "ready"})
+}
+
+// Load 负载查询端点，供客户端侧负载均衡选择实例
+func (h *HealthHandler) Load(c *gin.Context) {
+	response.Success(c, http.StatusOK, h.wsService.GetLoad())
 }
 
 // bToMb 转换字节到MB
 func bToMb(b uint64) uint64 {
 	return b / 1024 / 1024
-} 
\ No newline at end of file
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"letshare-server/internal/config"
+	"letshare-server/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHealthReportsMaintenance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wsService := service.NewWebSocketService(config.WebSocket{MaxRoomUsers: 10})
+	t.Cleanup(func() { wsService.Shutdown("test") })
+	h := NewHealthHandler(wsService, config.Health{})
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/health", nil)
+	h.Health(c)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, want 200", recorder.Code)
+	}
+	var body struct {
+		Data struct {
+			Status      string `json:"status"`
+			Maintenance struct {
+				LastRun string `json:"last_run"`
+				Healthy bool   `json:"healthy"`
+			} `json:"maintenance"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Data.Status != "healthy" || !body.Data.Maintenance.Healthy || body.Data.Maintenance.LastRun == "" {
+		t.Fatalf("health = %+v, want healthy且带维护任务状态", body.Data)
+	}
+}
+
+func TestLoadEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	wsService := service.NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, MaxConnections: 200})
+	t.Cleanup(func() { wsService.Shutdown("test") })
+	h := NewHealthHandler(wsService, config.Health{})
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/load", nil)
+	h.Load(c)
+
+	var body struct {
+		Data map[string]float64 `json:"data"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{"connections": 0, "max_connections": 200, "load_percent": 0}
+	if recorder.Code != http.StatusOK || len(body.Data) != len(want) {
+		t.Fatalf("status = %d, load = %v, want %v", recorder.Code, body.Data, want)
+	}
+	for key, value := range want {
+		if got, ok := body.Data[key]; !ok || got != value {
+			t.Fatalf("%s = %v, want %v", key, got, value)
+		}
+	}
+}
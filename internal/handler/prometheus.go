@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// prometheusContentType Prometheus文本格式的Content-Type
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PrometheusMetrics 以Prometheus文本格式输出监控指标（不使用统一响应结构）
+func (h *HealthHandler) PrometheusMetrics(c *gin.Context) {
+	stats := h.wsService.GetStats()
+	counters := h.wsService.GetCounters()
+
+	var b strings.Builder
+	writeMetric(&b, "letshare_active_connections", "gauge", "当前WebSocket连接数", stats["active_connections"])
+	writeMetric(&b, "letshare_total_rooms", "gauge", "当前房间数", stats["total_rooms"])
+	writeMetric(&b, "letshare_goroutines", "gauge", "当前goroutine数", runtime.NumGoroutine())
+	writeMetric(&b, "letshare_resume_sessions", "gauge", "挂起等待恢复的会话数", stats["resume_sessions"])
+	writeMetric(&b, "letshare_uptime_seconds", "gauge", "服务运行时间（秒）", int64(time.Since(h.startTime).Seconds()))
+	writeMetric(&b, "letshare_connections_total", "counter", "启动以来接受的连接数", counters.ConnectionsAccepted)
+	writeMetric(&b, "letshare_messages_published_total", "counter", "启动以来发布的消息数", counters.MessagesPublished)
+	writeMetric(&b, "letshare_messages_delivered_total", "counter", "启动以来送达的消息数（每个接收者计一次）", counters.MessagesDelivered)
+	writeMetric(&b, "letshare_errors_sent_total", "counter", "启动以来发送给客户端的错误消息数", counters.ErrorsSent)
+	writeMetric(&b, "letshare_publishes_shed_total", "counter", "启动以来因全局限流丢弃的发布消息数", counters.PublishesShed)
+	writeMetric(&b, "letshare_messages_dropped_total", "counter", "启动以来因客户端发送队列溢出丢弃的消息数", counters.MessagesDropped)
+
+	// 按原因统计的断开次数，标签按字母排序保证输出稳定
+	reasons := make([]string, 0, len(counters.Disconnects))
+	for reason := range counters.Disconnects {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	fmt.Fprintf(&b, "# HELP letshare_disconnects_total 启动以来按原因统计的断开次数\n")
+	fmt.Fprintf(&b, "# TYPE letshare_disconnects_total counter\n")
+	for _, reason := range reasons {
+		fmt.Fprintf(&b, "letshare_disconnects_total{reason=%q} %d\n", reason, counters.Disconnects[reason])
+	}
+
+	c.Data(http.StatusOK, prometheusContentType, []byte(b.String()))
+}
+
+// writeMetric 写出一个不带标签的指标
+func writeMetric(b *strings.Builder, name, metricType, help string, value interface{}) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+	fmt.Fprintf(b, "%s %v\n", name, value)
+}
@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"letshare-server/internal/model"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// negotiateSubprotocol 从Sec-WebSocket-Protocol中按客户端给出的顺序选择第一个支持的子协议；
+// 客户端未请求子协议时使用v1（兼容旧客户端），请求了但都不支持时ok为false
+func negotiateSubprotocol(r *http.Request) (protocol string, version int, ok bool) {
+	requested := websocket.Subprotocols(r)
+	if len(requested) == 0 {
+		return "", model.ProtocolV1, true
+	}
+	for _, name := range requested {
+		if version, supported := model.Subprotocols[name]; supported {
+			return name, version, true
+		}
+	}
+	return "", 0, false
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"fmt"
+	"letshare-server/internal/service"
+	"letshare-server/pkg/response"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoomHandler struct {
+	wsService *service.WebSocketService
+}
+
+func NewRoomHandler(wsService *service.WebSocketService) *RoomHandler {
+	return &RoomHandler{
+		wsService: wsService,
+	}
+}
+
+// Members 获取房间内成员的用户ID列表
+func (h *RoomHandler) Members(c *gin.Context) {
+	roomName := c.Param("name")
+
+	members, exists := h.wsService.GetRoomMembers(roomName)
+	if !exists {
+		response.Error(c, http.StatusNotFound, "房间不存在: "+roomName)
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{
+		"room":    roomName,
+		"members": members,
+	})
+}
+
+// List 列出所有房间的概要信息（按成员数从多到少），支持limit和min_members过滤
+func (h *RoomHandler) List(c *gin.Context) {
+	limit, err := nonNegativeQuery(c, "limit")
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	minMembers, err := nonNegativeQuery(c, "min_members")
+	if err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rooms := h.wsService.ListRooms()
+	total := len(rooms)
+	// 已按成员数降序排列，遇到不足min_members的房间即可截断
+	for i, room := range rooms {
+		if room["member_count"].(int) < minMembers {
+			rooms = rooms[:i]
+			break
+		}
+	}
+	if limit > 0 && len(rooms) > limit {
+		rooms = rooms[:limit]
+	}
+
+	response.Success(c, http.StatusOK, gin.H{
+		"total": total,
+		"count": len(rooms),
+		"rooms": rooms,
+	})
+}
+
+// nonNegativeQuery 解析非负整数查询参数，未提供时返回0
+func nonNegativeQuery(c *gin.Context, name string) (int, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%s必须为非负整数", name)
+	}
+	return value, nil
+}
@@ -2,9 +2,19 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"letshare-server/internal/config"
+	"letshare-server/internal/middleware"
 	"letshare-server/internal/model"
 	"letshare-server/internal/service"
+	"letshare-server/pkg/response"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +23,16 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// maxCapturedHeaderBytes 单个采集请求头写入客户端元数据的最大字节数，超出部分截断
+const maxCapturedHeaderBytes = 256
+
+const (
+	// defaultMaxMessageBytes 未配置max_message_bytes时publish数据的最大字节数
+	defaultMaxMessageBytes = 512 * 1024
+	// readLimitHeadroom 连接级读限制比max_message_bytes多出的余量（消息外层字段等），超过读限制时连接会被直接关闭
+	readLimitHeadroom = 64 * 1024
+)
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		// CORS检查在中间件中处理，这里允许所有来源
@@ -23,15 +43,223 @@ var upgrader = websocket.Upgrader{
 }
 
 type WebSocketHandler struct {
-	wsService   *service.WebSocketService
-	authService *service.AuthService
+	wsService      *service.WebSocketService
+	authService    *service.AuthService
+	jwtService     *service.JWTService
+	featureService *service.FeatureService
+	cfg            config.WebSocket
+	upgrader       websocket.Upgrader
+
+	// strictOrigin 为true时拒绝Origin主机与Host不一致且不被origins允许的升级请求
+	strictOrigin bool
+	origins      *middleware.OriginMatcher
+
+	// verboseAuthErrors 为true时token校验失败返回原因和详细信息
+	verboseAuthErrors bool
+
+	// handshakes 限制同时进行中的握手（token校验和升级）数量的信号量，为nil时不限制
+	handshakes chan struct{}
+}
+
+// handshakeQueueWait 握手数已达上限时新请求的最长排队时间，超时返回503
+const handshakeQueueWait = 500 * time.Millisecond
+
+func NewWebSocketHandler(wsService *service.WebSocketService, authService *service.AuthService, jwtService *service.JWTService, featureService *service.FeatureService, cfg config.WebSocket, security config.Security, origins *middleware.OriginMatcher) *WebSocketHandler {
+	h := &WebSocketHandler{
+		wsService:      wsService,
+		authService:    authService,
+		jwtService:     jwtService,
+		featureService: featureService,
+		cfg:            cfg,
+		upgrader:       upgrader,
+		strictOrigin:   security.StrictOriginCheck,
+		origins:        origins,
+
+		verboseAuthErrors: security.VerboseAuthErrors,
+	}
+	h.upgrader.HandshakeTimeout = h.handshakeTimeout()
+	if cfg.MaxConcurrentHandshakes > 0 {
+		h.handshakes = make(chan struct{}, cfg.MaxConcurrentHandshakes)
+	}
+	return h
+}
+
+// acquireHandshake 占用一个握手名额，达到上限时最多排队handshakeQueueWait；
+// 成功时返回释放函数（可重复调用），失败时返回nil
+func (h *WebSocketHandler) acquireHandshake() func() {
+	if h.handshakes == nil {
+		return func() {}
+	}
+
+	timer := time.NewTimer(handshakeQueueWait)
+	defer timer.Stop()
+	select {
+	case h.handshakes <- struct{}{}:
+	case <-timer.C:
+		return nil
+	}
+
+	released := false
+	return func() {
+		if !released {
+			released = true
+			<-h.handshakes
+		}
+	}
+}
+
+// tokenErrorMessage token校验失败时返回给客户端的说明和原因，未开启详细错误时只返回通用说明
+func (h *WebSocketHandler) tokenErrorMessage(err error) (string, string) {
+	if !h.verboseAuthErrors {
+		return "token验证失败", ""
+	}
+	return "token验证失败: " + err.Error(), service.TokenErrorReason(err)
+}
+
+// rejectToken 以401拒绝token校验失败的连接请求，开启详细错误时data中携带reason
+func (h *WebSocketHandler) rejectToken(c *gin.Context, err error) {
+	message, reason := h.tokenErrorMessage(err)
+	if reason == "" {
+		response.Error(c, http.StatusUnauthorized, message)
+		return
+	}
+	response.AbortWithError(c, http.StatusUnauthorized, message, gin.H{"reason": reason})
+}
+
+// rejectAdmission 连接名额已满时拒绝请求：单IP超限返回429，总数超限返回503，均带重试等待时间
+func (h *WebSocketHandler) rejectAdmission(c *gin.Context, clientIP string, err error) {
+	status := http.StatusServiceUnavailable
+	if errors.Is(err, service.ErrTooManyConnectionsIP) {
+		status = http.StatusTooManyRequests
+	}
+	logrus.WithFields(logrus.Fields{
+		"client_ip": clientIP,
+		"path":      c.Request.URL.Path,
+		"error":     err.Error(),
+	}).Warn("连接数已达上限，拒绝请求")
+	middleware.AbortRateLimited(c, status, err.Error(), h.wsService.AdmissionRetryAfter())
+}
+
+// VerifyToken 不建立连接、只校验token：token取自Authorization: Bearer请求头或token查询参数，
+// 校验结果（包括无效）以200返回，JWT额外返回其中的用户信息和过期时间。
+// 与握手使用相同的并发握手限制，并按客户端IP以publish的速率限流，避免被用来无限制地猜测token
+func (h *WebSocketHandler) VerifyToken(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		token = c.Query("token")
+	}
+	if token == "" {
+		response.Error(c, http.StatusBadRequest, "缺少认证token")
+		return
+	}
+
+	releaseHandshake := h.acquireHandshake()
+	if releaseHandshake == nil {
+		logrus.WithField("limit", cap(h.handshakes)).Warn("同时进行的握手数已达上限，拒绝token校验")
+		middleware.AbortRateLimited(c, http.StatusServiceUnavailable, "服务器繁忙，请稍后重试", handshakeQueueWait)
+		return
+	}
+	defer releaseHandshake()
+
+	// 按IP限流，不占用连接名额：校验请求不应挤占真实连接，也不受其影响
+	if allowed, retryAfter := h.wsService.AllowVerify(c.ClientIP()); !allowed {
+		middleware.AbortRateLimited(c, http.StatusTooManyRequests, "token校验过于频繁，请稍后重试", retryAfter)
+		return
+	}
+
+	claims, err := service.VerifyToken(h.authService, h.jwtService, token)
+	if err != nil {
+		message, reason := h.tokenErrorMessage(err)
+		result := gin.H{"valid": false, "message": message}
+		if reason != "" {
+			result["reason"] = reason
+		}
+		response.Success(c, http.StatusOK, result)
+		return
+	}
+
+	result := gin.H{"valid": true, "type": service.TokenAuthMethod(token)}
+	if claims != nil {
+		result["user_id"] = claims.UserID
+		result["expires_at"] = claims.ExpiresAt
+		if claims.UserType != "" {
+			result["user_type"] = claims.UserType
+		}
+		if claims.RoomID != "" {
+			result["room_id"] = claims.RoomID
+		}
+	}
+	response.Success(c, http.StatusOK, result)
+}
+
+// originAllowed 严格来源检查：没有Origin的非浏览器客户端放行，否则Origin的主机须与Host一致或在允许列表中
+func (h *WebSocketHandler) originAllowed(r *http.Request) bool {
+	if !h.strictOrigin {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if h.origins.Allowed(origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// connectionTags 连接的标签：客户端类型、应用版本以及采集到的请求头（键为小写的header名）
+func connectionTags(userType, appVersion string, headers interface{}) map[string]string {
+	tags := make(map[string]string)
+	if userType != "" {
+		tags["user_type"] = userType
+	}
+	if appVersion != "" {
+		tags["app_version"] = appVersion
+	}
+	if captured, ok := headers.(map[string]string); ok {
+		for name, value := range captured {
+			tags[strings.ToLower(name)] = value
+		}
+	}
+	return tags
 }
 
-func NewWebSocketHandler(wsService *service.WebSocketService, authService *service.AuthService) *WebSocketHandler {
-	return &WebSocketHandler{
-		wsService:   wsService,
-		authService: authService,
+// captureHeaders 按配置从升级请求中采集自定义请求头（如X-Tenant-ID），值超长时截断
+func (h *WebSocketHandler) captureHeaders(header http.Header) map[string]string {
+	if len(h.cfg.CaptureHeaders) == 0 {
+		return nil
+	}
+
+	headers := make(map[string]string, len(h.cfg.CaptureHeaders))
+	for _, name := range h.cfg.CaptureHeaders {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		if len(value) > maxCapturedHeaderBytes {
+			value = strings.ToValidUTF8(value[:maxCapturedHeaderBytes], "")
+		}
+		headers[name] = value
 	}
+	return headers
+}
+
+// maxMessageBytes publish数据（及二进制帧负载）的全局最大字节数，超出时返回413而不断开连接；
+// 房间可通过room_message_bytes收紧该上限
+func (h *WebSocketHandler) maxMessageBytes() int {
+	if h.cfg.MaxMessageBytes > 0 {
+		return h.cfg.MaxMessageBytes
+	}
+	return defaultMaxMessageBytes
+}
+
+// handshakeTimeout 连接建立超时：完成升级并发送第一条消息的时限，0表示不限制
+func (h *WebSocketHandler) handshakeTimeout() time.Duration {
+	return time.Duration(h.cfg.HandshakeTimeoutSeconds) * time.Second
 }
 
 // HandleWebSocket 处理WebSocket连接
@@ -39,22 +267,104 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	// 从查询参数获取token和用户ID
 	token := c.Query("token")
 	userIdParam := c.Query("userId") // 新增：从查询参数获取用户ID
+	userType := c.Query("userType")  // 客户端类型（desktop/mobile等），用于功能开关覆盖
+	appVersion := c.Query("appVersion")
+	overflowPolicy := c.Query("overflowPolicy")
 
+	// 来源检查最先进行，跨站页面无法借握手探测token是否有效
+	if !h.originAllowed(c.Request) {
+		logrus.WithFields(logrus.Fields{
+			"origin": c.Request.Header.Get("Origin"),
+			"host":   c.Request.Host,
+		}).Warn("WebSocket来源与Host不匹配，拒绝连接")
+		response.Error(c, http.StatusForbidden, "不允许的来源")
+		return
+	}
 	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "缺少认证token"})
+		response.Error(c, http.StatusUnauthorized, "缺少认证token")
+		return
+	}
+	if overflowPolicy != "" && !service.ValidOverflowPolicy(overflowPolicy) {
+		response.Error(c, http.StatusBadRequest, "无效的overflowPolicy: "+overflowPolicy)
+		return
+	}
+	if err := service.ValidateUserID(userIdParam); err != nil {
+		response.Error(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	protocol, protocolVersion, ok := negotiateSubprotocol(c.Request)
+	if !ok {
+		logrus.WithField("requested", c.GetHeader("Sec-WebSocket-Protocol")).Warn("不支持的WebSocket子协议，拒绝连接")
+		response.Error(c, http.StatusBadRequest, "不支持的子协议: "+c.GetHeader("Sec-WebSocket-Protocol"))
+		return
+	}
+
+	// 限制同时进行的握手数，避免连接风暴时token校验和升级占满CPU；升级完成后立即释放
+	releaseHandshake := h.acquireHandshake()
+	if releaseHandshake == nil {
+		logrus.WithField("limit", cap(h.handshakes)).Warn("同时进行的握手数已达上限，拒绝连接")
+		middleware.AbortRateLimited(c, http.StatusServiceUnavailable, "服务器繁忙，请稍后重试", handshakeQueueWait)
+		return
+	}
+	defer releaseHandshake()
+
+	// JWT和签名AuthToken携带用户信息，以其中的用户ID（及JWT中的房间）为准；否则回退到固定的AuthToken
+	allowedRoom := ""
+	authMethod := service.TokenAuthMethod(token)
+	var tokenExpiresAt int64
+	claims, err := service.VerifyToken(h.authService, h.jwtService, token)
+	if err != nil {
+		switch authMethod {
+		case service.AuthMethodJWT:
+			logrus.WithError(err).Error("JWT验证失败")
+		case service.AuthMethodSignedToken:
+			logrus.WithError(err).Error("签名AuthToken验证失败")
+		default:
+			logrus.WithError(err).Error("AuthToken验证失败")
+		}
+		h.rejectToken(c, err)
+		return
+	}
+	if claims != nil {
+		// token已证明用户身份，客户端另外声明的userId必须与之一致，防止冒充
+		if userIdParam != "" && userIdParam != claims.UserID {
+			logrus.WithField("user_id", claims.UserID).Warn("userId与token中的用户不一致，拒绝连接")
+			response.Error(c, http.StatusForbidden, service.ErrUserIDMismatch.Error())
+			return
+		}
+		userIdParam = claims.UserID
+		if claims.UserType != "" {
+			userType = claims.UserType
+		}
+		allowedRoom = claims.RoomID
+		// 签名AuthToken只在握手时校验有效期，已建立的连接不会因其过期而断开
+		if authMethod == service.AuthMethodJWT {
+			tokenExpiresAt = h.jwtService.EffectiveExpiry(claims)
+		}
+	}
+
+	// 迁移期间拒绝新连接，引导客户端连接其他实例
+	if h.wsService.Draining() {
+		response.Error(c, http.StatusServiceUnavailable, "服务器正在迁移，请连接其他实例")
 		return
 	}
 
-	// 验证AuthToken
-	if err := h.authService.ValidateAuthToken(token); err != nil {
-		logrus.WithError(err).Error("AuthToken验证失败")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "token验证失败: " + err.Error()})
+	// 升级前占用连接名额，总连接数或单IP连接数达到上限时拒绝
+	clientIP := c.ClientIP()
+	if err := h.wsService.AdmitConnection(clientIP); err != nil {
+		h.rejectAdmission(c, clientIP, err)
 		return
 	}
 
-	// 升级为WebSocket连接
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	// 升级为WebSocket连接，回显协商的子协议
+	var responseHeader http.Header
+	if protocol != "" {
+		responseHeader = http.Header{"Sec-WebSocket-Protocol": {protocol}}
+	}
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, responseHeader)
+	releaseHandshake()
 	if err != nil {
+		h.wsService.ReleaseConnection(clientIP)
 		logrus.WithError(err).Error("WebSocket升级失败")
 		return
 	}
@@ -63,21 +373,85 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	clientID := uuid.New().String()
 	// 使用传递的用户ID，如果没有则使用clientID
 	userID := userIdParam
-	if userID == "" {
+	anonymous := userID == ""
+	if anonymous {
 		userID = clientID // 回退到clientID
+		// 匿名连接恢复会话时沿用原会话的用户ID，其他成员看到的仍是同一用户
+		if resumedUserID := h.wsService.AnonymousSessionUserID(c.Query("sessionId"), c.Query("resumeToken")); resumedUserID != "" {
+			userID = resumedUserID
+		}
 	}
 
 	client := model.NewClient(clientID, userID, conn)
+	client.IP = clientIP
+	client.Admitted = true
+	client.AuthMethod = authMethod
+	client.Anonymous = anonymous
+	if traceID, spanID, ok := service.ParseTraceparent(c.GetHeader("traceparent")); ok {
+		client.TraceID = traceID
+		client.SpanID = spanID
+		client.TraceState = service.TruncateTraceState(c.GetHeader("tracestate"))
+	}
 	client.Metadata["authenticated"] = true
+	client.TokenExpiresAt.Store(tokenExpiresAt)
+	client.Metadata["origin"] = c.Request.Header.Get("Origin")
+	client.Metadata["user_type"] = userType
+	if allowedRoom != "" {
+		client.Metadata["allowed_room"] = allowedRoom
+	}
+	if headers := h.captureHeaders(c.Request.Header); len(headers) > 0 {
+		client.Metadata["headers"] = headers
+	}
+	client.Tags = connectionTags(userType, appVersion, client.Metadata["headers"])
+	client.OverflowPolicy = overflowPolicy
+	client.Protocol = protocol
+	client.ProtocolVersion = protocolVersion
+	// 开启会话恢复时，客户端未携带sessionId则由服务端分配，重连时带上即可恢复订阅
+	if h.wsService.SessionResumeEnabled() {
+		client.SessionID = c.Query("sessionId")
+		if client.SessionID == "" {
+			client.SessionID = uuid.New().String()
+		}
+		// 每次连接（包括恢复）都轮换恢复令牌，下次恢复须携带本次下发的令牌
+		if h.wsService.ResumeTokensEnabled() {
+			resumeToken, err := service.NewResumeToken()
+			if err != nil {
+				logrus.WithError(err).Error("生成恢复令牌失败")
+			}
+			client.ResumeToken = resumeToken
+		}
+	}
 
 	// 添加到服务
 	h.wsService.AddClient(client)
+	resumedRooms, bufferedMessages := h.wsService.ResumeSession(client, c.Query("resumeToken"))
 
 	logrus.WithFields(logrus.Fields{
 		"client_id": clientID,
 		"user_id":   userID,
 	}).Info("WebSocket客户端已连接")
 
+	// 连接建立后下发客户端信息和功能开关
+	connected := h.clientInfo(client)
+	connected["features"] = h.featureService.Resolve(userType)
+	if client.SessionID != "" {
+		connected["session_id"] = client.SessionID
+	}
+	if client.ResumeToken != "" {
+		connected["resume_token"] = client.ResumeToken
+	}
+	if len(resumedRooms) > 0 {
+		connected["resumed_rooms"] = resumedRooms
+	}
+	h.sendMessage(client, model.NewWebSocketMessage(model.MessageTypeConnected, "", "", connected))
+	// 补发buffered房间在断线期间的消息
+	for _, message := range bufferedMessages {
+		h.sendMessage(client, message)
+	}
+
+	// 连接结束的原因，用于断开统计
+	reason := service.DisconnectClientClose
+
 	// 使用defer确保资源清理，即使发生panic也能执行
 	defer func() {
 		// 恢复panic，防止整个服务崩溃
@@ -93,27 +467,46 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 			conn.Close()
 		}
 
-		// 从服务中移除客户端（这会清理所有相关资源）
-		h.wsService.RemoveClient(clientID)
+		// 从服务中移除客户端（这会清理所有相关资源）；已被服务端主动断开时不会重复计数
+		h.wsService.RemoveClient(clientID, reason)
 
 		logrus.WithField("client_id", clientID).Info("WebSocket连接已清理")
 	}()
 
 	// 设置连接参数
-	conn.SetReadLimit(512 * 1024) // 512KB
-	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	// 硬性读限制略高于max_message_bytes，作为最后的保护，正常超限由handlePublish返回413
+	conn.SetReadLimit(int64(h.maxMessageBytes() + readLimitHeadroom))
+	// 建立阶段：客户端必须在超时内发送第一条消息，之前的pong不会延长读超时
+	var established atomic.Bool
+	if timeout := h.handshakeTimeout(); timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	} else {
+		established.Store(true)
+		conn.SetReadDeadline(time.Now().Add(h.wsService.PongTimeout()))
+	}
 	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		if established.Load() {
+			conn.SetReadDeadline(time.Now().Add(h.wsService.PongTimeout()))
+		}
 		client.LastPing = time.Now()
 		return nil
 	})
 
 	// 启动ping定时器
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(h.wsService.PingInterval())
 	defer ticker.Stop()
 
+	// 应用层心跳（浏览器无法感知ping/pong控制帧），未配置时heartbeatC为nil，不会触发
+	var heartbeatC <-chan time.Time
+	if h.cfg.ServerHeartbeatSeconds > 0 {
+		heartbeat := time.NewTicker(time.Duration(h.cfg.ServerHeartbeatSeconds) * time.Second)
+		defer heartbeat.Stop()
+		heartbeatC = heartbeat.C
+	}
+
 	// 启动消息处理goroutine
 	done := make(chan struct{})
+	readReason := service.DisconnectReadError
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
@@ -124,7 +517,7 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 			}
 			close(done)
 		}()
-		h.handleMessages(client, conn)
+		readReason = h.handleMessages(client, conn, &established)
 	}()
 
 	// 保持连接和定期ping
@@ -132,36 +525,205 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 		select {
 		case <-done:
 			// 消息处理goroutine结束，退出主循环
+			reason = readReason
 			return
 		case <-ticker.C:
-			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			// WriteControl可与写协程并发调用
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
 				logrus.WithField("client_id", clientID).WithError(err).Error("发送ping失败")
+				reason = service.DisconnectWriteError
 				return
 			}
+		case <-heartbeatC:
+			h.sendMessage(client, model.NewWebSocketMessage(model.MessageTypeHeartbeat, "", "", nil))
 		}
 	}
 }
 
-// handleMessages 处理客户端消息
-func (h *WebSocketHandler) handleMessages(client *model.Client, conn *websocket.Conn) {
+// handleMessages 处理客户端消息，返回连接结束的原因
+func (h *WebSocketHandler) handleMessages(client *model.Client, conn *websocket.Conn, established *atomic.Bool) service.DisconnectReason {
+	// 配置了多个worker时并发处理该连接的消息（同一频道内保持顺序），否则在读循环中串行处理
+	var dispatcher *messageDispatcher
+	if h.cfg.MessageWorkers > 1 {
+		dispatcher = newMessageDispatcher(client.ID, h.cfg.MessageWorkers)
+		defer dispatcher.stop()
+	}
+
 	for {
-		var message model.WebSocketMessage
-		if err := conn.ReadJSON(&message); err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+		messageType, reader, err := conn.NextReader()
+		if err != nil {
+			if !established.Load() {
+				logrus.WithField("client_id", client.ID).WithError(err).Warn("连接建立超时，未收到第一条消息")
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				logrus.WithField("client_id", client.ID).WithError(err).Error("WebSocket连接异常关闭")
 			}
-			break
+			// 客户端发送了关闭帧视为正常关闭，其余（超时、连接中断等）视为读错误；
+			// 1006是连接未经关闭帧直接断开时库合成的关闭码，不代表客户端主动关闭
+			if closeErr, ok := err.(*websocket.CloseError); ok && closeErr.Code != websocket.CloseAbnormalClosure {
+				return service.DisconnectClientClose
+			}
+			h.closeForReadError(client, conn, err, established.Load())
+			return service.DisconnectReadError
+		}
+
+		// 收到第一条消息，连接建立完成，恢复常规读超时
+		if !established.Load() {
+			established.Store(true)
+			conn.SetReadDeadline(time.Now().Add(h.wsService.PongTimeout()))
 		}
 
 		// 更新最后活跃时间
 		client.LastPing = time.Now()
 
+		// 二进制帧：帧头携带频道和事件的原始信令负载
+		if messageType == websocket.BinaryMessage {
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				logrus.WithField("client_id", client.ID).WithError(err).Debug("读取二进制帧失败")
+				h.closeForReadError(client, conn, err, true)
+				return service.DisconnectReadError
+			}
+			if dispatcher != nil {
+				// 帧头无效时频道为空，由handleBinary返回错误
+				frame, _ := model.DecodeBinaryFrame(data)
+				dispatcher.dispatch(frame.Channel, func() { h.handleBinary(client, data) })
+			} else {
+				h.handleBinary(client, data)
+			}
+			continue
+		}
+
+		var message model.WebSocketMessage
+		counter := &countingReader{reader: reader}
+		decoder := json.NewDecoder(counter)
+		if h.cfg.StrictDecoding {
+			decoder.DisallowUnknownFields()
+		}
+		if err := decoder.Decode(&message); err != nil {
+			// 严格模式下的未知字段只拒绝该条消息，其它解析错误仍断开连接
+			if h.cfg.StrictDecoding && isUnknownFieldError(err) {
+				h.sendError(client, nil, 400, "消息包含未知字段: "+strings.TrimPrefix(err.Error(), "json: unknown field "))
+				continue
+			}
+			logrus.WithField("client_id", client.ID).WithError(err).Debug("消息解析失败")
+			h.closeForReadError(client, conn, err, true)
+			return service.DisconnectReadError
+		}
+
+		// 按消息类型校验大小（连接级的读限制只能统一设置上限）
+		if limit, ok := h.cfg.MessageSizeLimits[message.Type]; ok && limit > 0 && counter.n > int64(limit) {
+			h.sendError(client, &message, 413, fmt.Sprintf("%s消息过大: %d字节，最多%d字节", message.Type, counter.n, limit))
+			h.closeOnProtocolError(client, service.DisconnectMessageTooBig)
+			continue
+		}
+
 		// 处理不同类型的消息
-		h.processMessage(client, &message)
+		if dispatcher != nil {
+			dispatcher.dispatch(message.Channel, func() { h.processMessage(client, &message) })
+		} else {
+			h.processMessage(client, &message)
+		}
+	}
+}
+
+// readErrorCloseFrame 读取或解析失败时告知客户端的关闭码和说明；连接已中断等无需说明的情况ok为false
+func readErrorCloseFrame(err error, established bool) (code int, text string, ok bool) {
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, websocket.ErrReadLimit):
+		return websocket.CloseMessageTooBig, "message too big", true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		// 建立阶段未在超时内发送第一条消息，或之后超时未响应ping
+		if !established {
+			return websocket.ClosePolicyViolation, "handshake timeout", true
+		}
+		return service.CloseInactiveTimeout, "pong timeout", true
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return websocket.CloseInvalidFramePayloadData, "invalid json", true
+	}
+	return 0, "", false
+}
+
+// closeForReadError 因读取或解析失败断开前发送带关闭码的关闭帧，让客户端知道断开原因
+func (h *WebSocketHandler) closeForReadError(client *model.Client, conn *websocket.Conn, err error, established bool) {
+	code, text, ok := readErrorCloseFrame(err, established)
+	if !ok {
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"client_id": client.ID,
+		"code":      code,
+		"reason":    text,
+	}).Info("读取失败，发送关闭帧后断开")
+	message := websocket.FormatCloseMessage(code, text)
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second)); err != nil {
+		logrus.WithError(err).Debug("发送关闭帧失败")
+	}
+}
+
+// closeOnProtocolError 开启close_on_protocol_errors时，在回复错误后以原因对应的关闭码断开违反协议的连接
+func (h *WebSocketHandler) closeOnProtocolError(client *model.Client, reason service.DisconnectReason) {
+	if !h.cfg.CloseOnProtocolErrors {
+		return
 	}
+	h.wsService.DisconnectClient(client.ID, reason)
 }
 
-// processMessage 处理具体消息
+// handleBinary 处理二进制帧，转发到帧头指定的房间
+func (h *WebSocketHandler) handleBinary(client *model.Client, data []byte) {
+	frame, err := model.DecodeBinaryFrame(data)
+	if err != nil {
+		h.sendError(client, nil, 400, err.Error())
+		return
+	}
+	if frame.Channel == "" {
+		h.sendError(client, nil, 400, "缺少频道名称")
+		h.closeOnProtocolError(client, service.DisconnectMissingChannel)
+		return
+	}
+	if limit := h.wsService.RoomMessageLimit(frame.Channel, h.maxMessageBytes()); len(frame.Payload) > limit {
+		h.sendError(client, nil, 413, fmt.Sprintf("消息数据过大，最多%d字节", limit))
+		h.closeOnProtocolError(client, service.DisconnectMessageTooBig)
+		return
+	}
+
+	if h.rejectExpiredToken(client, nil) {
+		return
+	}
+	if !h.allowPublish(client, nil) {
+		return
+	}
+
+	event := frame.Event
+	if event == "" {
+		event = "signal:all"
+	}
+
+	if _, err := h.wsService.PublishBinaryToRoom(client.ID, frame.Channel, event, frame.Payload); err != nil {
+		h.sendError(client, nil, publishErrorCode(err), err.Error())
+	}
+}
+
+// countingReader 统计已读取的字节数
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// isUnknownFieldError 判断是否为DisallowUnknownFields产生的未知字段错误
+func isUnknownFieldError(err error) bool {
+	return strings.HasPrefix(err.Error(), "json: unknown field ")
+}
+
+// processMessage 处理具体消息，按连接协商的消息格式版本分派
 func (h *WebSocketHandler) processMessage(client *model.Client, message *model.WebSocketMessage) {
 	logrus.WithFields(logrus.Fields{
 		"client_id": client.ID,
@@ -170,6 +732,25 @@ func (h *WebSocketHandler) processMessage(client *model.Client, message *model.W
 		"event":     message.Event,
 	}).Debug("收到客户端消息")
 
+	// 新版本的消息格式在这里增加分支，v1客户端不受影响
+	switch client.ProtocolVersion {
+	case model.ProtocolV1:
+		h.processMessageV1(client, message)
+	default:
+		h.sendError(client, message, 400, fmt.Sprintf("不支持的协议版本: %d", client.ProtocolVersion))
+	}
+}
+
+// processMessageV1 按v1消息格式处理消息
+func (h *WebSocketHandler) processMessageV1(client *model.Client, message *model.WebSocketMessage) {
+	// token过期处于宽限期的连接只读：仍可接收消息、refresh、unsubscribe和disconnect
+	switch message.Type {
+	case model.MessageTypeSubscribe, model.MessageTypePublish, model.MessageTypeChat:
+		if h.rejectExpiredToken(client, message) {
+			return
+		}
+	}
+
 	switch message.Type {
 	case model.MessageTypeSubscribe:
 		h.handleSubscribe(client, message)
@@ -177,35 +758,98 @@ func (h *WebSocketHandler) processMessage(client *model.Client, message *model.W
 		h.handleUnsubscribe(client, message)
 	case model.MessageTypePublish:
 		h.handlePublish(client, message)
+	case model.MessageTypeListRooms:
+		h.handleListRooms(client, message)
+	case model.MessageTypeChat:
+		h.handleChat(client, message)
+	case model.MessageTypeRefresh:
+		h.handleRefresh(client, message)
+	case model.MessageTypeWhoami:
+		h.handleWhoami(client, message)
+	case model.MessageTypePresenceSync:
+		h.handlePresenceResync(client, message)
+	case model.MessageTypeDisconnect:
+		// 有序断开：退出所有房间（通知其他成员）并以1000关闭连接，随后读循环因连接关闭而结束
+		h.wsService.DisconnectClient(client.ID, service.DisconnectClientClose)
 	default:
-		h.sendError(client, 400, "不支持的消息类型: "+message.Type)
+		h.sendError(client, message, 400, "不支持的消息类型: "+message.Type)
+		h.closeOnProtocolError(client, service.DisconnectUnsupportedType)
 	}
 }
 
 // handleSubscribe 处理订阅消息
 func (h *WebSocketHandler) handleSubscribe(client *model.Client, message *model.WebSocketMessage) {
+	// 批量订阅：channels中的每个房间使用相同的事件
+	if len(message.Channels) > 0 {
+		if h.cfg.MaxSubscribeBatch > 0 && len(message.Channels) > h.cfg.MaxSubscribeBatch {
+			h.sendError(client, message, 400, fmt.Sprintf("批量订阅的房间数过多，最多%d个", h.cfg.MaxSubscribeBatch))
+			return
+		}
+		for _, channel := range message.Channels {
+			h.subscribe(client, message, channel)
+		}
+		return
+	}
+
 	if message.Channel == "" {
-		h.sendError(client, 400, "缺少频道名称")
+		h.sendError(client, message, 400, "缺少频道名称")
+		h.closeOnProtocolError(client, service.DisconnectMissingChannel)
 		return
 	}
 
+	h.subscribe(client, message, message.Channel)
+}
+
+// subscribe 订阅单个房间并回复确认或错误（错误消息带上频道，便于批量订阅时区分）
+func (h *WebSocketHandler) subscribe(client *model.Client, message *model.WebSocketMessage, channel string) {
 	// 如果没有指定事件，则只订阅房间
 	event := message.Event
 
-	if err := h.wsService.SubscribeToRoom(client.ID, message.Channel, event); err != nil {
-		h.sendError(client, 400, err.Error())
+	maxUsers, err := h.wsService.SubscribeToRoom(client.ID, channel, event, message.History)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"client_id": client.ID,
+			"room":      channel,
+			"error":     err.Error(),
+		}).Warn("订阅房间失败")
+
+		code := 400
+		if errors.Is(err, service.ErrRoomNotAllowed) {
+			code = 403
+		}
+		errorMsg := model.NewErrorMessage(code, err.Error())
+		errorMsg.ID = message.ID
+		errorMsg.Channel = channel
+		var nameErr *service.RoomNameError
+		if errors.As(err, &nameErr) {
+			errorMsg.Error.Reason = nameErr.Code
+		}
+		// 开启了备选房间建议时返回结构化的room_full错误，客户端可据此自动加入溢出房间
+		var fullErr *service.RoomFullError
+		if errors.As(err, &fullErr) && fullErr.Suggestions != nil {
+			errorMsg.Error.Reason = "room_full"
+			if data, err := json.Marshal(map[string]interface{}{
+				"room":        fullErr.Room,
+				"max_users":   fullErr.MaxUsers,
+				"suggestions": fullErr.Suggestions,
+			}); err == nil {
+				errorMsg.Data = data
+			}
+		}
+		h.sendMessage(client, errorMsg)
 		return
 	}
 
 	// 发送订阅确认
 	h.sendMessage(client, model.NewWebSocketMessage(
 		"subscribed",
-		message.Channel,
+		channel,
 		event,
 		map[string]interface{}{
-			"status": "subscribed",
-			"room":   message.Channel,
-			"event":  event,
+			"status":    "subscribed",
+			"room":      channel,
+			"event":     event,
+			"max_users": maxUsers,
 		},
 	))
 }
@@ -213,7 +857,8 @@ func (h *WebSocketHandler) handleSubscribe(client *model.Client, message *model.
 // handleUnsubscribe 处理取消订阅消息
 func (h *WebSocketHandler) handleUnsubscribe(client *model.Client, message *model.WebSocketMessage) {
 	if message.Channel == "" {
-		h.sendError(client, 400, "缺少频道名称")
+		h.sendError(client, message, 400, "缺少频道名称")
+		h.closeOnProtocolError(client, service.DisconnectMissingChannel)
 		return
 	}
 
@@ -223,7 +868,7 @@ func (h *WebSocketHandler) handleUnsubscribe(client *model.Client, message *mode
 	}
 
 	if err := h.wsService.UnsubscribeFromRoom(client.ID, message.Channel, event); err != nil {
-		h.sendError(client, 400, err.Error())
+		h.sendError(client, message, 400, err.Error())
 		return
 	}
 
@@ -242,7 +887,18 @@ func (h *WebSocketHandler) handleUnsubscribe(client *model.Client, message *mode
 // handlePublish 处理发布消息
 func (h *WebSocketHandler) handlePublish(client *model.Client, message *model.WebSocketMessage) {
 	if message.Channel == "" {
-		h.sendError(client, 400, "缺少频道名称")
+		h.sendError(client, message, 400, "缺少频道名称")
+		h.closeOnProtocolError(client, service.DisconnectMissingChannel)
+		return
+	}
+	if limit := h.wsService.RoomMessageLimit(message.Channel, h.maxMessageBytes()); len(message.Data) > limit {
+		h.sendPublishFailure(client, message, 413, fmt.Sprintf("消息数据过大，最多%d字节", limit))
+		h.closeOnProtocolError(client, service.DisconnectMessageTooBig)
+		return
+	}
+
+	// 超出发布速率的消息直接丢弃
+	if !h.allowPublish(client, message) {
 		return
 	}
 
@@ -253,14 +909,14 @@ func (h *WebSocketHandler) handlePublish(client *model.Client, message *model.We
 
 	// 验证消息数据
 	if message.Data == nil {
-		h.sendError(client, 400, "缺少消息数据")
+		h.sendError(client, message, 400, "缺少消息数据")
 		return
 	}
 
 	// 验证数据格式
 	var data map[string]interface{}
 	if err := json.Unmarshal(message.Data, &data); err != nil {
-		h.sendError(client, 400, "消息数据格式错误")
+		h.sendError(client, message, 400, "消息数据格式错误")
 		return
 	}
 
@@ -272,29 +928,238 @@ func (h *WebSocketHandler) handlePublish(client *model.Client, message *model.We
 		}
 	}
 
-	if err := h.wsService.PublishToRoom(client.ID, message.Channel, event, message.Data); err != nil {
-		h.sendError(client, 400, err.Error())
+	// 指定了目标用户时只发送给该用户，否则广播到房间
+	if message.To != "" {
+		recipients, err := h.wsService.PublishToUser(client.ID, message.Channel, event, message.To, message.Data)
+		if err != nil {
+			code := publishErrorCode(err)
+			if errors.Is(err, service.ErrTargetNotInRoom) {
+				code = 404
+			}
+			h.sendPublishFailure(client, message, code, err.Error())
+			return
+		}
+		h.sendAck(client, message, recipients)
+		return
+	}
+
+	recipients, err := h.wsService.PublishToRoom(client.ID, message.Channel, event, message.Data)
+	if err != nil {
+		h.sendPublishFailure(client, message, publishErrorCode(err), err.Error())
 		return
 	}
+	h.sendAck(client, message, recipients)
 }
 
-// sendMessage 发送消息给客户端
-func (h *WebSocketHandler) sendMessage(client *model.Client, message *model.WebSocketMessage) {
-	conn, ok := client.Connection.(*websocket.Conn)
-	if !ok {
+// handleChat 处理文本聊天消息：data.text转发给房间内所有其他成员，与publish共用限流
+func (h *WebSocketHandler) handleChat(client *model.Client, message *model.WebSocketMessage) {
+	if message.Channel == "" {
+		h.sendError(client, message, 400, "缺少频道名称")
+		h.closeOnProtocolError(client, service.DisconnectMissingChannel)
 		return
 	}
 
-	if err := conn.WriteJSON(message); err != nil {
-		logrus.WithFields(logrus.Fields{
-			"client_id": client.ID,
-			"error":     err.Error(),
-		}).Error("发送消息失败")
+	if !h.allowPublish(client, message) {
+		return
+	}
+
+	var data struct {
+		Text string `json:"text"`
 	}
+	if err := json.Unmarshal(message.Data, &data); err != nil {
+		h.sendError(client, message, 400, "消息数据格式错误")
+		return
+	}
+
+	recipients, err := h.wsService.SendChat(client.ID, message.Channel, data.Text)
+	if err != nil {
+		h.sendPublishFailure(client, message, publishErrorCode(err), err.Error())
+		return
+	}
+	h.sendAck(client, message, recipients)
+}
+
+// allowPublish 检查发布速率，被限流时回复429错误并返回false；全局限流时reason为server_busy
+func (h *WebSocketHandler) allowPublish(client *model.Client, request *model.WebSocketMessage) bool {
+	retryAfter, err := h.wsService.AllowPublish(client)
+	if err == nil {
+		return true
+	}
+
+	var errorMsg *model.WebSocketMessage
+	if errors.Is(err, service.ErrServerBusy) {
+		errorMsg = model.NewRateLimitMessage("服务器繁忙，请稍后重试", retryAfter)
+		errorMsg.Error.Reason = "server_busy"
+	} else {
+		errorMsg = model.NewRateLimitMessage("发布消息过于频繁，请稍后重试", retryAfter)
+	}
+	if request != nil {
+		errorMsg.ID = request.ID
+	}
+	h.sendMessage(client, errorMsg)
+	return false
+}
+
+// publishErrorCode 发布失败的错误码：房间被并发删除时返回409，客户端重新订阅后可重试
+func publishErrorCode(err error) int {
+	if errors.Is(err, service.ErrRoomGone) {
+		return 409
+	}
+	return 400
+}
+
+// sendAck 消息携带id时，向发送者确认消息已分发及接收者数量
+func (h *WebSocketHandler) sendAck(client *model.Client, request *model.WebSocketMessage, recipients int) {
+	if request.ID == "" {
+		return
+	}
+
+	ack := model.NewWebSocketMessage(model.MessageTypeAck, request.Channel, request.Event, map[string]interface{}{
+		"recipients": recipients,
+	})
+	ack.ID = request.ID
+	h.sendMessage(client, ack)
 }
 
-// sendError 发送错误消息
-func (h *WebSocketHandler) sendError(client *model.Client, code int, message string) {
+// sendPublishFailure 发布失败时回复错误：携带id的消息以ack形式返回错误，否则返回普通错误消息
+func (h *WebSocketHandler) sendPublishFailure(client *model.Client, request *model.WebSocketMessage, code int, message string) {
+	if request.ID == "" {
+		h.sendError(client, request, code, message)
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"client_id": client.ID,
+		"code":      code,
+		"message":   message,
+	}).Warn("消息发布失败")
+
+	ack := model.NewWebSocketMessage(model.MessageTypeAck, request.Channel, request.Event, nil)
+	ack.ID = request.ID
+	ack.Error = &model.ErrorInfo{Code: code, Message: message}
+	h.sendMessage(client, ack)
+}
+
+// handleRefresh 在连接内换用新的JWT以延长会话：新token须属于同一用户且房间限制不变，校验失败时不做任何修改
+func (h *WebSocketHandler) handleRefresh(client *model.Client, message *model.WebSocketMessage) {
+	var data struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(message.Data, &data); err != nil || data.Token == "" {
+		h.sendError(client, message, 400, "缺少token")
+		return
+	}
+	// 只有以JWT建立的连接可以刷新：固定AuthToken连接的userId是自行声明的，不能借刷新获得JWT身份
+	if client.AuthMethod != service.AuthMethodJWT {
+		h.sendError(client, message, 403, "当前连接未使用JWT认证，无法刷新token")
+		return
+	}
+
+	claims, err := h.jwtService.ValidateToken(data.Token)
+	if err != nil {
+		errorMessage, reason := h.tokenErrorMessage(err)
+		errorMsg := model.NewErrorMessage(401, errorMessage)
+		errorMsg.ID = message.ID
+		errorMsg.Error.Reason = reason
+		h.sendMessage(client, errorMsg)
+		return
+	}
+	if claims.UserID != client.UserID {
+		h.sendError(client, message, 403, "token不属于当前用户")
+		return
+	}
+	if claims.RoomID != h.wsService.AllowedRoom(client) {
+		h.sendError(client, message, 403, "token的房间限制与当前连接不一致")
+		return
+	}
+
+	client.TokenExpiresAt.Store(h.jwtService.EffectiveExpiry(claims))
+	logrus.WithFields(logrus.Fields{
+		"client_id":  client.ID,
+		"user_id":    client.UserID,
+		"expires_at": claims.ExpiresAt,
+	}).Info("客户端token已刷新")
+
+	refreshed := model.NewWebSocketMessage(model.MessageTypeRefreshed, "", "", map[string]interface{}{
+		"expires_at": claims.ExpiresAt,
+	})
+	refreshed.ID = message.ID
+	h.sendMessage(client, refreshed)
+}
+
+// rejectExpiredToken token已过期（宽限期内的只读连接）时返回401错误并返回true
+func (h *WebSocketHandler) rejectExpiredToken(client *model.Client, request *model.WebSocketMessage) bool {
+	if !h.wsService.TokenExpired(client) {
+		return false
+	}
+	errorMsg := model.NewErrorMessage(401, "token已过期，连接为只读，请刷新token")
+	if request != nil {
+		errorMsg.ID = request.ID
+	}
+	errorMsg.Error.Reason = "token_expired"
+	h.sendMessage(client, errorMsg)
+	return true
+}
+
+// clientInfo 连接的身份和协商结果：服务端分配的client_id（服务端日志以它为键）、用户ID、服务器时间和生效的限制
+func (h *WebSocketHandler) clientInfo(client *model.Client) map[string]interface{} {
+	return map[string]interface{}{
+		"client_id":        client.ID,
+		"user_id":          client.UserID,
+		"server_time":      time.Now().UnixMilli(),
+		"protocol_version": client.ProtocolVersion,
+		"limits": map[string]interface{}{
+			"max_rooms_per_client":    h.cfg.MaxRoomsPerClient,
+			"max_message_bytes":       h.maxMessageBytes(),
+			"publish_rate_per_second": h.cfg.PublishRatePerSecond,
+		},
+	}
+}
+
+// handleWhoami 返回与connected相同的连接身份信息，便于客户端随时与服务端日志对应
+func (h *WebSocketHandler) handleWhoami(client *model.Client, message *model.WebSocketMessage) {
+	identity := model.NewWebSocketMessage(model.MessageTypeIdentity, "", "", h.clientInfo(client))
+	identity.ID = message.ID
+	h.sendMessage(client, identity)
+}
+
+// handlePresenceResync 返回客户端所在房间（或channel指定的房间）当前的完整成员列表，供客户端修正本地的成员视图
+func (h *WebSocketHandler) handlePresenceResync(client *model.Client, message *model.WebSocketMessage) {
+	presence, err := h.wsService.GetPresence(client.ID, message.Channel)
+	if err != nil {
+		h.sendError(client, message, 400, err.Error())
+		return
+	}
+
+	reply := model.NewWebSocketMessage(model.MessageTypePresenceList, message.Channel, "", presence)
+	reply.ID = message.ID
+	h.sendMessage(client, reply)
+}
+
+// handleListRooms 返回客户端已订阅的房间及每个房间内订阅的事件
+func (h *WebSocketHandler) handleListRooms(client *model.Client, message *model.WebSocketMessage) {
+	subscriptions, err := h.wsService.GetClientSubscriptions(client.ID)
+	if err != nil {
+		h.sendError(client, message, 400, err.Error())
+		return
+	}
+
+	h.sendMessage(client, model.NewWebSocketMessage(
+		model.MessageTypeRooms,
+		"",
+		"",
+		subscriptions,
+	))
+}
+
+// sendMessage 发送消息给客户端
+func (h *WebSocketHandler) sendMessage(client *model.Client, message *model.WebSocketMessage) {
+	// 统一经由发送队列写出，避免与写协程并发写连接
+	h.wsService.SendToClient(client, message)
+}
+
+// sendError 发送错误消息，request不为空时回显其消息ID便于客户端关联
+func (h *WebSocketHandler) sendError(client *model.Client, request *model.WebSocketMessage, code int, message string) {
 	logrus.WithFields(logrus.Fields{
 		"client_id": client.ID,
 		"code":      code,
@@ -302,5 +1167,8 @@ func (h *WebSocketHandler) sendError(client *model.Client, code int, message str
 	}).Warn("发送错误消息")
 
 	errorMsg := model.NewErrorMessage(code, message)
+	if request != nil {
+		errorMsg.ID = request.ID
+	}
 	h.sendMessage(client, errorMsg)
 }
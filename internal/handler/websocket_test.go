@@ -0,0 +1,1030 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"letshare-server/internal/config"
+	"letshare-server/internal/middleware"
+	"letshare-server/internal/model"
+	"letshare-server/internal/service"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const testJWTSecret = "test-jwt-secret"
+
+// testServer 运行WebSocket处理器的测试服务器
+type testServer struct {
+	*httptest.Server
+	wsService  *service.WebSocketService
+	jwtService *service.JWTService
+	authToken  string
+}
+
+// newTestServer 以给定配置启动只挂载/ws和/auth/verify的测试服务器
+func newTestServer(t *testing.T, cfg config.WebSocket) *testServer {
+	t.Helper()
+	return newSecureTestServer(t, cfg, config.Security{})
+}
+
+// newSecureTestServer 与newTestServer相同，另外指定安全配置
+func newSecureTestServer(t *testing.T, cfg config.WebSocket, security config.Security) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	if cfg.MaxRoomUsers == 0 {
+		cfg.MaxRoomUsers = 10
+	}
+
+	wsService := service.NewWebSocketService(cfg)
+	authService := service.NewAuthService(config.Auth{AllowStaticToken: true})
+	jwtService := service.NewJWTService(testJWTSecret, 1, 0)
+	h := NewWebSocketHandler(wsService, authService, jwtService, service.NewFeatureService(config.Features{}), cfg, security, middleware.NewOriginMatcher(nil, nil, nil))
+
+	r := gin.New()
+	r.GET("/ws", h.HandleWebSocket)
+	r.GET("/auth/verify", h.VerifyToken)
+	server := httptest.NewServer(r)
+	t.Cleanup(func() {
+		wsService.Shutdown("test")
+		server.Close()
+	})
+
+	authToken, _ := authService.GenerateAuthToken()
+	return &testServer{Server: server, wsService: wsService, jwtService: jwtService, authToken: authToken}
+}
+
+// dial 以查询参数连接/ws，返回连接和握手响应
+func (s *testServer) dial(query url.Values) (*websocket.Conn, *http.Response, error) {
+	if query.Get("token") == "" {
+		query.Set("token", s.authToken)
+	}
+	return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/ws?"+query.Encode(), nil)
+}
+
+// connect 建立连接并读取connected消息中的数据
+func (s *testServer) connect(t *testing.T, query url.Values) (*websocket.Conn, map[string]interface{}) {
+	t.Helper()
+	conn, _, err := s.dial(query)
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	message := readMessage(t, conn)
+	if message.Type != model.MessageTypeConnected {
+		t.Fatalf("第一条消息类型 = %s, want connected", message.Type)
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(message.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	return conn, data
+}
+
+// readMessage 读取一条JSON消息
+func readMessage(t *testing.T, conn *websocket.Conn) *model.WebSocketMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message model.WebSocketMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("读取消息失败: %v", err)
+	}
+	return &message
+}
+
+// readCloseCode 读取直到连接关闭，返回关闭帧中的关闭码和说明；
+// 不回复关闭帧，服务端可能已关闭连接，回复失败会掩盖收到的关闭码
+func readCloseCode(t *testing.T, conn *websocket.Conn) (int, string) {
+	t.Helper()
+	conn.SetCloseHandler(func(int, string) error { return nil })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("连接未以关闭帧断开: %v", err)
+			}
+			return closeErr.Code, closeErr.Text
+		}
+	}
+}
+
+func TestHandleWebSocketUserID(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{})
+	aliceJWT, err := s.jwtService.GenerateToken("alice", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceSigned, err := service.NewAuthService(config.Auth{}).GenerateSignedToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		userID     string
+		wantStatus int
+	}{
+		{"AuthToken合法userId", "", "bob", http.StatusSwitchingProtocols},
+		{"AuthToken非法字符", "", "bob smith", http.StatusBadRequest},
+		{"AuthToken超长", "", strings.Repeat("b", 65), http.StatusBadRequest},
+		{"JWT省略userId", aliceJWT, "", http.StatusSwitchingProtocols},
+		{"JWT一致的userId", aliceJWT, "alice", http.StatusSwitchingProtocols},
+		{"JWT不一致的userId", aliceJWT, "mallory", http.StatusForbidden},
+		{"签名AuthToken省略userId", aliceSigned, "", http.StatusSwitchingProtocols},
+		{"签名AuthToken不一致的userId", aliceSigned, "mallory", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"userId": {tt.userID}}
+			if tt.token != "" {
+				query.Set("token", tt.token)
+			}
+			conn, resp, err := s.dial(query)
+			if conn != nil {
+				conn.Close()
+			}
+			if resp == nil {
+				t.Fatalf("没有握手响应: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("状态码 = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestResumeTokenReconnect(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{SessionResumeSeconds: 30, ResumeTokens: true})
+
+	conn, connected := s.connect(t, url.Values{"userId": {"alice"}})
+	sessionID, _ := connected["session_id"].(string)
+	resumeToken, _ := connected["resume_token"].(string)
+	if sessionID == "" || len(resumeToken) != 64 {
+		t.Fatalf("connected应包含session_id和64位恢复令牌: %v", connected)
+	}
+	if err := conn.WriteJSON(model.WebSocketMessage{Type: model.MessageTypeSubscribe, Channel: "lobby"}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readMessage(t, conn); message.Type != model.MessageTypeSubscribed {
+		t.Fatalf("订阅回复类型 = %s", message.Type)
+	}
+
+	// 不发送关闭帧直接断开，模拟网络中断，会话应被挂起
+	conn.UnderlyingConn().Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.wsService.ResumeSessionCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("会话未被挂起")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 错误的令牌不能恢复，且该连接分配新的sessionId
+	_, rejected := s.connect(t, url.Values{"userId": {"alice"}, "sessionId": {sessionID}, "resumeToken": {strings.Repeat("0", 64)}})
+	if rejected["resumed_rooms"] != nil || rejected["session_id"] == sessionID {
+		t.Fatalf("错误令牌不应恢复会话: %v", rejected)
+	}
+
+	_, resumed := s.connect(t, url.Values{"userId": {"alice"}, "sessionId": {sessionID}, "resumeToken": {resumeToken}})
+	rooms, _ := resumed["resumed_rooms"].([]interface{})
+	if len(rooms) != 1 || rooms[0] != "lobby" {
+		t.Fatalf("resumed_rooms = %v, want [lobby]", resumed["resumed_rooms"])
+	}
+	if rotated, _ := resumed["resume_token"].(string); rotated == "" || rotated == resumeToken {
+		t.Fatalf("恢复后应轮换恢复令牌: %q", rotated)
+	}
+}
+
+// waitSuspended 等待挂起会话数达到n
+func waitSuspended(t *testing.T, s *testServer, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.wsService.ResumeSessionCount() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("挂起会话数未达到%d", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAnonymousSessionResume(t *testing.T) {
+	tests := []struct {
+		name         string
+		resumeTokens bool
+	}{
+		{"凭sessionId恢复", false},
+		{"凭恢复令牌恢复", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, config.WebSocket{SessionResumeSeconds: 30, ResumeTokens: tt.resumeTokens})
+
+			// 未声明userId的匿名连接，用户ID由服务端分配
+			conn, connected := s.connect(t, url.Values{})
+			userID, _ := connected["user_id"].(string)
+			sessionID, _ := connected["session_id"].(string)
+			resumeToken, _ := connected["resume_token"].(string)
+			subscribe(t, conn, "lobby", "")
+			conn.UnderlyingConn().Close()
+			waitSuspended(t, s, 1)
+
+			// 声明了userId的连接不能恢复匿名会话
+			_, claimed := s.connect(t, url.Values{"userId": {userID}, "sessionId": {sessionID}, "resumeToken": {resumeToken}})
+			if claimed["resumed_rooms"] != nil {
+				t.Fatalf("声明userId的连接不应恢复匿名会话: %v", claimed)
+			}
+			if tt.resumeTokens {
+				_, rejected := s.connect(t, url.Values{"sessionId": {sessionID}, "resumeToken": {strings.Repeat("0", 64)}})
+				if rejected["resumed_rooms"] != nil || rejected["user_id"] == userID {
+					t.Fatalf("错误令牌不应恢复会话: %v", rejected)
+				}
+			}
+
+			_, resumed := s.connect(t, url.Values{"sessionId": {sessionID}, "resumeToken": {resumeToken}})
+			rooms, _ := resumed["resumed_rooms"].([]interface{})
+			if len(rooms) != 1 || rooms[0] != "lobby" {
+				t.Fatalf("resumed_rooms = %v, want [lobby]", resumed["resumed_rooms"])
+			}
+			// 沿用原会话的用户ID，其他成员看到的仍是同一用户
+			if resumed["user_id"] != userID {
+				t.Fatalf("user_id = %v, want %s", resumed["user_id"], userID)
+			}
+		})
+	}
+}
+
+func TestDisconnectCloseCodes(t *testing.T) {
+	tests := []struct {
+		reason   service.DisconnectReason
+		wantCode int
+	}{
+		{service.DisconnectInactive, service.CloseInactiveTimeout},
+		{service.DisconnectKicked, service.CloseKicked},
+		{service.DisconnectTokenExpired, service.CloseTokenExpired},
+		{service.DisconnectSubscribeTimeout, service.CloseSubscribeTimeout},
+		{service.DisconnectDisplaced, service.CloseDisplaced},
+		{service.DisconnectMigrated, websocket.CloseServiceRestart},
+		{service.DisconnectShutdown, websocket.CloseGoingAway},
+		{service.DisconnectUnsupportedType, websocket.CloseUnsupportedData},
+		{service.DisconnectMissingChannel, websocket.ClosePolicyViolation},
+		{service.DisconnectMessageTooBig, websocket.CloseMessageTooBig},
+		{service.DisconnectClientClose, websocket.CloseNormalClosure},
+	}
+	s := newTestServer(t, config.WebSocket{})
+	for _, tt := range tests {
+		t.Run(string(tt.reason), func(t *testing.T) {
+			conn, connected := s.connect(t, url.Values{"userId": {"alice"}})
+			s.wsService.DisconnectClient(connected["client_id"].(string), tt.reason)
+
+			code, text := readCloseCode(t, conn)
+			if code != tt.wantCode {
+				t.Fatalf("关闭码 = %d, want %d", code, tt.wantCode)
+			}
+			if _, wantText := tt.reason.CloseCode(); text != wantText {
+				t.Fatalf("关闭说明 = %q, want %q", text, wantText)
+			}
+		})
+	}
+}
+
+// subscribe 订阅房间并读取订阅确认
+func subscribe(t *testing.T, conn *websocket.Conn, channel, event string) {
+	t.Helper()
+	if err := conn.WriteJSON(model.WebSocketMessage{Type: model.MessageTypeSubscribe, Channel: channel, Event: event}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readMessage(t, conn); message.Type != model.MessageTypeSubscribed {
+		t.Fatalf("订阅回复类型 = %s, error = %+v", message.Type, message.Error)
+	}
+}
+
+func TestDisconnectMessageClosesNormally(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{})
+	conn, _ := s.connect(t, url.Values{"userId": {"alice"}})
+	peer, _ := s.connect(t, url.Values{"userId": {"bob"}})
+	subscribe(t, conn, "lobby", "")
+	subscribe(t, peer, "lobby", "")
+	if message := readMessage(t, conn); message.Event != model.PresenceJoin {
+		t.Fatalf("应收到bob的加入事件，got %+v", message)
+	}
+
+	if err := conn.WriteJSON(model.WebSocketMessage{Type: model.MessageTypeDisconnect}); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := readCloseCode(t, conn); code != websocket.CloseNormalClosure {
+		t.Fatalf("关闭码 = %d, want %d", code, websocket.CloseNormalClosure)
+	}
+
+	leave := readMessage(t, peer)
+	var data map[string]interface{}
+	json.Unmarshal(leave.Data, &data)
+	if leave.Type != model.MessageTypePresence || leave.Event != model.PresenceLeave || data["user_id"] != "alice" {
+		t.Fatalf("其他成员应收到alice的离开事件，got %+v %v", leave, data)
+	}
+	if members, _ := s.wsService.GetRoomMembers("lobby"); len(members) != 1 || members[0] != "bob" {
+		t.Fatalf("房间成员 = %v, want [bob]", members)
+	}
+}
+
+// timeoutError 模拟读超时
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestReadErrorCloseFrame(t *testing.T) {
+	var syntaxErr error
+	var target map[string]interface{}
+	syntaxErr = json.Unmarshal([]byte(`{"type":`), &target)
+	typeErr := json.Unmarshal([]byte(`{"type":1}`), &model.WebSocketMessage{})
+
+	tests := []struct {
+		name        string
+		err         error
+		established bool
+		wantCode    int
+		wantOK      bool
+	}{
+		{"超过读限制", websocket.ErrReadLimit, true, websocket.CloseMessageTooBig, true},
+		{"建立阶段超时", timeoutError{}, false, websocket.ClosePolicyViolation, true},
+		{"pong超时", timeoutError{}, true, service.CloseInactiveTimeout, true},
+		{"包装后的超时", fmt.Errorf("read: %w", timeoutError{}), true, service.CloseInactiveTimeout, true},
+		{"JSON语法错误", syntaxErr, true, websocket.CloseInvalidFramePayloadData, true},
+		{"JSON类型错误", typeErr, true, websocket.CloseInvalidFramePayloadData, true},
+		{"JSON不完整", io.ErrUnexpectedEOF, true, websocket.CloseInvalidFramePayloadData, true},
+		{"空消息", io.EOF, true, websocket.CloseInvalidFramePayloadData, true},
+		{"连接已中断", net.ErrClosed, true, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, text, ok := readErrorCloseFrame(tt.err, tt.established)
+			if ok != tt.wantOK || code != tt.wantCode {
+				t.Fatalf("readErrorCloseFrame() = (%d, %q, %v), want (%d, _, %v)", code, text, ok, tt.wantCode, tt.wantOK)
+			}
+			if ok && text == "" {
+				t.Fatal("关闭帧应带说明文本")
+			}
+		})
+	}
+}
+
+func TestCloseForReadError(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.WebSocket
+		payload  string
+		wantCode int
+	}{
+		{"无效JSON", config.WebSocket{}, `{"type":`, websocket.CloseInvalidFramePayloadData},
+		{"超过读限制", config.WebSocket{MaxMessageBytes: 1024}, `{"type":"ping","data":"` + strings.Repeat("x", 200*1024) + `"}`, websocket.CloseMessageTooBig},
+		{"开启协议错误断开时不支持的类型", config.WebSocket{CloseOnProtocolErrors: true}, `{"type":"bogus"}`, websocket.CloseUnsupportedData},
+		{"开启协议错误断开时缺少频道", config.WebSocket{CloseOnProtocolErrors: true}, `{"type":"subscribe"}`, websocket.ClosePolicyViolation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.cfg)
+			conn, _ := s.connect(t, url.Values{"userId": {"alice"}})
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(tt.payload)); err != nil {
+				t.Fatal(err)
+			}
+			if code, _ := readCloseCode(t, conn); code != tt.wantCode {
+				t.Fatalf("关闭码 = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestProtocolErrorsKeepConnectionByDefault(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{})
+	conn, _ := s.connect(t, url.Values{"userId": {"alice"}})
+	if err := conn.WriteJSON(model.WebSocketMessage{Type: "bogus"}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readMessage(t, conn); message.Type != model.MessageTypeError || message.Error.Code != 400 {
+		t.Fatalf("应回复400错误: %+v", message)
+	}
+	if err := conn.WriteJSON(model.WebSocketMessage{Type: model.MessageTypeWhoami}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readMessage(t, conn); message.Type != model.MessageTypeIdentity {
+		t.Fatalf("连接应保持可用，got %s", message.Type)
+	}
+}
+
+// refresh 发送refresh消息并返回回复
+func refresh(t *testing.T, conn *websocket.Conn, token string) *model.WebSocketMessage {
+	t.Helper()
+	data, _ := json.Marshal(map[string]string{"token": token})
+	if err := conn.WriteJSON(model.WebSocketMessage{Type: model.MessageTypeRefresh, Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	return readMessage(t, conn)
+}
+
+func TestRefreshRequiresJWTConnection(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{})
+	aliceJWT, err := s.jwtService.GenerateToken("alice", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// AuthToken连接自行声明了userId，不能借refresh换成JWT身份
+	claimed, _ := s.connect(t, url.Values{"userId": {"alice"}})
+	if reply := refresh(t, claimed, aliceJWT); reply.Type != model.MessageTypeError || reply.Error.Code != http.StatusForbidden {
+		t.Fatalf("AuthToken连接刷新的回复 = %+v, want 403错误", reply)
+	}
+
+	jwtConn, _ := s.connect(t, url.Values{"token": {aliceJWT}})
+	if reply := refresh(t, jwtConn, aliceJWT); reply.Type != model.MessageTypeRefreshed {
+		t.Fatalf("JWT连接刷新的回复 = %+v, want refreshed", reply)
+	}
+	bobJWT, err := s.jwtService.GenerateToken("bob", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := refresh(t, jwtConn, bobJWT); reply.Type != model.MessageTypeError || reply.Error.Code != http.StatusForbidden {
+		t.Fatalf("其他用户的token刷新的回复 = %+v, want 403错误", reply)
+	}
+}
+
+func TestStrictOriginCheckedBeforeToken(t *testing.T) {
+	s := newSecureTestServer(t, config.WebSocket{}, config.Security{StrictOriginCheck: true})
+	wsURL := "ws" + strings.TrimPrefix(s.URL, "http") + "/ws?"
+
+	tests := []struct {
+		name       string
+		origin     string
+		token      string
+		wantStatus int
+	}{
+		{"跨站来源缺少token", "https://evil.example", "", http.StatusForbidden},
+		{"跨站来源无效token", "https://evil.example", "invalid", http.StatusForbidden},
+		{"跨站来源有效token", "https://evil.example", s.authToken, http.StatusForbidden},
+		{"同源无效token", s.URL, "invalid", http.StatusUnauthorized},
+		{"同源有效token", s.URL, s.authToken, http.StatusSwitchingProtocols},
+		{"没有Origin的非浏览器客户端", "", s.authToken, http.StatusSwitchingProtocols},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL+url.Values{"token": {tt.token}}.Encode(), header)
+			if conn != nil {
+				conn.Close()
+			}
+			if resp == nil {
+				t.Fatalf("没有握手响应: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("状态码 = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	h := &WebSocketHandler{
+		strictOrigin: true,
+		origins:      middleware.NewOriginMatcher([]string{"https://app.example"}, nil, nil),
+	}
+	tests := []struct {
+		name   string
+		origin string
+		host   string
+		want   bool
+	}{
+		{"没有Origin", "", "ws.example", true},
+		{"与Host一致", "https://ws.example", "ws.example", true},
+		{"主机名不区分大小写", "https://WS.Example", "ws.example", true},
+		{"端口不同", "https://ws.example:8443", "ws.example", false},
+		{"在允许列表中", "https://app.example", "ws.example", true},
+		{"跨站来源", "https://evil.example", "ws.example", false},
+		{"无法解析的Origin", "://bad", "ws.example", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			r.Host = tt.host
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := h.originAllowed(r); got != tt.want {
+				t.Fatalf("originAllowed(%q, host=%q) = %v, want %v", tt.origin, tt.host, got, tt.want)
+			}
+		})
+	}
+
+	// 未开启严格检查时不限制来源
+	h.strictOrigin = false
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.Header.Set("Origin", "https://evil.example")
+	if !h.originAllowed(r) {
+		t.Fatal("未开启严格检查时应允许任意来源")
+	}
+}
+
+func TestVerifyTokenEndpoint(t *testing.T) {
+	s := newSecureTestServer(t, config.WebSocket{}, config.Security{VerboseAuthErrors: true})
+	jwtToken, err := s.jwtService.GenerateToken("alice", "mobile", "lobby")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type verifyResult struct {
+		Valid    bool   `json:"valid"`
+		Type     string `json:"type"`
+		UserID   string `json:"user_id"`
+		UserType string `json:"user_type"`
+		RoomID   string `json:"room_id"`
+		Reason   string `json:"reason"`
+	}
+	verify := func(t *testing.T, token string, bearer bool) (int, verifyResult) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, s.URL+"/auth/verify", nil)
+		if bearer {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else if token != "" {
+			req.URL.RawQuery = url.Values{"token": {token}}.Encode()
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Data verifyResult `json:"data"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, body.Data
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		bearer bool
+		want   verifyResult
+	}{
+		{"AuthToken", s.authToken, false, verifyResult{Valid: true, Type: service.AuthMethodAuthToken}},
+		{"Bearer头中的JWT", jwtToken, true, verifyResult{Valid: true, Type: service.AuthMethodJWT, UserID: "alice", UserType: "mobile", RoomID: "lobby"}},
+		{"无效token", "invalid", false, verifyResult{Reason: "mismatch"}},
+		{"格式错误的JWT", "a.b.c", false, verifyResult{Reason: "format"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, got := verify(t, tt.token, tt.bearer)
+			if status != http.StatusOK || got != tt.want {
+				t.Fatalf("verify = (%d, %+v), want (200, %+v)", status, got, tt.want)
+			}
+		})
+	}
+
+	if status, _ := verify(t, "", false); status != http.StatusBadRequest {
+		t.Fatalf("缺少token时状态码 = %d, want 400", status)
+	}
+}
+
+func TestMaxConcurrentHandshakes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.WebSocket{MaxRoomUsers: 10, MaxConcurrentHandshakes: 1}
+	wsService := service.NewWebSocketService(cfg)
+	authService := service.NewAuthService(config.Auth{AllowStaticToken: true})
+	h := NewWebSocketHandler(wsService, authService, service.NewJWTService(testJWTSecret, 1, 0), service.NewFeatureService(config.Features{}), cfg, config.Security{}, middleware.NewOriginMatcher(nil, nil, nil))
+	r := gin.New()
+	r.GET("/auth/verify", h.VerifyToken)
+	server := httptest.NewServer(r)
+	t.Cleanup(func() {
+		wsService.Shutdown("test")
+		server.Close()
+	})
+	authToken, _ := authService.GenerateAuthToken()
+
+	verify := func() *http.Response {
+		resp, err := http.Get(server.URL + "/auth/verify?" + url.Values{"token": {authToken}}.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// 占满握手名额后，新请求排队handshakeQueueWait后返回503
+	release := h.acquireHandshake()
+	start := time.Now()
+	resp := verify()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "1" {
+		t.Fatalf("名额已满时 status = %d, Retry-After = %q, want 503, 1", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if waited := time.Since(start); waited < handshakeQueueWait {
+		t.Fatalf("排队时间 = %v, want >= %v", waited, handshakeQueueWait)
+	}
+
+	// 排队期间名额释放时请求继续处理
+	time.AfterFunc(50*time.Millisecond, release)
+	if resp := verify(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("名额释放后状态码 = %d, want 200", resp.StatusCode)
+	}
+	// 释放函数可重复调用，不会多释放名额
+	release()
+	if len(h.handshakes) != 0 {
+		t.Fatalf("占用的名额数 = %d, want 0", len(h.handshakes))
+	}
+}
+
+func TestVerifyTokenRateLimitedByIP(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{MaxConnections: 1, PublishRatePerSecond: 1, PublishBurst: 2})
+
+	// 连接名额已满时校验仍可进行，校验不占用连接名额
+	s.connect(t, url.Values{})
+
+	verify := func() int {
+		resp, err := http.Get(s.URL + "/auth/verify?" + url.Values{"token": {s.authToken}}.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for i := 0; i < 2; i++ {
+		if status := verify(); status != http.StatusOK {
+			t.Fatalf("第%d次校验状态码 = %d, want 200", i+1, status)
+		}
+	}
+	if status := verify(); status != http.StatusTooManyRequests {
+		t.Fatalf("超出速率后状态码 = %d, want 429", status)
+	}
+}
+
+func TestErrorEchoesRequestID(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{})
+	conn, _ := s.connect(t, url.Values{"userId": {"alice"}})
+
+	tests := []struct {
+		name    string
+		request model.WebSocketMessage
+	}{
+		{"缺少频道名称", model.WebSocketMessage{ID: "req-1", Type: model.MessageTypeSubscribe}},
+		{"不支持的消息类型", model.WebSocketMessage{ID: "req-2", Type: "bogus"}},
+		{"房间名不合法", model.WebSocketMessage{ID: "req-3", Type: model.MessageTypeSubscribe, Channel: "a/b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := conn.WriteJSON(tt.request); err != nil {
+				t.Fatal(err)
+			}
+			message := readMessage(t, conn)
+			if message.Type != model.MessageTypeError {
+				t.Fatalf("应回复错误，got %+v", message)
+			}
+			if message.ID != tt.request.ID {
+				t.Fatalf("错误回复的id = %q, want %q", message.ID, tt.request.ID)
+			}
+		})
+	}
+
+	// 请求未带id时错误回复也不带id
+	if err := conn.WriteJSON(model.WebSocketMessage{Type: "bogus"}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readMessage(t, conn); message.ID != "" {
+		t.Fatalf("错误回复的id = %q, want 空", message.ID)
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		strict   bool
+		wantType string
+	}{
+		{"默认忽略未知字段", false, model.MessageTypeIdentity},
+		{"严格模式拒绝未知字段", true, model.MessageTypeError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, config.WebSocket{StrictDecoding: tt.strict})
+			conn, _ := s.connect(t, url.Values{"userId": {"alice"}})
+
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"whoami","chanel":"lobby"}`)); err != nil {
+				t.Fatal(err)
+			}
+			message := readMessage(t, conn)
+			if message.Type != tt.wantType {
+				t.Fatalf("回复类型 = %s, want %s", message.Type, tt.wantType)
+			}
+			if message.Error != nil && !strings.Contains(message.Error.Message, "chanel") {
+				t.Fatalf("错误信息应指出未知字段: %s", message.Error.Message)
+			}
+
+			// 被拒绝的只是这一条消息，连接保持可用
+			if err := conn.WriteJSON(model.WebSocketMessage{Type: model.MessageTypeWhoami}); err != nil {
+				t.Fatal(err)
+			}
+			if message := readMessage(t, conn); message.Type != model.MessageTypeIdentity {
+				t.Fatalf("连接应保持可用，got %s", message.Type)
+			}
+		})
+	}
+}
+
+func TestServerHeartbeat(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{ServerHeartbeatSeconds: 1})
+	conn, _ := s.connect(t, url.Values{"userId": {"alice"}})
+
+	// 客户端不发送任何消息也会定期收到应用层心跳
+	for i := 0; i < 2; i++ {
+		if message := readMessage(t, conn); message.Type != model.MessageTypeHeartbeat {
+			t.Fatalf("第%d条消息类型 = %s, want %s", i+1, message.Type, model.MessageTypeHeartbeat)
+		}
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{HandshakeTimeoutSeconds: 1})
+
+	// 未在时限内发送第一条消息的连接被断开
+	idle, _ := s.connect(t, url.Values{"userId": {"alice"}})
+	if code, text := readCloseCode(t, idle); code != websocket.ClosePolicyViolation || text != "handshake timeout" {
+		t.Fatalf("关闭帧 = (%d, %q), want (%d, handshake timeout)", code, text, websocket.ClosePolicyViolation)
+	}
+
+	// 及时发送了第一条消息的连接恢复常规读超时，超过时限后仍可用
+	active, _ := s.connect(t, url.Values{"userId": {"bob"}})
+	for i := 0; i < 2; i++ {
+		if i > 0 {
+			time.Sleep(1500 * time.Millisecond)
+		}
+		if err := active.WriteJSON(model.WebSocketMessage{Type: model.MessageTypeWhoami}); err != nil {
+			t.Fatal(err)
+		}
+		if message := readMessage(t, active); message.Type != model.MessageTypeIdentity {
+			t.Fatalf("回复类型 = %s, want %s", message.Type, model.MessageTypeIdentity)
+		}
+	}
+}
+
+func TestSubscribeRoomNameErrorReason(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{})
+	conn, _ := s.connect(t, url.Values{"userId": {"alice"}})
+
+	if err := conn.WriteJSON(model.WebSocketMessage{Type: model.MessageTypeSubscribe, Channel: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	message := readMessage(t, conn)
+	if message.Type != model.MessageTypeError || message.Error.Code != 400 || message.Error.Reason != service.RoomNameTooShort {
+		t.Fatalf("回复 = %+v, want 400且reason为%s", message.Error, service.RoomNameTooShort)
+	}
+}
+
+func TestRejectConnectionsWhileMigrating(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{})
+	s.wsService.Migrate("wss://other.example/ws", time.Minute)
+
+	conn, resp, err := s.dial(url.Values{"userId": {"alice"}})
+	if conn != nil {
+		conn.Close()
+	}
+	if resp == nil {
+		t.Fatalf("没有握手响应: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("迁移期间的握手状态码 = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestCaptureHeaders(t *testing.T) {
+	h := &WebSocketHandler{cfg: config.WebSocket{CaptureHeaders: []string{"X-Tenant-ID", "X-Region"}}}
+	tests := []struct {
+		name   string
+		header http.Header
+		want   map[string]string
+	}{
+		{"采集配置的请求头", http.Header{"X-Tenant-Id": {"acme"}, "X-Other": {"x"}}, map[string]string{"X-Tenant-ID": "acme"}},
+		{"超长的值被截断", http.Header{"X-Region": {strings.Repeat("r", 300)}}, map[string]string{"X-Region": strings.Repeat("r", maxCapturedHeaderBytes)}},
+		{"截断时不留下半个字符", http.Header{"X-Region": {"ab" + strings.Repeat("区", 100)}}, map[string]string{"X-Region": "ab" + strings.Repeat("区", 84)}},
+		{"请求头都不存在", http.Header{}, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := h.captureHeaders(tt.header)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("captureHeaders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := (&WebSocketHandler{}).captureHeaders(http.Header{"X-Tenant-Id": {"acme"}}); got != nil {
+		t.Fatalf("未配置时 captureHeaders() = %v, want nil", got)
+	}
+}
+
+func TestCaptureHeadersIntoMetadata(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{CaptureHeaders: []string{"X-Tenant-ID"}})
+	query := url.Values{"userId": {"alice"}, "token": {s.authToken}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/ws?"+query.Encode(), http.Header{"X-Tenant-ID": {"acme"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	readMessage(t, conn)
+
+	clients := s.wsService.GetClients()
+	if len(clients) != 1 {
+		t.Fatalf("在线客户端数 = %d, want 1", len(clients))
+	}
+	metadata := clients[0]["metadata"].(map[string]interface{})
+	if headers := fmt.Sprint(metadata["headers"]); headers != "map[X-Tenant-ID:acme]" {
+		t.Fatalf("metadata.headers = %s, want map[X-Tenant-ID:acme]", headers)
+	}
+}
+
+func TestSubscribeBatchLimit(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{MaxSubscribeBatch: 2})
+	conn, _ := s.connect(t, url.Values{"userId": {"alice"}})
+
+	// 超过上限时整批拒绝，不订阅其中任何房间
+	if err := conn.WriteJSON(model.WebSocketMessage{Type: model.MessageTypeSubscribe, Channels: []string{"r1", "r2", "r3"}}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readMessage(t, conn); message.Type != model.MessageTypeError || message.Error.Code != 400 {
+		t.Fatalf("超过批量上限应回复400错误: %+v", message)
+	}
+	if rooms := s.wsService.GetRoomStats(); len(rooms) != 0 {
+		t.Fatalf("被拒绝的批量订阅不应创建房间: %v", rooms)
+	}
+
+	// 上限以内逐个订阅，每个房间各回复一次确认
+	if err := conn.WriteJSON(model.WebSocketMessage{Type: model.MessageTypeSubscribe, Channels: []string{"r1", "r2"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"r1", "r2"} {
+		if message := readMessage(t, conn); message.Type != model.MessageTypeSubscribed || message.Channel != want {
+			t.Fatalf("回复 = %s %s, want subscribed %s", message.Type, message.Channel, want)
+		}
+	}
+}
+
+func TestMessageSizeLimitsByType(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{MessageSizeLimits: map[string]int{model.MessageTypeSubscribe: 64}})
+	conn, _ := s.connect(t, url.Values{"userId": {"alice"}})
+
+	// 超过该类型上限的消息被拒绝，连接保持可用
+	large := model.WebSocketMessage{Type: model.MessageTypeSubscribe, Channel: "lobby", Event: strings.Repeat("e", 64)}
+	if err := conn.WriteJSON(large); err != nil {
+		t.Fatal(err)
+	}
+	if message := readMessage(t, conn); message.Type != model.MessageTypeError || message.Error.Code != 413 {
+		t.Fatalf("超过类型上限应回复413错误: %+v", message)
+	}
+	subscribe(t, conn, "lobby", "signal:all")
+
+	// 未配置上限的类型只受连接级读限制
+	if err := conn.WriteJSON(model.WebSocketMessage{Type: model.MessageTypeWhoami, Channel: strings.Repeat("c", 128)}); err != nil {
+		t.Fatal(err)
+	}
+	if message := readMessage(t, conn); message.Type != model.MessageTypeIdentity {
+		t.Fatalf("未配置上限的类型不应受限，got %+v", message)
+	}
+}
+
+func TestRoomMessageSizeLimit(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{RoomMessageBytes: map[string]int{"chat-*": 32}})
+	conn, _ := s.connect(t, url.Values{"userId": {"alice"}})
+	subscribe(t, conn, "chat-1", "signal:all")
+	subscribe(t, conn, "lobby", "signal:all")
+
+	payload := json.RawMessage(`{"text":"` + strings.Repeat("x", 64) + `"}`)
+	publish := func(channel string) *model.WebSocketMessage {
+		t.Helper()
+		if err := conn.WriteJSON(model.WebSocketMessage{ID: "p-" + channel, Type: model.MessageTypePublish, Channel: channel, Event: "signal:all", Data: payload}); err != nil {
+			t.Fatal(err)
+		}
+		return readMessage(t, conn)
+	}
+
+	if reply := publish("chat-1"); reply.Type != model.MessageTypeAck || reply.Error == nil || reply.Error.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("超过房间上限的回复 = %+v, want 413", reply)
+	}
+	// 其他房间仍使用全局上限
+	if reply := publish("lobby"); reply.Type != model.MessageTypeAck || reply.Error != nil {
+		t.Fatalf("未匹配房间的回复 = %+v, want 成功的ack", reply)
+	}
+}
+
+func TestExpiredTokenConnectionIsReadOnly(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{TokenExpiryGraceSeconds: 60})
+	conn, connected := s.connect(t, url.Values{"userId": {"alice"}})
+	subscribe(t, conn, "lobby", "signal:all")
+
+	client, ok := s.wsService.GetClient(connected["client_id"].(string))
+	if !ok {
+		t.Fatal("客户端不存在")
+	}
+	client.TokenExpiresAt.Store(time.Now().Unix() - 1)
+
+	for _, request := range []model.WebSocketMessage{
+		{ID: "r1", Type: model.MessageTypeSubscribe, Channel: "other"},
+		{ID: "r2", Type: model.MessageTypePublish, Channel: "lobby", Event: "signal:all", Data: json.RawMessage(`{}`)},
+		{ID: "r3", Type: model.MessageTypeChat, Channel: "lobby", Data: json.RawMessage(`{"text":"hi"}`)},
+	} {
+		if err := conn.WriteJSON(request); err != nil {
+			t.Fatal(err)
+		}
+		reply := readMessage(t, conn)
+		if reply.Type != model.MessageTypeError || reply.ID != request.ID || reply.Error.Code != http.StatusUnauthorized || reply.Error.Reason != "token_expired" {
+			t.Fatalf("只读连接的%s回复 = %+v, want 401 token_expired", request.Type, reply)
+		}
+	}
+
+	// 只读连接仍可取消订阅
+	if err := conn.WriteJSON(model.WebSocketMessage{Type: model.MessageTypeUnsubscribe, Channel: "lobby"}); err != nil {
+		t.Fatal(err)
+	}
+	if reply := readMessage(t, conn); reply.Type == model.MessageTypeError {
+		t.Fatalf("只读连接取消订阅的回复 = %+v", reply.Error)
+	}
+}
+
+func TestPresenceResync(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{})
+	alice, _ := s.connect(t, url.Values{"userId": {"alice"}})
+	subscribe(t, alice, "Lobby", "signal:all")
+	bob, _ := s.connect(t, url.Values{"userId": {"bob"}})
+	subscribe(t, bob, "lobby", "signal:all")
+	if message := readMessage(t, alice); message.Type != model.MessageTypePresence {
+		t.Fatalf("alice应先收到bob的加入事件: %+v", message)
+	}
+
+	if err := alice.WriteJSON(model.WebSocketMessage{ID: "sync-1", Type: model.MessageTypePresenceSync}); err != nil {
+		t.Fatal(err)
+	}
+	reply := readMessage(t, alice)
+	var presence map[string][]string
+	if err := json.Unmarshal(reply.Data, &presence); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Type != model.MessageTypePresenceList || reply.ID != "sync-1" || len(presence["Lobby"]) != 2 {
+		t.Fatalf("presence_resync的回复 = %+v, data = %v", reply, presence)
+	}
+
+	if err := alice.WriteJSON(model.WebSocketMessage{ID: "sync-2", Type: model.MessageTypePresenceSync, Channel: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if reply := readMessage(t, alice); reply.Type != model.MessageTypeError || reply.ID != "sync-2" {
+		t.Fatalf("未加入房间的presence_resync回复 = %+v, want 错误", reply)
+	}
+}
+
+func TestPublishErrorCode(t *testing.T) {
+	if code := publishErrorCode(fmt.Errorf("发布失败: %w", service.ErrRoomGone)); code != http.StatusConflict {
+		t.Fatalf("房间被并发删除时错误码 = %d, want 409", code)
+	}
+	if code := publishErrorCode(errors.New("客户端未订阅房间")); code != http.StatusBadRequest {
+		t.Fatalf("其他错误码 = %d, want 400", code)
+	}
+}
+
+func TestSubscribeRoomFullReason(t *testing.T) {
+	s := newTestServer(t, config.WebSocket{MaxRoomUsers: 1, RoomFullSuggestions: service.RoomSuggestionNumericSuffix})
+	alice, _ := s.connect(t, url.Values{"userId": {"alice"}})
+	subscribe(t, alice, "lobby", "")
+
+	bob, _ := s.connect(t, url.Values{"userId": {"bob"}})
+	if err := bob.WriteJSON(model.WebSocketMessage{ID: "s1", Type: model.MessageTypeSubscribe, Channel: "lobby"}); err != nil {
+		t.Fatal(err)
+	}
+	reply := readMessage(t, bob)
+	if reply.Type != model.MessageTypeError || reply.ID != "s1" || reply.Error.Reason != "room_full" {
+		t.Fatalf("订阅已满房间的回复 = %+v, want reason=room_full的错误", reply)
+	}
+	var data struct {
+		Room        string   `json:"room"`
+		MaxUsers    int      `json:"max_users"`
+		Suggestions []string `json:"suggestions"`
+	}
+	if err := json.Unmarshal(reply.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Room != "lobby" || data.MaxUsers != 1 || len(data.Suggestions) != 3 || data.Suggestions[0] != "lobby-2" {
+		t.Fatalf("room_full数据 = %+v, want lobby的3个备选房间", data)
+	}
+	subscribe(t, bob, data.Suggestions[0], "")
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OriginMatcher 判断请求来源是否允许：依次精确匹配allowed_origins、检查allowed_cidrs网段、匹配allowed_origin_patterns
+type OriginMatcher struct {
+	origins  map[string]bool
+	networks []*net.IPNet
+	patterns []*regexp.Regexp
+}
+
+// NewOriginMatcher 创建来源匹配器，网段和正则在此解析/编译一次，无效的条目记录错误后跳过
+func NewOriginMatcher(origins, cidrs, patterns []string) *OriginMatcher {
+	m := &OriginMatcher{origins: make(map[string]bool, len(origins))}
+	for _, origin := range origins {
+		m.origins[origin] = true
+	}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			logrus.WithError(err).WithField("cidr", cidr).Error("cors.allowed_cidrs中的网段无效，将被忽略")
+			continue
+		}
+		m.networks = append(m.networks, network)
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logrus.WithError(err).WithField("pattern", pattern).Error("cors.allowed_origin_patterns中的模式无效，将被忽略")
+			continue
+		}
+		m.patterns = append(m.patterns, re)
+	}
+	return m
+}
+
+// Allowed 来源是否在允许列表中、主机IP在允许的网段内或匹配任一模式
+func (m *OriginMatcher) Allowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if m.origins[origin] {
+		return true
+	}
+	if m.inNetworks(origin) {
+		return true
+	}
+	for _, re := range m.patterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// inNetworks 来源的主机是否为允许网段内的IP。主机为域名时不做DNS解析，直接跳过网段检查；
+// IPv6主机形如http://[fd00::1]:8080，IPv4映射的IPv6地址按IPv4网段匹配
+func (m *OriginMatcher) inNetworks(origin string) bool {
+	if len(m.networks) == 0 {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	ip := net.ParseIP(u.Hostname())
+	if ip == nil {
+		return false
+	}
+	for _, network := range m.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import "testing"
+
+func TestOriginMatcherPatterns(t *testing.T) {
+	m := NewOriginMatcher(
+		[]string{"https://letshare.fun"},
+		nil,
+		[]string{`^https://[a-z0-9-]+\.letshare\.fun$`, `^http://localhost:\d+$`, `([`},
+	)
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"精确匹配", "https://letshare.fun", true},
+		{"子域名匹配模式", "https://preview-42.letshare.fun", true},
+		{"本地任意端口", "http://localhost:5173", true},
+		{"协议不同", "http://preview.letshare.fun", false},
+		{"后缀伪装", "https://preview.letshare.fun.evil.com", false},
+		{"未配置的来源", "https://evil.example", false},
+		{"空来源", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.Allowed(tt.origin); got != tt.want {
+				t.Fatalf("Allowed(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+
+	// 无效的模式被跳过，不影响其他模式
+	if len(m.patterns) != 2 {
+		t.Fatalf("编译的模式数 = %d, want 2", len(m.patterns))
+	}
+}
+
+func TestOriginMatcherCIDR(t *testing.T) {
+	m := NewOriginMatcher(nil, []string{"192.168.0.0/16", "fd00::/8", "not-a-cidr"}, nil)
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"网段内的IPv4", "http://192.168.1.20:8080", true},
+		{"https也允许", "https://192.168.1.20", true},
+		{"网段外的IPv4", "http://10.0.0.1", false},
+		{"网段内的IPv6", "http://[fd00::1]:8080", true},
+		{"网段外的IPv6", "http://[2001:db8::1]", false},
+		{"IPv4映射的IPv6地址", "http://[::ffff:192.168.1.20]", true},
+		{"域名不做DNS解析", "http://localhost", false},
+		{"非http协议", "ws://192.168.1.20", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.Allowed(tt.origin); got != tt.want {
+				t.Fatalf("Allowed(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+
+	// 无效的网段被跳过
+	if len(m.networks) != 2 {
+		t.Fatalf("解析的网段数 = %d, want 2", len(m.networks))
+	}
+}
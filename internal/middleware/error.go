@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"letshare-server/pkg/response"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -21,12 +22,7 @@ func ErrorHandler() gin.HandlerFunc {
 				}).Error("服务器panic")
 				
 				// 返回统一的错误响应
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error":   "内部服务器错误",
-					"message": "服务器遇到了意外错误，请稍后重试",
-					"code":    500,
-				})
-				c.Abort()
+				response.AbortWithError(c, http.StatusInternalServerError, "服务器遇到了意外错误，请稍后重试", nil)
 			}
 		}()
 		
@@ -46,23 +42,11 @@ func ErrorHandler() gin.HandlerFunc {
 			// 根据错误类型返回不同的HTTP状态码
 			switch err.Type {
 			case gin.ErrorTypeBind:
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error":   "请求数据格式错误",
-					"message": err.Error(),
-					"code":    400,
-				})
+				response.Error(c, http.StatusBadRequest, "请求数据格式错误: "+err.Error())
 			case gin.ErrorTypePublic:
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error":   "请求错误",
-					"message": err.Error(),
-					"code":    400,
-				})
+				response.Error(c, http.StatusBadRequest, "请求错误: "+err.Error())
 			default:
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error":   "内部服务器错误",
-					"message": "服务器处理请求时发生错误",
-					"code":    500,
-				})
+				response.Error(c, http.StatusInternalServerError, "服务器处理请求时发生错误")
 			}
 		}
 	}
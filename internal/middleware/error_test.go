@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestErrorHandlerEnvelope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name       string
+		handler    gin.HandlerFunc
+		wantStatus int
+		wantError  string
+	}{
+		{"panic", func(c *gin.Context) { panic("boom") }, http.StatusInternalServerError, "服务器遇到了意外错误，请稍后重试"},
+		{"公开错误", func(c *gin.Context) { c.Error(errors.New("缺少参数")).SetType(gin.ErrorTypePublic) }, http.StatusBadRequest, "请求错误: 缺少参数"},
+		{"内部错误", func(c *gin.Context) { c.Error(errors.New("数据库不可用")) }, http.StatusInternalServerError, "服务器处理请求时发生错误"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(ErrorHandler())
+			r.GET("/", tt.handler)
+
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("状态码 = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			// 错误响应与其它接口一样使用data/error/code结构
+			var body map[string]interface{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body) != 3 || body["data"] != nil || body["error"] != tt.wantError || body["code"] != float64(tt.wantStatus) {
+				t.Fatalf("响应 = %v, want data为null、error为%q、code为%d", body, tt.wantError, tt.wantStatus)
+			}
+		})
+	}
+}
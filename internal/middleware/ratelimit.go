@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"letshare-server/internal/model"
+	"letshare-server/pkg/response"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AbortRateLimited 以统一格式返回HTTP限流错误（429或503），并设置Retry-After响应头；
+// 所有HTTP限流器的拒绝都经由此处，WebSocket内的限流使用相同结构的model.NewRateLimitMessage
+func AbortRateLimited(c *gin.Context, status int, message string, retryAfter time.Duration) {
+	info := model.NewRateLimitErrorInfo(message, retryAfter)
+
+	// Retry-After 以秒为单位，向上取整
+	seconds := int(math.Ceil(float64(info.RetryAfterMs) / 1000))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+
+	response.AbortWithError(c, status, info.Message, gin.H{
+		"retry_after_ms": info.RetryAfterMs,
+	})
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAbortRateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name           string
+		status         int
+		retryAfter     time.Duration
+		wantHeader     string
+		wantRetryAfter float64
+	}{
+		{"单IP超限", http.StatusTooManyRequests, 5 * time.Second, "5", 5000},
+		{"握手排队超时", http.StatusServiceUnavailable, 500 * time.Millisecond, "1", 500},
+		{"不足1毫秒", http.StatusTooManyRequests, 0, "1", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			AbortRateLimited(c, tt.status, "请稍后重试", tt.retryAfter)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("状态码 = %d, want %d", recorder.Code, tt.status)
+			}
+			if got := recorder.Header().Get("Retry-After"); got != tt.wantHeader {
+				t.Fatalf("Retry-After = %q, want %q", got, tt.wantHeader)
+			}
+			var body struct {
+				Data struct {
+					RetryAfterMs float64 `json:"retry_after_ms"`
+				} `json:"data"`
+				Code int `json:"code"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Data.RetryAfterMs != tt.wantRetryAfter || body.Code != tt.status {
+				t.Fatalf("响应体 = %s", recorder.Body.String())
+			}
+			if !c.IsAborted() {
+				t.Fatal("应中止后续处理")
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 二进制帧格式（客户端发送和服务端转发相同）：
+//
+//	[频道长度 1字节][频道][事件长度 1字节][事件][发送者长度 1字节][发送者][负载]
+//
+// 客户端发送时发送者长度填0，服务端转发时填入发送者的用户ID。
+const maxBinaryHeaderField = 255
+
+// ErrBinaryFrameTruncated 二进制帧头不完整
+var ErrBinaryFrameTruncated = errors.New("二进制帧头不完整")
+
+// BinaryFrame 解析后的二进制帧
+type BinaryFrame struct {
+	Channel string
+	Event   string
+	From    string
+	Payload []byte
+}
+
+// EncodeBinaryFrame 编码二进制帧
+func EncodeBinaryFrame(frame BinaryFrame) ([]byte, error) {
+	fields := []string{frame.Channel, frame.Event, frame.From}
+	size := len(frame.Payload)
+	for _, field := range fields {
+		if len(field) > maxBinaryHeaderField {
+			return nil, fmt.Errorf("二进制帧头字段过长: 最多%d字节", maxBinaryHeaderField)
+		}
+		size += 1 + len(field)
+	}
+
+	data := make([]byte, 0, size)
+	for _, field := range fields {
+		data = append(data, byte(len(field)))
+		data = append(data, field...)
+	}
+	return append(data, frame.Payload...), nil
+}
+
+// DecodeBinaryFrame 解析二进制帧，Payload引用data的底层数组
+func DecodeBinaryFrame(data []byte) (BinaryFrame, error) {
+	var fields [3]string
+	for i := range fields {
+		if len(data) < 1 {
+			return BinaryFrame{}, ErrBinaryFrameTruncated
+		}
+		n := int(data[0])
+		if len(data) < 1+n {
+			return BinaryFrame{}, ErrBinaryFrameTruncated
+		}
+		fields[i] = string(data[1 : 1+n])
+		data = data[1+n:]
+	}
+	return BinaryFrame{
+		Channel: fields[0],
+		Event:   fields[1],
+		From:    fields[2],
+		Payload: data,
+	}, nil
+}
+
+// NewBinaryMessage 创建以二进制帧发送的消息
+func NewBinaryMessage(channel, event, from string, payload []byte) (*WebSocketMessage, error) {
+	data, err := EncodeBinaryFrame(BinaryFrame{Channel: channel, Event: event, From: from, Payload: payload})
+	if err != nil {
+		return nil, err
+	}
+	return &WebSocketMessage{
+		Type:    MessageTypeMessage,
+		Channel: channel,
+		Event:   event,
+		Binary:  data,
+	}, nil
+}
@@ -0,0 +1,60 @@
+package model
+
+import "sort"
+
+// historyEntry 历史消息及其在房间内的序号（用于跨事件按发布顺序回放）
+type historyEntry struct {
+	seq     int64
+	message *WebSocketMessage
+}
+
+// RoomHistory 房间内按事件保留的最近N条消息（环形缓冲区），用于向后加入的成员回放
+type RoomHistory struct {
+	size   int
+	seq    int64
+	events map[string][]historyEntry
+	next   map[string]int
+}
+
+// NewRoomHistory 创建每个事件保留size条消息的历史记录
+func NewRoomHistory(size int) *RoomHistory {
+	return &RoomHistory{
+		size:   size,
+		events: make(map[string][]historyEntry),
+		next:   make(map[string]int),
+	}
+}
+
+// Add 记录一条消息，该事件的缓冲区已满时覆盖最旧的消息
+func (h *RoomHistory) Add(event string, message *WebSocketMessage) {
+	h.seq++
+	entry := historyEntry{seq: h.seq, message: message}
+
+	buffer := h.events[event]
+	if len(buffer) < h.size {
+		h.events[event] = append(buffer, entry)
+		return
+	}
+	buffer[h.next[event]] = entry
+	h.next[event] = (h.next[event] + 1) % h.size
+}
+
+// Messages 返回按发布顺序排列的历史消息，include为nil时返回全部事件
+func (h *RoomHistory) Messages(include func(event string) bool) []*WebSocketMessage {
+	var entries []historyEntry
+	for event, buffer := range h.events {
+		if include != nil && !include(event) {
+			continue
+		}
+		entries = append(entries, buffer...)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+
+	messages := make([]*WebSocketMessage, len(entries))
+	for i, entry := range entries {
+		messages[i] = entry.message
+	}
+	return messages
+}
@@ -2,52 +2,161 @@ package model
 
 import (
 	"encoding/json"
+	"sync/atomic"
 	"time"
 )
 
 // WebSocket消息类型
 const (
-	MessageTypeSubscribe   = "subscribe"
-	MessageTypeUnsubscribe = "unsubscribe"
-	MessageTypePublish     = "publish"
-	MessageTypeSubscribed  = "subscribed"
-	MessageTypeMessage     = "message"
-	MessageTypeError       = "error"
+	MessageTypeSubscribe    = "subscribe"
+	MessageTypeUnsubscribe  = "unsubscribe"
+	MessageTypePublish      = "publish"
+	MessageTypeSubscribed   = "subscribed"
+	MessageTypeMessage      = "message"
+	MessageTypeError        = "error"
+	MessageTypeListRooms    = "list_rooms"
+	MessageTypeRooms        = "rooms"
+	MessageTypeHeartbeat    = "heartbeat"
+	MessageTypePresence     = "presence"
+	MessageTypeConnected    = "connected"
+	MessageTypeAck          = "ack"
+	MessageTypeMigrate      = "migrate"
+	MessageTypeShutdown     = "server:shutdown"
+	MessageTypeDisconnect   = "disconnect"
+	MessageTypeChat         = "chat"
+	MessageTypeTokenExpired = "token:expired"
+	MessageTypeRefresh      = "refresh"
+	MessageTypeRefreshed    = "refreshed"
+	MessageTypeBroadcast    = "broadcast"
+	MessageTypeIdleClosed   = "room:idle_closed"
+	MessageTypeWhoami       = "whoami"
+	MessageTypeIdentity     = "identity"
+	MessageTypePresenceSync = "presence_resync"
+	MessageTypePresenceList = "presence_state"
+)
+
+// 房间成员变化事件（presence消息的event字段）
+const (
+	PresenceJoin  = "member:join"
+	PresenceLeave = "member:leave"
+)
+
+// 房间消息分发策略
+const (
+	RoomPolicyEventFiltered = "event_filtered" // 只发送给订阅了对应事件的成员（信令房间）
+	RoomPolicyBroadcastAll  = "broadcast_all"  // 所有成员都能收到，忽略事件订阅（如聊天房间）
+)
+
+// 房间消息投递保证
+const (
+	RoomDeliveryBestEffort = "best_effort" // 只投递给在线成员，断线期间的消息丢弃（信令房间）
+	RoomDeliveryBuffered   = "buffered"    // 为会话挂起中的成员缓存消息，恢复会话时补发（控制房间）
 )
 
 // WebSocketMessage 表示WebSocket消息（兼容Ably格式）
 type WebSocketMessage struct {
+	ID        string          `json:"id,omitempty"` // 客户端提供的消息ID，用于关联请求和响应
 	Type      string          `json:"type"`
 	Channel   string          `json:"channel,omitempty"`
+	Channels  []string        `json:"channels,omitempty"` // 批量订阅的房间列表
+	History   bool            `json:"history,omitempty"`  // 订阅时创建房间的情况下，是否为该房间保留历史消息
 	Event     string          `json:"event,omitempty"`
+	To        string          `json:"to,omitempty"` // 点对点消息的目标用户ID，为空时广播
 	Data      json.RawMessage `json:"data,omitempty"`
 	Timestamp int64           `json:"timestamp,omitempty"`
 	Error     *ErrorInfo      `json:"error,omitempty"`
+	Binary    []byte          `json:"-"` // 非空时以二进制帧原样发送，其余字段不写出
 }
 
+// 消息格式版本，通过WebSocket子协议（Sec-WebSocket-Protocol）协商
+const (
+	ProtocolV1 = 1 // 当前的消息格式，未协商子协议的客户端也使用该版本
+)
+
+// Subprotocols 支持的子协议名到消息格式版本的映射
+var Subprotocols = map[string]int{
+	"letshare.v1": ProtocolV1,
+}
+
+// CodeRateLimited 触发限流时使用的错误码
+const CodeRateLimited = 429
+
 // ErrorInfo 表示错误信息
 type ErrorInfo struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code         int    `json:"code"`
+	Message      string `json:"message"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"` // 限流时建议客户端等待的毫秒数
+	Reason       string `json:"reason,omitempty"`         // 机器可读的错误原因，如too_short
 }
 
 // Client 表示WebSocket客户端
 type Client struct {
-	ID         string                 `json:"id"`
-	UserID     string                 `json:"user_id"`
-	Connection interface{}            `json:"-"` // WebSocket连接
-	Rooms      map[string]bool        `json:"rooms"`
-	Events     map[string]bool        `json:"events"` // 订阅的事件
-	LastPing   time.Time              `json:"last_ping"`
-	Metadata   map[string]interface{} `json:"metadata"`
+	ID         string                     `json:"id"`
+	UserID     string                     `json:"user_id"`
+	Connection interface{}                `json:"-"` // WebSocket连接
+	Rooms      map[string]bool            `json:"rooms"`
+	Events     map[string]map[string]bool `json:"events"` // 按房间订阅的事件：roomName -> event -> true
+	LastPing   time.Time                  `json:"last_ping"`
+	Metadata   map[string]interface{}     `json:"metadata"`
+	Send       chan *WebSocketMessage     `json:"-"`                    // 待发送消息队列，由写协程统一写入连接
+	Done       chan struct{}              `json:"-"`                    // 客户端被移除时关闭，通知写协程退出
+	Pending    atomic.Int64               `json:"-"`                    // 已入队但尚未写完的消息数
+	SessionID  string                     `json:"session_id,omitempty"` // 会话恢复使用的sessionId，未开启会话恢复时为空
+	Tags       map[string]string          `json:"tags,omitempty"`       // 连接时确定的标签（如user_type），用于按标签定向广播
+
+	// AuthMethod 连接的认证方式（jwt/signed_token/auth_token），jwt和signed_token证明了UserID属于该连接
+	AuthMethod string `json:"auth_method,omitempty"`
+	// Anonymous 连接未声明userId也未使用JWT，UserID由服务端分配（客户端ID，恢复会话时沿用原会话的ID）
+	Anonymous bool `json:"anonymous,omitempty"`
+
+	// ResumeToken 本次连接下发的恢复令牌，连接挂起后下次恢复时须携带；未开启恢复令牌时为空
+	ResumeToken string `json:"-"`
+
+	// IP 客户端的IP地址；Admitted 为true时该连接占用了准入名额，移除时需要释放
+	IP       string `json:"ip,omitempty"`
+	Admitted bool   `json:"-"`
+
+	// W3C追踪上下文（来自升级请求的traceparent/tracestate），用于将日志与前端链路关联
+	TraceID    string `json:"trace_id,omitempty"`
+	SpanID     string `json:"span_id,omitempty"`
+	TraceState string `json:"trace_state,omitempty"`
+
+	// Protocol 协商的子协议名，客户端未请求子协议时为空；ProtocolVersion 对应的消息格式版本
+	Protocol        string `json:"protocol,omitempty"`
+	ProtocolVersion int    `json:"protocol_version"`
+
+	// OverflowPolicy 连接时指定的发送队列溢出策略，为空时使用全局配置
+	OverflowPolicy string `json:"overflow_policy,omitempty"`
+	// Dropped 因发送队列溢出丢弃的消息数
+	Dropped atomic.Int64 `json:"-"`
+
+	// Subscribed 连接后是否成功订阅过房间，用于subscribe_timeout_seconds
+	Subscribed atomic.Bool `json:"-"`
+	// Displaced 会话已被携带恢复令牌的新连接接管，断开时不再挂起会话
+	Displaced atomic.Bool `json:"-"`
+
+	// TokenExpiresAt 连接所用JWT的过期时间（Unix秒，含时钟偏差容忍），0表示不过期（AuthToken认证）
+	TokenExpiresAt atomic.Int64 `json:"-"`
+	// TokenExpiryNotified 已发送只读通知时对应的过期时间，刷新token后过期时间变化，会重新通知
+	TokenExpiryNotified atomic.Int64 `json:"-"`
 }
 
 // Room 表示房间
 type Room struct {
-	Name      string          `json:"name"`
-	ClientIDs map[string]bool `json:"client_ids"` // 存储客户端ID而不是指针，避免循环引用
-	CreatedAt time.Time       `json:"created_at"`
-	UpdatedAt time.Time       `json:"updated_at"`
+	Name        string          `json:"name"`         // 规范化后的房间名（去除首尾空格并转为小写），用作房间键
+	DisplayName string          `json:"display_name"` // 创建者使用的原始写法，用于下发给客户端
+	Owner       string          `json:"owner"`        // 创建房间的用户ID
+	QuotaKey    string          `json:"-"`            // 该房间计入的房间配额键，见max_rooms_owned_per_user
+	MaxUsers    int             `json:"max_users"`    // 实际生效的人数上限（全局或按房间覆盖）
+	History     *RoomHistory    `json:"-"`            // 最近消息的历史记录，为nil时不保留任何消息
+	Policy      string          `json:"policy"`       // 消息分发策略，创建后不再改变
+	Delivery    string          `json:"delivery"`     // 投递保证，创建后不再改变
+	ClientIDs   map[string]bool `json:"client_ids"`   // 存储客户端ID而不是指针，避免循环引用
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"` // 成员变化（加入/离开）的时间
+
+	// LastActivity 最近一次在房间内发送消息的时间（UnixNano），发送时只持有读锁，因此使用原子变量
+	LastActivity atomic.Int64 `json:"-"`
 }
 
 // NewWebSocketMessage 创建新的WebSocket消息
@@ -80,6 +189,28 @@ func NewErrorMessage(code int, message string) *WebSocketMessage {
 	}
 }
 
+// NewRateLimitErrorInfo 创建限流错误信息（所有限流器统一使用此结构）
+func NewRateLimitErrorInfo(message string, retryAfter time.Duration) *ErrorInfo {
+	retryAfterMs := retryAfter.Milliseconds()
+	if retryAfterMs < 1 {
+		retryAfterMs = 1
+	}
+	return &ErrorInfo{
+		Code:         CodeRateLimited,
+		Message:      message,
+		RetryAfterMs: retryAfterMs,
+	}
+}
+
+// NewRateLimitMessage 创建限流错误消息
+func NewRateLimitMessage(message string, retryAfter time.Duration) *WebSocketMessage {
+	return &WebSocketMessage{
+		Type:      MessageTypeError,
+		Error:     NewRateLimitErrorInfo(message, retryAfter),
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
 // NewClient 创建新客户端
 func NewClient(id, userID string, conn interface{}) *Client {
 	return &Client{
@@ -87,18 +218,25 @@ func NewClient(id, userID string, conn interface{}) *Client {
 		UserID:     userID,
 		Connection: conn,
 		Rooms:      make(map[string]bool),
-		Events:     make(map[string]bool),
+		Events:     make(map[string]map[string]bool),
 		LastPing:   time.Now(),
 		Metadata:   make(map[string]interface{}),
+		Done:       make(chan struct{}),
+
+		ProtocolVersion: ProtocolV1,
 	}
 }
 
 // NewRoom 创建新房间
-func NewRoom(name string) *Room {
+func NewRoom(name, owner string) *Room {
 	return &Room{
-		Name:      name,
-		ClientIDs: make(map[string]bool), // 改为存储客户端ID
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Name:        name,
+		DisplayName: name,
+		Owner:       owner,
+		Policy:      RoomPolicyEventFiltered,
+		Delivery:    RoomDeliveryBestEffort,
+		ClientIDs:   make(map[string]bool), // 改为存储客户端ID
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
 	}
 }
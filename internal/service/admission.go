@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"letshare-server/internal/model"
+	"time"
+)
+
+// minAdmissionRetryAfter 连接名额已满时建议客户端等待的最短时间
+const minAdmissionRetryAfter = time.Second
+
+// 连接数超限时AdmitConnection返回的错误
+var (
+	ErrServerAtCapacity     = errors.New("服务器连接数已满，请稍后重试或连接其他实例")
+	ErrTooManyConnectionsIP = errors.New("该IP的连接数已达上限")
+)
+
+// AdmitConnection 在升级前占用一个连接名额，总连接数或该IP的连接数已达上限时返回错误。
+// 成功后须调用ReleaseConnection（升级失败时）或在客户端移除时自动释放
+func (ws *WebSocketService) AdmitConnection(ip string) error {
+	ws.admissionMutex.Lock()
+	defer ws.admissionMutex.Unlock()
+
+	if ws.maxConnections > 0 && ws.admitted >= ws.maxConnections {
+		return ErrServerAtCapacity
+	}
+	if ws.maxConnectionsPerIP > 0 && ws.ipConnections[ip] >= ws.maxConnectionsPerIP {
+		return ErrTooManyConnectionsIP
+	}
+	ws.admitted++
+	ws.ipConnections[ip]++
+	return nil
+}
+
+// AdmissionRetryAfter 连接名额已满时建议客户端等待多久再重试：与server:shutdown通知的重连延迟一致，至少1秒
+func (ws *WebSocketService) AdmissionRetryAfter() time.Duration {
+	if ws.shutdownReconnectDelay < minAdmissionRetryAfter {
+		return minAdmissionRetryAfter
+	}
+	return ws.shutdownReconnectDelay
+}
+
+// ReleaseConnection 释放AdmitConnection占用的名额，IP的连接数归零时删除其记录，避免map随IP变化无限增长
+func (ws *WebSocketService) ReleaseConnection(ip string) {
+	ws.admissionMutex.Lock()
+	defer ws.admissionMutex.Unlock()
+
+	if ws.admitted > 0 {
+		ws.admitted--
+	}
+	if count, ok := ws.ipConnections[ip]; ok {
+		if count <= 1 {
+			delete(ws.ipConnections, ip)
+		} else {
+			ws.ipConnections[ip] = count - 1
+		}
+	}
+}
+
+// releaseClientConnection 客户端移除时释放其连接名额（未经AdmitConnection的客户端不处理）
+func (ws *WebSocketService) releaseClientConnection(client *model.Client) {
+	if client.Admitted {
+		ws.ReleaseConnection(client.IP)
+	}
+}
@@ -1,28 +1,58 @@
 package service
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"letshare-server/internal/config"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// DefaultAuthSecret 未配置SERVER_AUTH_SECRET时使用的公开默认密钥，仅适用于本地开发
+const DefaultAuthSecret = "sever_auth_123"
+
+// signedTokenPrefix 签名AuthToken的版本前缀，格式为 v1.<base64url(用户ID)>.<过期时间>.<token ID>.<HMAC>
+const signedTokenPrefix = "v1."
+
+// defaultAuthTokenTTL 未配置auth.token_ttl_seconds时签名AuthToken的有效期
+const defaultAuthTokenTTL = 24 * time.Hour
+
 type AuthService struct {
-	secretKey string
+	secretKey   string
+	ttl         time.Duration // 签名AuthToken的有效期
+	allowStatic bool          // 是否仍接受固定AuthToken
 }
 
-func NewAuthService() *AuthService {
+func NewAuthService(cfg config.Auth) *AuthService {
 	// 从环境变量获取密钥，默认值为 "sever_auth_123"
 	secretKey := os.Getenv("SERVER_AUTH_SECRET")
 	if secretKey == "" {
-		secretKey = "sever_auth_123"
+		secretKey = DefaultAuthSecret
+	}
+	ttl := time.Duration(cfg.TokenTTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = defaultAuthTokenTTL
 	}
 	
 	return &AuthService{
-		secretKey: secretKey,
+		secretKey:   secretKey,
+		ttl:         ttl,
+		allowStatic: cfg.AllowStaticToken,
 	}
 }
 
+// UsesDefaultSecret 当前密钥是否为公开的默认密钥
+func (a *AuthService) UsesDefaultSecret() bool {
+	return a.secretKey == DefaultAuthSecret
+}
+
 // GenerateAuthToken 生成基于密钥的固定认证token
 func (a *AuthService) GenerateAuthToken() (string, error) {
 	// 使用SHA256哈希生成固定的token
@@ -33,7 +63,10 @@ func (a *AuthService) GenerateAuthToken() (string, error) {
 // ValidateAuthToken 验证认证token
 func (a *AuthService) ValidateAuthToken(token string) error {
 	if token == "" {
-		return fmt.Errorf("token不能为空")
+		return fmt.Errorf("%w: token不能为空", ErrTokenFormat)
+	}
+	if !a.allowStatic {
+		return fmt.Errorf("%w: 已停用固定AuthToken，请使用签名AuthToken或JWT", ErrTokenMismatch)
 	}
 	
 	// 生成期望的token
@@ -44,8 +77,70 @@ func (a *AuthService) ValidateAuthToken(token string) error {
 	
 	// 直接比较token
 	if token != expectedToken {
-		return fmt.Errorf("token验证失败")
+		return ErrTokenMismatch
 	}
 	
 	return nil
-}
\ No newline at end of file
+}
+
+// IsSignedAuthToken 判断token是否为签名AuthToken格式
+func IsSignedAuthToken(token string) bool {
+	return strings.HasPrefix(token, signedTokenPrefix) && strings.Count(token, ".") == 4
+}
+
+// GenerateSignedToken 为指定用户签发签名AuthToken：用户ID、过期时间和随机token ID由HMAC-SHA256签名，
+// 密钥泄露前签发的token到期后失效，且每个token各不相同
+func (a *AuthService) GenerateSignedToken(userID string) (string, error) {
+	if userID == "" {
+		return "", fmt.Errorf("用户ID不能为空")
+	}
+	if err := ValidateUserID(userID); err != nil {
+		return "", err
+	}
+
+	return a.signedToken(userID, time.Now().Add(a.ttl).Unix())
+}
+
+// signedToken 生成带随机token ID、在expiresAt（Unix秒）过期的签名AuthToken
+func (a *AuthService) signedToken(userID string, expiresAt int64) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("生成token ID失败: %w", err)
+	}
+	unsigned := signedTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(userID)) + "." +
+		strconv.FormatInt(expiresAt, 10) + "." + hex.EncodeToString(id)
+	return unsigned + "." + a.sign(unsigned), nil
+}
+
+// ValidateSignedToken 验证签名AuthToken的签名和有效期，返回其中的用户ID和过期时间
+func (a *AuthService) ValidateSignedToken(token string) (*Claims, error) {
+	if !IsSignedAuthToken(token) {
+		return nil, ErrTokenFormat
+	}
+	split := strings.LastIndex(token, ".")
+	unsigned, signature := token[:split], token[split+1:]
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(a.sign(unsigned))) != 1 {
+		return nil, fmt.Errorf("%w: 签名无效", ErrTokenMismatch)
+	}
+
+	parts := strings.Split(unsigned, ".")
+	userID, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || len(userID) == 0 {
+		return nil, fmt.Errorf("%w: 用户ID无效", ErrTokenFormat)
+	}
+	expiresAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 过期时间无效", ErrTokenFormat)
+	}
+	if time.Now().Unix() >= expiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &Claims{UserID: string(userID), ExpiresAt: expiresAt}, nil
+}
+
+// sign 计算签名AuthToken的HMAC-SHA256（十六进制）
+func (a *AuthService) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, []byte(a.secretKey))
+	mac.Write([]byte(unsigned))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"letshare-server/internal/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 发送队列写满时的处理策略
+const (
+	OverflowDisconnect = "disconnect"  // 断开慢客户端（默认）
+	OverflowDropOldest = "drop_oldest" // 丢弃队列中最旧的消息，为新消息腾出位置
+	OverflowDropNewest = "drop_newest" // 丢弃新消息，保留已排队的消息
+)
+
+// ValidOverflowPolicy 策略名是否有效
+func ValidOverflowPolicy(policy string) bool {
+	switch policy {
+	case OverflowDisconnect, OverflowDropOldest, OverflowDropNewest:
+		return true
+	}
+	return false
+}
+
+// overflowPolicy 客户端生效的溢出策略：连接时指定的优先，否则使用全局配置
+func (ws *WebSocketService) overflowPolicy(client *model.Client) string {
+	if client.OverflowPolicy != "" {
+		return client.OverflowPolicy
+	}
+	return ws.sendOverflowPolicy
+}
+
+// handleSendOverflow 发送队列已满时按策略处理消息（调用前Pending已为该消息回退）
+func (ws *WebSocketService) handleSendOverflow(client *model.Client, message *model.WebSocketMessage) {
+	policy := ws.overflowPolicy(client)
+	if policy == OverflowDisconnect {
+		logrus.WithFields(logrus.Fields{
+			"client_id":   client.ID,
+			"buffer_size": cap(client.Send),
+		}).Warn("客户端发送队列已满，断开慢客户端")
+
+		ws.RemoveClient(client.ID, DisconnectSlowConsumer)
+		return
+	}
+
+	if policy == OverflowDropOldest {
+		// 先取出最旧的一条再放入新消息；写协程或其他发送方可能同时操作队列，失败时丢弃新消息
+		select {
+		case <-client.Send:
+			client.Pending.Add(-1)
+			ws.recordDrop(client)
+		default:
+		}
+		client.Pending.Add(1)
+		select {
+		case client.Send <- message:
+			if message.Type == model.MessageTypeError {
+				ws.errorsSent.Add(1)
+			}
+			return
+		default:
+			client.Pending.Add(-1)
+		}
+	}
+	ws.recordDrop(client)
+}
+
+// recordDrop 记录一条因队列溢出丢弃的消息，每个客户端首次丢弃时记录警告
+func (ws *WebSocketService) recordDrop(client *model.Client) {
+	ws.messagesDropped.Add(1)
+	if client.Dropped.Add(1) == 1 {
+		logrus.WithFields(logrus.Fields{
+			"client_id":   client.ID,
+			"buffer_size": cap(client.Send),
+			"policy":      ws.overflowPolicy(client),
+		}).Warn("客户端发送队列已满，开始丢弃消息")
+	}
+}
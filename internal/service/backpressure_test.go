@@ -0,0 +1,91 @@
+package service
+
+import (
+	"fmt"
+	"letshare-server/internal/config"
+	"letshare-server/internal/model"
+	"testing"
+)
+
+// fillSendQueue 向客户端发送count条事件为e1..eN的消息
+func fillSendQueue(ws *WebSocketService, client *model.Client, count int) {
+	for i := 1; i <= count; i++ {
+		ws.SendToClient(client, model.NewWebSocketMessage(model.MessageTypeMessage, "lobby", fmt.Sprintf("e%d", i), nil))
+	}
+}
+
+func TestSendOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		wantEvents []string
+	}{
+		{"drop_oldest丢弃最旧的消息", OverflowDropOldest, []string{"e3", "e4"}},
+		{"drop_newest丢弃新消息", OverflowDropNewest, []string{"e1", "e2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, SendBufferSize: 2, SendOverflowPolicy: tt.policy})
+			t.Cleanup(func() { ws.Shutdown("test") })
+			client := model.NewClient("c1", "alice", nil)
+			ws.AddClient(client)
+
+			fillSendQueue(ws, client, 4)
+
+			if _, online := ws.GetClient("c1"); !online {
+				t.Fatal("丢弃策略下不应断开客户端")
+			}
+			if client.Dropped.Load() != 2 || ws.GetCounters().MessagesDropped != 2 {
+				t.Fatalf("丢弃数 = %d（全局 %d）, want 2", client.Dropped.Load(), ws.GetCounters().MessagesDropped)
+			}
+			if client.Pending.Load() != 2 {
+				t.Fatalf("Pending = %d, want 2", client.Pending.Load())
+			}
+			if got := messageEvents(client); len(got) != 2 || got[0] != tt.wantEvents[0] || got[1] != tt.wantEvents[1] {
+				t.Fatalf("队列中的消息 = %v, want %v", got, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestSendOverflowDisconnect(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, SendBufferSize: 2})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	client := model.NewClient("c1", "alice", nil)
+	ws.AddClient(client)
+
+	fillSendQueue(ws, client, 3)
+	if _, online := ws.GetClient("c1"); online {
+		t.Fatal("默认策略下队列写满应断开客户端")
+	}
+	if got := ws.GetCounters().Disconnects[string(DisconnectSlowConsumer)]; got != 1 {
+		t.Fatalf("slow_consumer断开数 = %d, want 1", got)
+	}
+}
+
+func TestClientOverflowPolicyOverridesConfig(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, SendBufferSize: 1, SendOverflowPolicy: "bogus"})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	// 无效的全局配置回退为disconnect
+	if ws.sendOverflowPolicy != OverflowDisconnect {
+		t.Fatalf("全局策略 = %s, want disconnect", ws.sendOverflowPolicy)
+	}
+	client := model.NewClient("c1", "alice", nil)
+	client.OverflowPolicy = OverflowDropNewest
+	ws.AddClient(client)
+
+	fillSendQueue(ws, client, 3)
+	if _, online := ws.GetClient("c1"); !online || client.Dropped.Load() != 2 {
+		t.Fatalf("连接时指定的策略应优先: online=%v dropped=%d", online, client.Dropped.Load())
+	}
+
+	for _, policy := range []string{OverflowDisconnect, OverflowDropOldest, OverflowDropNewest} {
+		if !ValidOverflowPolicy(policy) {
+			t.Fatalf("%s应为有效策略", policy)
+		}
+	}
+	if ValidOverflowPolicy("drop_all") {
+		t.Fatal("drop_all不是有效策略")
+	}
+}
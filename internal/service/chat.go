@@ -0,0 +1,72 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"letshare-server/internal/model"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// chatHistoryEvent 聊天消息在房间历史中使用的事件名
+const chatHistoryEvent = "chat"
+
+// SendChat 向房间内其他所有成员转发文本聊天消息（不受事件订阅过滤），返回接收的连接数
+func (ws *WebSocketService) SendChat(clientID, roomName, text string) (int, error) {
+	roomName = ws.roomService.NormalizeRoomName(roomName)
+	client, exists := ws.GetClient(clientID)
+	if !exists {
+		return 0, fmt.Errorf("客户端不存在")
+	}
+
+	if text == "" {
+		return 0, fmt.Errorf("聊天内容不能为空")
+	}
+	if ws.chatMaxLength > 0 && utf8.RuneCountInString(text) > ws.chatMaxLength {
+		return 0, fmt.Errorf("聊天内容过长，最多%d个字符", ws.chatMaxLength)
+	}
+
+	room, memberIDs, err := ws.memberSnapshot(client, roomName)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"from":      client.UserID,
+		"text":      text,
+		"timestamp": time.Now().UnixMilli(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("序列化聊天消息失败: %w", err)
+	}
+	message := model.NewWebSocketMessage(model.MessageTypeChat, room.DisplayName, "", json.RawMessage(data))
+
+	count := 0
+	for _, memberID := range memberIDs {
+		member, exists := ws.GetClient(memberID)
+		if !exists {
+			continue
+		}
+		ws.sendToClient(member, message)
+		count++
+	}
+
+	if room.Delivery == model.RoomDeliveryBuffered {
+		ws.bufferForSessions(roomName, message, nil)
+	}
+
+	ws.messagesPublished.Add(1)
+	ws.messagesDelivered.Add(int64(count))
+	ws.recordHistory(roomName, model.MessageTypeChat, chatHistoryEvent, data)
+
+	logrus.WithFields(logrus.Fields{
+		"client_id":  clientID,
+		"user_id":    client.UserID,
+		"room":       roomName,
+		"recipients": count,
+	}).Debug("聊天消息已转发")
+
+	return count, nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"encoding/json"
+	"letshare-server/internal/config"
+	"letshare-server/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestSendChat(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, ChatMaxLength: 5})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	alice := joinRoom(t, ws, "a", "alice", "lobby")
+	bob := model.NewClient("b", "bob", nil)
+	ws.AddClient(bob)
+	// chat消息不受事件订阅过滤
+	if _, err := ws.SubscribeToRoom("b", "lobby", "signal:offer", false); err != nil {
+		t.Fatal(err)
+	}
+	presenceEvents(t, alice)
+
+	count, err := ws.SendChat("a", "lobby", "你好")
+	if err != nil || count != 1 {
+		t.Fatalf("SendChat() = (%d, %v), want (1, nil)", count, err)
+	}
+	var chat *model.WebSocketMessage
+	for len(bob.Send) > 0 {
+		if message := <-bob.Send; message.Type == model.MessageTypeChat {
+			chat = message
+		}
+	}
+	if chat == nil || chat.Channel != "lobby" {
+		t.Fatalf("bob应收到lobby的chat消息: %+v", chat)
+	}
+	var data struct {
+		From string `json:"from"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(chat.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.From != "alice" || data.Text != "你好" {
+		t.Fatalf("chat数据 = %+v, want from=alice text=你好", data)
+	}
+	// 发送者自己不会收到
+	if len(alice.Send) != 0 {
+		t.Fatalf("发送者收到了 %d 条消息", len(alice.Send))
+	}
+
+	tests := []struct {
+		name     string
+		clientID string
+		room     string
+		text     string
+	}{
+		{"空内容", "a", "lobby", ""},
+		{"按字符数超过上限", "a", "lobby", strings.Repeat("字", 6)},
+		{"未订阅房间", "a", "other", "hi"},
+		{"客户端不存在", "nobody", "lobby", "hi"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ws.SendChat(tt.clientID, tt.room, tt.text); err == nil {
+				t.Fatal("SendChat() error = nil, want error")
+			}
+		})
+	}
+	if _, err := ws.SendChat("a", "lobby", strings.Repeat("字", 5)); err != nil {
+		t.Fatalf("恰好达到上限的内容应允许: %v", err)
+	}
+}
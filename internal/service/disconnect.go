@@ -0,0 +1,157 @@
+package service
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// DisconnectReason 服务端主动断开客户端的原因
+type DisconnectReason string
+
+const (
+	DisconnectInactive     DisconnectReason = "inactive_timeout"
+	DisconnectKicked       DisconnectReason = "kicked"
+	DisconnectShutdown     DisconnectReason = "shutdown"
+	DisconnectMigrated     DisconnectReason = "migrated"
+	DisconnectTokenExpired DisconnectReason = "token_expired"
+	// 连接后超过subscribe_timeout_seconds仍未订阅任何房间
+	DisconnectSubscribeTimeout DisconnectReason = "subscribe_timeout"
+	// 会话被携带恢复令牌的新连接接管
+	DisconnectDisplaced DisconnectReason = "displaced"
+	// 开启close_on_protocol_errors时，客户端发送的消息违反协议
+	DisconnectUnsupportedType DisconnectReason = "unsupported_type"
+	DisconnectMissingChannel  DisconnectReason = "missing_channel"
+	DisconnectMessageTooBig   DisconnectReason = "message_too_big"
+
+	// 以下原因由客户端行为或连接自身的读写结果决定
+	DisconnectClientClose  DisconnectReason = "client_close"
+	DisconnectReadError    DisconnectReason = "read_error"
+	DisconnectWriteError   DisconnectReason = "write_error"
+	DisconnectSlowConsumer DisconnectReason = "slow_consumer"
+)
+
+// disconnectReasons 所有断开原因，用于初始化计数器
+var disconnectReasons = []DisconnectReason{
+	DisconnectInactive,
+	DisconnectKicked,
+	DisconnectShutdown,
+	DisconnectMigrated,
+	DisconnectTokenExpired,
+	DisconnectSubscribeTimeout,
+	DisconnectDisplaced,
+	DisconnectUnsupportedType,
+	DisconnectMissingChannel,
+	DisconnectMessageTooBig,
+	DisconnectClientClose,
+	DisconnectReadError,
+	DisconnectWriteError,
+	DisconnectSlowConsumer,
+}
+
+// disconnectCounters 按原因统计的断开次数，map在创建后只读，计数器为原子操作
+type disconnectCounters map[DisconnectReason]*atomic.Int64
+
+func newDisconnectCounters() disconnectCounters {
+	counters := make(disconnectCounters, len(disconnectReasons))
+	for _, reason := range disconnectReasons {
+		counters[reason] = new(atomic.Int64)
+	}
+	return counters
+}
+
+// record 记录一次断开，未知原因不计数
+func (c disconnectCounters) record(reason DisconnectReason) {
+	if counter, ok := c[reason]; ok {
+		counter.Add(1)
+	}
+}
+
+// snapshot 返回各原因的断开次数
+func (c disconnectCounters) snapshot() map[string]int64 {
+	result := make(map[string]int64, len(c))
+	for reason, counter := range c {
+		result[string(reason)] = counter.Load()
+	}
+	return result
+}
+
+// 应用自定义关闭码（4000-4999 为应用保留区间）
+const (
+	CloseInactiveTimeout  = 4000
+	CloseKicked           = 4001
+	CloseTokenExpired     = 4002
+	CloseSubscribeTimeout = 4003
+	CloseDisplaced        = 4004
+)
+
+// closeFrame 断开原因对应的WebSocket关闭码和说明
+type closeFrame struct {
+	code int
+	text string
+}
+
+var disconnectCloseFrames = map[DisconnectReason]closeFrame{
+	DisconnectInactive:         {code: CloseInactiveTimeout, text: "inactive timeout"},
+	DisconnectKicked:           {code: CloseKicked, text: "kicked"},
+	DisconnectShutdown:         {code: websocket.CloseGoingAway, text: "server shutdown"},
+	DisconnectMigrated:         {code: websocket.CloseServiceRestart, text: "server migrating"},
+	DisconnectTokenExpired:     {code: CloseTokenExpired, text: "token expired"},
+	DisconnectSubscribeTimeout: {code: CloseSubscribeTimeout, text: "subscribe timeout"},
+	DisconnectDisplaced:        {code: CloseDisplaced, text: "displaced"},
+	DisconnectUnsupportedType:  {code: websocket.CloseUnsupportedData, text: "unsupported message type"},
+	DisconnectMissingChannel:   {code: websocket.ClosePolicyViolation, text: "missing channel"},
+	DisconnectMessageTooBig:    {code: websocket.CloseMessageTooBig, text: "message too big"},
+	// 客户端通过disconnect消息主动断开时，由服务端有序清理并以正常关闭码关闭
+	DisconnectClientClose: {code: websocket.CloseNormalClosure, text: "client disconnect"},
+}
+
+// closeWriteTimeout 发送关闭帧的写超时
+const closeWriteTimeout = time.Second
+
+// CloseCode 返回断开原因对应的关闭码和说明
+func (r DisconnectReason) CloseCode() (int, string) {
+	if frame, ok := disconnectCloseFrames[r]; ok {
+		return frame.code, frame.text
+	}
+	return websocket.CloseNormalClosure, string(r)
+}
+
+// DisconnectClient 发送带原因的关闭帧后移除客户端
+func (ws *WebSocketService) DisconnectClient(clientID string, reason DisconnectReason) {
+	client, exists := ws.GetClient(clientID)
+	if !exists {
+		return
+	}
+
+	if conn, ok := client.Connection.(*websocket.Conn); ok {
+		code, text := reason.CloseCode()
+		writeCloseFrame(conn, code, text)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"client_id": clientID,
+		"reason":    reason,
+	}).Info("服务端主动断开客户端")
+
+	ws.RemoveClient(clientID, reason)
+}
+
+// KickClient 管理员踢出客户端：以CloseKicked关闭连接，不保留会话
+func (ws *WebSocketService) KickClient(clientID string) error {
+	if _, exists := ws.GetClient(clientID); !exists {
+		return ErrClientNotFound
+	}
+	ws.DisconnectClient(clientID, DisconnectKicked)
+	return nil
+}
+
+// writeCloseFrame 发送WebSocket关闭帧（WriteControl可与其他写操作并发调用）
+func writeCloseFrame(conn *websocket.Conn, code int, text string) {
+	message := websocket.FormatCloseMessage(code, text)
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeWriteTimeout)); err != nil {
+		logrus.WithError(err).Debug("发送关闭帧失败")
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"letshare-server/internal/config"
+	"letshare-server/internal/model"
+	"testing"
+)
+
+func TestDisconnectCountersByReason(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	disconnects := func() map[string]int64 {
+		return ws.GetStats()["disconnects"].(map[string]int64)
+	}
+	// 所有原因都以0初始化，便于监控系统按原因建立时间序列
+	initial := disconnects()
+	if len(initial) != len(disconnectReasons) {
+		t.Fatalf("断开原因数 = %d, want %d", len(initial), len(disconnectReasons))
+	}
+	for reason, count := range initial {
+		if count != 0 {
+			t.Fatalf("%s的初始计数 = %d, want 0", reason, count)
+		}
+	}
+
+	for _, id := range []string{"a", "b", "c"} {
+		ws.AddClient(model.NewClient(id, id, nil))
+	}
+	ws.RemoveClient("a", DisconnectKicked)
+	ws.RemoveClient("b", DisconnectKicked)
+	ws.DisconnectClient("c", DisconnectInactive)
+	// 重复移除和未知原因不计数
+	ws.RemoveClient("a", DisconnectKicked)
+	ws.AddClient(model.NewClient("d", "d", nil))
+	ws.RemoveClient("d", DisconnectReason("bogus"))
+
+	got := disconnects()
+	want := map[string]int64{string(DisconnectKicked): 2, string(DisconnectInactive): 1}
+	for reason, count := range got {
+		if count != want[reason] {
+			t.Fatalf("%s的计数 = %d, want %d（disconnects = %v）", reason, count, want[reason], got)
+		}
+	}
+	if _, ok := got["bogus"]; ok {
+		t.Fatal("未知原因不应出现在统计中")
+	}
+}
+
+func TestDisconnectReasonCloseCode(t *testing.T) {
+	tests := []struct {
+		reason   DisconnectReason
+		wantCode int
+	}{
+		{DisconnectInactive, CloseInactiveTimeout},
+		{DisconnectKicked, CloseKicked},
+		{DisconnectTokenExpired, CloseTokenExpired},
+		{DisconnectReadError, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.reason), func(t *testing.T) {
+			if code, text := tt.reason.CloseCode(); code != tt.wantCode || text == "" {
+				t.Fatalf("CloseCode() = (%d, %q), want (%d, 非空说明)", code, text, tt.wantCode)
+			}
+		})
+	}
+}
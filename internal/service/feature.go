@@ -0,0 +1,47 @@
+package service
+
+import (
+	"letshare-server/internal/config"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FeatureService 管理下发给客户端的功能开关，支持热更新
+type FeatureService struct {
+	mutex    sync.RWMutex
+	features config.Features
+}
+
+func NewFeatureService(features config.Features) *FeatureService {
+	return &FeatureService{
+		features: features,
+	}
+}
+
+// Update 替换当前的功能开关配置
+func (f *FeatureService) Update(features config.Features) {
+	f.mutex.Lock()
+	f.features = features
+	f.mutex.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"defaults":  len(features.Defaults),
+		"overrides": len(features.Overrides),
+	}).Info("功能开关已更新")
+}
+
+// Resolve 返回指定用户类型生效的功能开关（默认值叠加该类型的覆盖值）
+func (f *FeatureService) Resolve(userType string) map[string]interface{} {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	resolved := make(map[string]interface{}, len(f.features.Defaults))
+	for key, value := range f.features.Defaults {
+		resolved[key] = value
+	}
+	for key, value := range f.features.Overrides[userType] {
+		resolved[key] = value
+	}
+	return resolved
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"letshare-server/internal/model"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// roomLastActive 房间最近一次活动的时间：成员变化（UpdatedAt）或房间内发送消息（LastActivity）中较晚的一个
+func roomLastActive(room *model.Room) time.Time {
+	lastActive := room.UpdatedAt
+	if activity := room.LastActivity.Load(); activity > 0 {
+		if t := time.Unix(0, activity); t.After(lastActive) {
+			lastActive = t
+		}
+	}
+	return lastActive
+}
+
+// cleanupIdleRooms 关闭超过roomIdleTimeout没有活动的房间：移除所有成员并通知其房间已关闭，返回关闭的房间数
+func (ws *WebSocketService) cleanupIdleRooms() int {
+	if ws.roomIdleTimeout <= 0 {
+		return 0
+	}
+	cutoff := time.Now().Add(-ws.roomIdleTimeout)
+
+	ws.roomsMutex.RLock()
+	var idleRooms []string
+	for roomName, room := range ws.rooms {
+		if roomLastActive(room).Before(cutoff) {
+			idleRooms = append(idleRooms, roomName)
+		}
+	}
+	ws.roomsMutex.RUnlock()
+
+	closed := 0
+	for _, roomName := range idleRooms {
+		if ws.closeIdleRoom(roomName, cutoff) {
+			closed++
+		}
+	}
+	return closed
+}
+
+// closeIdleRoom 在锁内再次确认房间仍然空闲后删除房间，并向原成员发送room:idle_closed
+func (ws *WebSocketService) closeIdleRoom(roomName string, cutoff time.Time) bool {
+	ws.roomsMutex.Lock()
+	room, exists := ws.rooms[roomName]
+	// 收集期间房间可能已有新活动或已被删除
+	if !exists || !roomLastActive(room).Before(cutoff) {
+		ws.roomsMutex.Unlock()
+		return false
+	}
+
+	members := make([]*model.Client, 0, len(room.ClientIDs))
+	ws.clientsMutex.Lock()
+	for clientID := range room.ClientIDs {
+		if client, ok := ws.clients[clientID]; ok {
+			delete(client.Rooms, roomName)
+			delete(client.Events, roomName)
+			members = append(members, client)
+		}
+	}
+	ws.clientsMutex.Unlock()
+	ws.deleteRoomLocked(room)
+	displayName := room.DisplayName
+	idleFor := time.Since(roomLastActive(room))
+	ws.roomsMutex.Unlock()
+
+	for _, client := range members {
+		ws.sendToClient(client, model.NewWebSocketMessage(model.MessageTypeIdleClosed, displayName, "", map[string]interface{}{
+			"room":         displayName,
+			"idle_seconds": int64(idleFor.Seconds()),
+		}))
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"room":         roomName,
+		"members":      len(members),
+		"idle_seconds": int64(idleFor.Seconds()),
+	}).Info("关闭空闲房间")
+	return true
+}
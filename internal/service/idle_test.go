@@ -0,0 +1,67 @@
+package service
+
+import (
+	"letshare-server/internal/config"
+	"letshare-server/internal/model"
+	"testing"
+	"time"
+)
+
+// ageRoom 将房间的成员变化和消息活动时间都推到d之前
+func ageRoom(ws *WebSocketService, roomName string, d time.Duration) {
+	ws.roomsMutex.Lock()
+	defer ws.roomsMutex.Unlock()
+	room := ws.rooms[roomName]
+	room.UpdatedAt = time.Now().Add(-d)
+	room.LastActivity.Store(0)
+}
+
+func TestCleanupIdleRooms(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, RoomIdleTimeoutSeconds: 60})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	alice := joinRoom(t, ws, "a", "alice", "Idle")
+	joinRoom(t, ws, "b", "bob", "busy")
+	joinRoom(t, ws, "c", "carol", "chatty")
+	presenceEvents(t, alice)
+	ageRoom(ws, "idle", 2*time.Minute)
+	ageRoom(ws, "chatty", 2*time.Minute)
+	// 发送消息算作房间活动
+	if _, err := ws.PublishToRoom("c", "chatty", "signal:all", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if closed := ws.cleanupIdleRooms(); closed != 1 {
+		t.Fatalf("关闭的房间数 = %d, want 1", closed)
+	}
+	if ws.GetRoomInfo("idle") != nil {
+		t.Fatal("空闲房间应被删除")
+	}
+	for _, roomName := range []string{"busy", "chatty"} {
+		if ws.GetRoomInfo(roomName) == nil {
+			t.Fatalf("%s有近期活动，不应关闭", roomName)
+		}
+	}
+
+	// 原成员收到room:idle_closed，并且不再订阅该房间
+	message := <-alice.Send
+	if message.Type != model.MessageTypeIdleClosed || message.Channel != "Idle" {
+		t.Fatalf("收到的消息 = %+v, want Idle的room:idle_closed", message)
+	}
+	if subscriptions, _ := ws.GetClientSubscriptions("a"); len(subscriptions) != 0 {
+		t.Fatalf("关闭后客户端的订阅 = %v, want 空", subscriptions)
+	}
+	if _, online := ws.GetClient("a"); !online {
+		t.Fatal("关闭房间不应断开成员的连接")
+	}
+}
+
+func TestCleanupIdleRoomsDisabled(t *testing.T) {
+	ws := newPresenceTestService(t)
+	joinRoom(t, ws, "a", "alice", "lobby")
+	ageRoom(ws, "lobby", 24*time.Hour)
+
+	if closed := ws.cleanupIdleRooms(); closed != 0 || ws.GetRoomInfo("lobby") == nil {
+		t.Fatal("未配置room_idle_timeout_seconds时不关闭房间")
+	}
+}
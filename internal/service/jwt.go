@@ -0,0 +1,152 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"letshare-server/internal/config"
+	"strings"
+	"time"
+)
+
+// DefaultJWTSecret 未配置jwt.secret时使用的公开默认密钥，与配置默认值保持一致
+const DefaultJWTSecret = config.DefaultJWTSecret
+
+// jwtHeader HS256签名的固定JWT头部
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims JWT中携带的用户信息
+type Claims struct {
+	UserID    string `json:"user_id"`
+	UserType  string `json:"user_type,omitempty"`
+	RoomID    string `json:"room_id,omitempty"` // 非空时该token只能订阅此房间
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf,omitempty"` // 生效时间，0表示签发即生效
+}
+
+// JWTService 签发和验证HS256签名的JWT
+type JWTService struct {
+	secret     []byte
+	expiration time.Duration
+	leeway     int64 // 校验exp/nbf时容忍的时钟偏差（秒）
+}
+
+func NewJWTService(secret string, expirationHours, leewaySeconds int) *JWTService {
+	if secret == "" {
+		secret = DefaultJWTSecret
+	}
+	if leewaySeconds < 0 {
+		leewaySeconds = 0
+	}
+	return &JWTService{
+		secret:     []byte(secret),
+		expiration: time.Duration(expirationHours) * time.Hour,
+		leeway:     int64(leewaySeconds),
+	}
+}
+
+// UsesDefaultSecret 当前密钥是否为公开的默认密钥
+func (j *JWTService) UsesDefaultSecret() bool {
+	return string(j.secret) == DefaultJWTSecret
+}
+
+// IsJWT 判断token是否为JWT格式（三段以点分隔）
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// GenerateToken 签发JWT，roomID为空时不限制可订阅的房间
+func (j *JWTService) GenerateToken(userID, userType, roomID string) (string, error) {
+	if userID == "" {
+		return "", fmt.Errorf("用户ID不能为空")
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(Claims{
+		UserID:    userID,
+		UserType:  userType,
+		RoomID:    roomID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(j.expiration).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("序列化token失败: %w", err)
+	}
+
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + j.sign(unsigned), nil
+}
+
+// ValidateToken 验证JWT签名和有效期，返回其中的用户信息
+func (j *JWTService) ValidateToken(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenFormat
+	}
+	if err := checkHeader(parts[0]); err != nil {
+		return nil, err
+	}
+
+	expected := j.sign(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return nil, fmt.Errorf("%w: 签名无效", ErrTokenMismatch)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenFormat, err)
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTokenFormat, err)
+	}
+
+	now := time.Now().Unix()
+	if now >= claims.ExpiresAt+j.leeway {
+		return nil, ErrTokenExpired
+	}
+	if claims.NotBefore > 0 && now < claims.NotBefore-j.leeway {
+		return nil, ErrTokenNotYetValid
+	}
+	if claims.UserID == "" {
+		return nil, fmt.Errorf("%w: 缺少用户ID", ErrTokenFormat)
+	}
+	return &claims, nil
+}
+
+// checkHeader 解码JWT头部，只接受HS256签名（拒绝none等其他算法）
+func checkHeader(segment string) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTokenFormat, err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Typ string `json:"typ"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return fmt.Errorf("%w: %v", ErrTokenFormat, err)
+	}
+	if header.Alg != "HS256" {
+		return fmt.Errorf("%w: 不支持的token算法 %q", ErrTokenFormat, header.Alg)
+	}
+	if header.Typ != "" && header.Typ != "JWT" {
+		return fmt.Errorf("%w: 不支持的token类型 %q", ErrTokenFormat, header.Typ)
+	}
+	return nil
+}
+
+// EffectiveExpiry token实际失效的时间（Unix秒）：exp加上时钟偏差容忍，连接据此判断token是否过期
+func (j *JWTService) EffectiveExpiry(claims *Claims) int64 {
+	return claims.ExpiresAt + j.leeway
+}
+
+// sign 计算HS256签名
+func (j *JWTService) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, j.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signClaims 以指定声明签发token，便于构造过期、未生效等边界情况
+func signClaims(t *testing.T, j *JWTService, claims Claims) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + j.sign(unsigned)
+}
+
+func TestValidateToken(t *testing.T) {
+	j := NewJWTService("test-secret", 1, 0)
+	other := NewJWTService("other-secret", 1, 0)
+	now := time.Now().Unix()
+
+	valid := signClaims(t, j, Claims{UserID: "alice", ExpiresAt: now + 3600})
+	parts := strings.Split(valid, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"user_id":"mallory","exp":9999999999}`)) + "." + parts[2]
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"有效token", valid, nil},
+		{"其他密钥签名", signClaims(t, other, Claims{UserID: "alice", ExpiresAt: now + 3600}), ErrTokenMismatch},
+		{"篡改载荷", tampered, ErrTokenMismatch},
+		{"篡改签名", parts[0] + "." + parts[1] + ".AAAA", ErrTokenMismatch},
+		{"不是三段", "a.b", ErrTokenFormat},
+		{"不支持的算法", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "." + parts[2], ErrTokenFormat},
+		{"none算法无签名", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + ".", ErrTokenFormat},
+		{"头部不是JSON", base64.RawURLEncoding.EncodeToString([]byte(`HS256`)) + "." + parts[1] + "." + parts[2], ErrTokenFormat},
+		{"头部不是base64", "!!!." + parts[1] + "." + parts[2], ErrTokenFormat},
+		{"缺少用户ID", signClaims(t, j, Claims{ExpiresAt: now + 3600}), ErrTokenFormat},
+		{"已过期", signClaims(t, j, Claims{UserID: "alice", ExpiresAt: now - 60}), ErrTokenExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := j.ValidateToken(tt.token)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("ValidateToken() error = %v", err)
+				}
+				if claims.UserID != "alice" {
+					t.Fatalf("UserID = %q, want alice", claims.UserID)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTokenHeaderOrder(t *testing.T) {
+	j := NewJWTService("test-secret", 1, 0)
+	payload, err := json.Marshal(Claims{UserID: "alice", ExpiresAt: time.Now().Unix() + 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 其他库生成的头部字段顺序不同，只要算法是HS256就应接受
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"HS256"}`))
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	if _, err := j.ValidateToken(unsigned + "." + j.sign(unsigned)); err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+}
+
+func TestGenerateTokenRoundTrip(t *testing.T) {
+	j := NewJWTService("test-secret", 1, 0)
+	token, err := j.GenerateToken("alice", "mobile", "room-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := j.ValidateToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != "alice" || claims.UserType != "mobile" || claims.RoomID != "room-1" {
+		t.Fatalf("claims = %+v", claims)
+	}
+}
+
+func TestValidateTokenLeeway(t *testing.T) {
+	const leeway = 30
+	j := NewJWTService("test-secret", 1, leeway)
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name    string
+		claims  Claims
+		wantErr error
+	}{
+		{"过期但在容忍范围内", Claims{UserID: "alice", ExpiresAt: now - leeway + 5}, nil},
+		{"过期恰好达到容忍上限", Claims{UserID: "alice", ExpiresAt: now - leeway}, ErrTokenExpired},
+		{"过期超过容忍范围", Claims{UserID: "alice", ExpiresAt: now - leeway - 60}, ErrTokenExpired},
+		{"nbf在容忍范围内", Claims{UserID: "alice", ExpiresAt: now + 3600, NotBefore: now + leeway - 5}, nil},
+		{"nbf超过容忍范围", Claims{UserID: "alice", ExpiresAt: now + 3600, NotBefore: now + leeway + 60}, ErrTokenNotYetValid},
+		{"nbf已过", Claims{UserID: "alice", ExpiresAt: now + 3600, NotBefore: now - 10}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := j.ValidateToken(signClaims(t, j, tt.claims))
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("ValidateToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTokenWithoutLeeway(t *testing.T) {
+	j := NewJWTService("test-secret", 1, 0)
+	now := time.Now().Unix()
+
+	if _, err := j.ValidateToken(signClaims(t, j, Claims{UserID: "alice", ExpiresAt: now - 1})); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("未设置容忍时刚过期的token应被拒绝，got %v", err)
+	}
+	if _, err := j.ValidateToken(signClaims(t, j, Claims{UserID: "alice", ExpiresAt: now + 3600, NotBefore: now + 1})); !errors.Is(err, ErrTokenNotYetValid) {
+		t.Fatalf("未设置容忍时未生效的token应被拒绝，got %v", err)
+	}
+}
+
+func TestEffectiveExpiryIncludesLeeway(t *testing.T) {
+	j := NewJWTService("test-secret", 1, 30)
+	claims := &Claims{UserID: "alice", ExpiresAt: 1000}
+	if got := j.EffectiveExpiry(claims); got != 1030 {
+		t.Fatalf("EffectiveExpiry() = %d, want 1030", got)
+	}
+	if got := NewJWTService("test-secret", 1, -5).EffectiveExpiry(claims); got != 1000 {
+		t.Fatalf("负的容忍值应按0处理，EffectiveExpiry() = %d", got)
+	}
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fanoutBucketsMs 扇出耗时直方图的桶上界（毫秒），最后一个桶之外计入+Inf
+var fanoutBucketsMs = []float64{0.1, 0.5, 1, 5, 10, 50, 100, 500}
+
+// roomSizeTier 按房间人数划分的档位，用于区分不同规模房间的扇出耗时
+func roomSizeTier(size int) string {
+	switch {
+	case size <= 10:
+		return "small"
+	case size <= 50:
+		return "medium"
+	default:
+		return "large"
+	}
+}
+
+// latencyHistogram 单个档位的累积直方图
+type latencyHistogram struct {
+	counts []int64 // 与fanoutBucketsMs一一对应，最后多一个+Inf桶
+	count  int64
+	sumMs  float64
+}
+
+// fanoutLatency 按房间规模档位记录发布消息扇出耗时
+type fanoutLatency struct {
+	mutex sync.Mutex
+	tiers map[string]*latencyHistogram
+}
+
+func newFanoutLatency() *fanoutLatency {
+	return &fanoutLatency{tiers: make(map[string]*latencyHistogram)}
+}
+
+// observe 记录一次扇出耗时
+func (f *fanoutLatency) observe(roomSize int, elapsed time.Duration) {
+	ms := float64(elapsed) / float64(time.Millisecond)
+	tier := roomSizeTier(roomSize)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	histogram, ok := f.tiers[tier]
+	if !ok {
+		histogram = &latencyHistogram{counts: make([]int64, len(fanoutBucketsMs)+1)}
+		f.tiers[tier] = histogram
+	}
+
+	index := len(fanoutBucketsMs)
+	for i, bound := range fanoutBucketsMs {
+		if ms <= bound {
+			index = i
+			break
+		}
+	}
+	histogram.counts[index]++
+	histogram.count++
+	histogram.sumMs += ms
+}
+
+// snapshot 返回各档位的直方图，buckets为累计计数（le_x表示耗时不超过x毫秒的次数）
+func (f *fanoutLatency) snapshot() map[string]interface{} {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	result := make(map[string]interface{}, len(f.tiers))
+	for tier, histogram := range f.tiers {
+		buckets := make(map[string]int64, len(histogram.counts))
+		var cumulative int64
+		for i, count := range histogram.counts {
+			cumulative += count
+			if i < len(fanoutBucketsMs) {
+				buckets["le_"+strconv.FormatFloat(fanoutBucketsMs[i], 'f', -1, 64)] = cumulative
+			} else {
+				buckets["le_inf"] = cumulative
+			}
+		}
+		result[tier] = map[string]interface{}{
+			"count":   histogram.count,
+			"sum_ms":  histogram.sumMs,
+			"buckets": buckets,
+		}
+	}
+	return result
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoomSizeTier(t *testing.T) {
+	tests := []struct {
+		size int
+		want string
+	}{
+		{1, "small"},
+		{10, "small"},
+		{11, "medium"},
+		{50, "medium"},
+		{51, "large"},
+	}
+	for _, tt := range tests {
+		if got := roomSizeTier(tt.size); got != tt.want {
+			t.Fatalf("roomSizeTier(%d) = %s, want %s", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestFanoutLatencySnapshot(t *testing.T) {
+	latency := newFanoutLatency()
+	latency.observe(2, 200*time.Microsecond)
+	latency.observe(3, 3*time.Millisecond)
+	latency.observe(5, time.Second)
+	latency.observe(100, 50*time.Millisecond)
+
+	snapshot := latency.snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("档位数 = %d, want 2（没有记录的档位不出现）", len(snapshot))
+	}
+
+	small := snapshot["small"].(map[string]interface{})
+	if small["count"] != int64(3) || small["sum_ms"] != 1003.2 {
+		t.Fatalf("small = %v, want count=3 sum_ms=1003.2", small)
+	}
+	// 桶为累计计数
+	wantBuckets := map[string]int64{
+		"le_0.1": 0, "le_0.5": 1, "le_1": 1, "le_5": 2, "le_10": 2,
+		"le_50": 2, "le_100": 2, "le_500": 2, "le_inf": 3,
+	}
+	buckets := small["buckets"].(map[string]int64)
+	for bucket, want := range wantBuckets {
+		if buckets[bucket] != want {
+			t.Fatalf("%s = %d, want %d（buckets = %v）", bucket, buckets[bucket], want, buckets)
+		}
+	}
+
+	large := snapshot["large"].(map[string]interface{})
+	if large["buckets"].(map[string]int64)["le_50"] != 1 || large["buckets"].(map[string]int64)["le_10"] != 0 {
+		t.Fatalf("恰好等于桶上界的耗时应计入该桶: %v", large["buckets"])
+	}
+}
+
+func TestPublishRecordsFanoutLatency(t *testing.T) {
+	ws := newPresenceTestService(t)
+	joinRoom(t, ws, "a", "alice", "lobby")
+	joinRoom(t, ws, "b", "bob", "lobby")
+
+	if _, err := ws.PublishToRoom("a", "lobby", "signal:all", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	small, ok := ws.GetStats()["publish_fanout_latency_ms"].(map[string]interface{})["small"].(map[string]interface{})
+	if !ok || small["count"] != int64(1) {
+		t.Fatalf("发布后应记录一次扇出耗时: %v", ws.GetStats()["publish_fanout_latency_ms"])
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"letshare-server/internal/model"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Draining 服务是否处于迁移中（不再接受新连接）
+func (ws *WebSocketService) Draining() bool {
+	return ws.draining.Load()
+}
+
+// Migrate 通知所有客户端迁移到目标实例，截止时间后关闭仍未断开的连接，返回通知的客户端数
+func (ws *WebSocketService) Migrate(targetURL string, deadline time.Duration) int {
+	ws.draining.Store(true)
+
+	ws.clientsMutex.RLock()
+	clients := make([]*model.Client, 0, len(ws.clients))
+	for _, client := range ws.clients {
+		clients = append(clients, client)
+	}
+	ws.clientsMutex.RUnlock()
+
+	message := model.NewWebSocketMessage(model.MessageTypeMigrate, "", "", map[string]interface{}{
+		"url":         targetURL,
+		"deadline_ms": deadline.Milliseconds(),
+	})
+	for _, client := range clients {
+		ws.sendToClient(client, message)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"target":   targetURL,
+		"deadline": deadline,
+		"clients":  len(clients),
+	}).Info("已通知客户端迁移")
+
+	// 截止时间后关闭仍未迁移的连接（迁移期间不再接受新连接，只需处理已通知的客户端）
+	time.AfterFunc(deadline, func() {
+		remaining := 0
+		for _, client := range clients {
+			if _, exists := ws.GetClient(client.ID); exists {
+				ws.DisconnectClient(client.ID, DisconnectMigrated)
+				remaining++
+			}
+		}
+		logrus.WithField("remaining", remaining).Info("迁移截止，已关闭未迁移的连接")
+	})
+
+	return len(clients)
+}
+
+// drainPollInterval WaitDrained检查剩余连接数的间隔
+const drainPollInterval = 100 * time.Millisecond
+
+// WaitDrained 等待所有客户端断开，最多等待timeout；返回是否已全部断开
+func (ws *WebSocketService) WaitDrained(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for ws.connectionCount.Load() > 0 {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"encoding/json"
+	"letshare-server/internal/config"
+	"letshare-server/internal/model"
+	"testing"
+	"time"
+)
+
+func TestWaitDrained(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	ws.AddClient(model.NewClient("c1", "alice", nil))
+
+	if ws.WaitDrained(50 * time.Millisecond) {
+		t.Fatal("仍有连接时不应返回已断开")
+	}
+
+	time.AfterFunc(50*time.Millisecond, func() { ws.RemoveClient("c1", DisconnectMigrated) })
+	start := time.Now()
+	if !ws.WaitDrained(5 * time.Second) {
+		t.Fatal("连接全部断开后应返回true")
+	}
+	// 连接断开后即返回，不等满超时
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("等待了%v，应在连接断开后立即返回", elapsed)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	stays := model.NewClient("c1", "alice", nil)
+	leaves := model.NewClient("c2", "bob", nil)
+	ws.AddClient(stays)
+	ws.AddClient(leaves)
+
+	if notified := ws.Migrate("wss://other.example/ws", 100*time.Millisecond); notified != 2 {
+		t.Fatalf("通知的客户端数 = %d, want 2", notified)
+	}
+	if !ws.Draining() {
+		t.Fatal("迁移开始后应拒绝新连接")
+	}
+
+	// 每个客户端收到带目标地址和截止时间的migrate消息
+	for _, client := range []*model.Client{stays, leaves} {
+		message := <-client.Send
+		var data struct {
+			URL        string `json:"url"`
+			DeadlineMs int64  `json:"deadline_ms"`
+		}
+		if err := json.Unmarshal(message.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		if message.Type != model.MessageTypeMigrate || data.URL != "wss://other.example/ws" || data.DeadlineMs != 100 {
+			t.Fatalf("migrate消息 = %s %+v", message.Type, data)
+		}
+	}
+
+	// 截止时间后关闭仍未断开的连接
+	ws.RemoveClient(leaves.ID, DisconnectClientClose)
+	if !ws.WaitDrained(5 * time.Second) {
+		t.Fatal("截止时间后应关闭未迁移的连接")
+	}
+	if _, exists := ws.GetClient(stays.ID); exists {
+		t.Fatal("未迁移的客户端应被移除")
+	}
+}
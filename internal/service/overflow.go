@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// 房间已满时建议备选房间的策略
+const (
+	RoomSuggestionNone          = ""               // 不提供建议，只返回普通错误
+	RoomSuggestionNumericSuffix = "numeric_suffix" // 在房间名后追加 -2、-3 等数字后缀
+)
+
+// maxRoomSuggestions 单次最多建议的备选房间数
+const maxRoomSuggestions = 3
+
+// maxSuffixAttempts 查找未满的备选房间时最多尝试的后缀数
+const maxSuffixAttempts = 20
+
+// maxRoomNameLength 房间名的最大字符数（与ValidateRoomName一致）
+const maxRoomNameLength = 12
+
+// RoomFullError 房间已满，开启建议时携带可以加入的备选房间名
+type RoomFullError struct {
+	Room        string
+	MaxUsers    int
+	Suggestions []string
+}
+
+func (e *RoomFullError) Error() string {
+	return fmt.Sprintf("房间已满，最多支持%d个用户", e.MaxUsers)
+}
+
+// roomSuggestions 按配置的策略为已满的房间生成备选房间名（调用时须持有roomsMutex）
+func (ws *WebSocketService) roomSuggestions(displayName string) []string {
+	if ws.roomFullSuggestions != RoomSuggestionNumericSuffix {
+		return nil
+	}
+
+	base := []rune(displayName)
+	suggestions := make([]string, 0, maxRoomSuggestions)
+	for n := 2; n < 2+maxSuffixAttempts && len(suggestions) < maxRoomSuggestions; n++ {
+		// 超出房间名长度限制时截短原名，保证后缀完整
+		suffix := "-" + strconv.Itoa(n)
+		prefix := base
+		if room := maxRoomNameLength - len(suffix); len(prefix) > room {
+			prefix = prefix[:room]
+		}
+		candidate := string(prefix) + suffix
+		if ws.roomService.ValidateRoomName(candidate) != nil {
+			continue
+		}
+
+		// 已存在且已满的房间不作为建议
+		if room, exists := ws.rooms[ws.roomService.NormalizeRoomName(candidate)]; exists && len(room.ClientIDs) >= room.MaxUsers {
+			continue
+		}
+		suggestions = append(suggestions, candidate)
+	}
+	return suggestions
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+	"letshare-server/internal/config"
+	"letshare-server/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestRoomFullSuggestions(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 1, RoomFullSuggestions: RoomSuggestionNumericSuffix})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	joinRoom(t, ws, "a", "alice", "Lobby")
+	joinRoom(t, ws, "b", "bob", "lobby-2")
+	joinRoom(t, ws, "c", "carol", "abcdefghijkl")
+	ws.AddClient(model.NewClient("d", "dave", nil))
+
+	tests := []struct {
+		name string
+		room string
+		want []string
+	}{
+		{"跳过已满的备选房间", "Lobby", []string{"Lobby-3", "Lobby-4", "Lobby-5"}},
+		{"超长时截短原名保留后缀", "abcdefghijkl", []string{"abcdefghij-2", "abcdefghij-3", "abcdefghij-4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ws.SubscribeToRoom("d", tt.room, "", false)
+			var fullErr *RoomFullError
+			if !errors.As(err, &fullErr) {
+				t.Fatalf("SubscribeToRoom() error = %v, want RoomFullError", err)
+			}
+			if fullErr.MaxUsers != 1 || !reflect.DeepEqual(fullErr.Suggestions, tt.want) {
+				t.Fatalf("RoomFullError = %+v, want suggestions %v", fullErr, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoomFullWithoutSuggestions(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 1})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	joinRoom(t, ws, "a", "alice", "lobby")
+	ws.AddClient(model.NewClient("b", "bob", nil))
+
+	_, err := ws.SubscribeToRoom("b", "lobby", "", false)
+	var fullErr *RoomFullError
+	if !errors.As(err, &fullErr) || fullErr.Suggestions != nil {
+		t.Fatalf("SubscribeToRoom() error = %+v, want 不带建议的RoomFullError", err)
+	}
+}
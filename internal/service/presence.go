@@ -0,0 +1,49 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GetPresence 返回客户端所在房间当前的权威成员列表（房间展示名 -> 成员用户ID，含自己），
+// 供重连后与本地视图比对、修正遗漏的加入/离开事件；roomName非空时只返回该房间
+func (ws *WebSocketService) GetPresence(clientID, roomName string) (map[string][]string, error) {
+	client, exists := ws.GetClient(clientID)
+	if !exists {
+		return nil, fmt.Errorf("客户端不存在")
+	}
+	if roomName != "" {
+		roomName = ws.roomService.NormalizeRoomName(roomName)
+	}
+
+	// 锁顺序与leaveRoom一致：先rooms后clients
+	ws.roomsMutex.RLock()
+	defer ws.roomsMutex.RUnlock()
+	ws.clientsMutex.RLock()
+	defer ws.clientsMutex.RUnlock()
+
+	presence := make(map[string][]string, len(client.Rooms))
+	for name := range client.Rooms {
+		if roomName != "" && name != roomName {
+			continue
+		}
+		room, exists := ws.rooms[name]
+		if !exists || !room.ClientIDs[clientID] {
+			continue
+		}
+		// 同一用户的多个连接各占一项，与presence消息中的room_size一致
+		members := make([]string, 0, len(room.ClientIDs))
+		for memberID := range room.ClientIDs {
+			if member, exists := ws.clients[memberID]; exists {
+				members = append(members, member.UserID)
+			}
+		}
+		sort.Strings(members)
+		presence[room.DisplayName] = members
+	}
+
+	if roomName != "" && len(presence) == 0 {
+		return nil, fmt.Errorf("客户端未订阅房间: %s", roomName)
+	}
+	return presence, nil
+}
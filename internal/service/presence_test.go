@@ -0,0 +1,154 @@
+package service
+
+import (
+	"encoding/json"
+	"letshare-server/internal/config"
+	"letshare-server/internal/model"
+	"reflect"
+	"testing"
+)
+
+// newPresenceTestService 创建用于成员事件测试的服务
+func newPresenceTestService(t *testing.T) *WebSocketService {
+	t.Helper()
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	return ws
+}
+
+// joinRoom 添加客户端并订阅房间
+func joinRoom(t *testing.T, ws *WebSocketService, id, userID, roomName string) *model.Client {
+	t.Helper()
+	client := model.NewClient(id, userID, nil)
+	ws.AddClient(client)
+	if _, err := ws.SubscribeToRoom(id, roomName, "signal:all", false); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// presenceEvents 取出客户端发送队列中已有的presence消息，返回事件和其中的user_id
+func presenceEvents(t *testing.T, client *model.Client) [][2]string {
+	t.Helper()
+	var events [][2]string
+	for {
+		select {
+		case message := <-client.Send:
+			if message.Type != model.MessageTypePresence {
+				continue
+			}
+			var data struct {
+				UserID string `json:"user_id"`
+			}
+			if err := json.Unmarshal(message.Data, &data); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, [2]string{message.Event, data.UserID})
+		default:
+			return events
+		}
+	}
+}
+
+func TestPublishSkipsDisconnectingMember(t *testing.T) {
+	ws := newPresenceTestService(t)
+	alice := joinRoom(t, ws, "a", "alice", "lobby")
+	bob := joinRoom(t, ws, "b", "bob", "lobby")
+	presenceEvents(t, alice)
+
+	// 模拟RemoveClient已将bob移出clients、尚未清理房间的时刻
+	ws.clientsMutex.Lock()
+	delete(ws.clients, bob.ID)
+	ws.clientsMutex.Unlock()
+
+	if _, err := ws.PublishToRoom(alice.ID, "lobby", "signal:all", json.RawMessage(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if events := presenceEvents(t, alice); len(events) != 0 {
+		t.Fatalf("发布时不应代替断开流程发送离开事件: %v", events)
+	}
+
+	// 断开流程随后发送带userId的离开事件
+	ws.cleanupClientResources(bob, DisconnectClientClose)
+	events := presenceEvents(t, alice)
+	if len(events) != 1 || events[0] != [2]string{model.PresenceLeave, "bob"} {
+		t.Fatalf("presence = %v, want [[%s bob]]", events, model.PresenceLeave)
+	}
+}
+
+func TestPresenceJoinAndLeave(t *testing.T) {
+	ws := newPresenceTestService(t)
+	alice := joinRoom(t, ws, "a", "alice", "lobby")
+	if events := presenceEvents(t, alice); len(events) != 0 {
+		t.Fatalf("加入者自己不应收到加入事件: %v", events)
+	}
+
+	bob := joinRoom(t, ws, "b", "bob", "lobby")
+	if events := presenceEvents(t, alice); len(events) != 1 || events[0] != [2]string{model.PresenceJoin, "bob"} {
+		t.Fatalf("presence = %v, want [[%s bob]]", events, model.PresenceJoin)
+	}
+
+	// 重复订阅（追加事件）不再触发加入事件
+	if _, err := ws.SubscribeToRoom(bob.ID, "lobby", "signal:offer", false); err != nil {
+		t.Fatal(err)
+	}
+	if events := presenceEvents(t, alice); len(events) != 0 {
+		t.Fatalf("追加事件订阅不应触发presence: %v", events)
+	}
+
+	// 退订和断开都通知剩余成员
+	carol := joinRoom(t, ws, "c", "carol", "lobby")
+	presenceEvents(t, alice)
+	presenceEvents(t, bob)
+	if err := ws.UnsubscribeFromRoom(bob.ID, "lobby", ""); err != nil {
+		t.Fatal(err)
+	}
+	ws.RemoveClient(carol.ID, DisconnectClientClose)
+	events := presenceEvents(t, alice)
+	want := [][2]string{{model.PresenceLeave, "bob"}, {model.PresenceLeave, "carol"}}
+	if len(events) != len(want) || events[0] != want[0] || events[1] != want[1] {
+		t.Fatalf("presence = %v, want %v", events, want)
+	}
+	if events := presenceEvents(t, bob); len(events) != 0 {
+		t.Fatalf("已离开的成员不应再收到presence: %v", events)
+	}
+}
+
+func TestGetPresence(t *testing.T) {
+	ws := newPresenceTestService(t)
+	joinRoom(t, ws, "a1", "alice", "Lobby")
+	joinRoom(t, ws, "a2", "alice", "lobby")
+	joinRoom(t, ws, "b", "bob", "lobby")
+	if _, err := ws.SubscribeToRoom("a1", "Other", "", false); err != nil {
+		t.Fatal(err)
+	}
+	joinRoom(t, ws, "c", "carol", "secret")
+
+	presence, err := ws.GetPresence("a1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 以展示名为键，同一用户的多个连接各占一项，不包含未加入的房间
+	want := map[string][]string{"Lobby": {"alice", "alice", "bob"}, "Other": {"alice"}}
+	if !reflect.DeepEqual(presence, want) {
+		t.Fatalf("GetPresence() = %v, want %v", presence, want)
+	}
+
+	presence, err = ws.GetPresence("b", "LOBBY")
+	if err != nil || len(presence) != 1 || len(presence["Lobby"]) != 3 {
+		t.Fatalf("指定房间的GetPresence() = (%v, %v), want 只有Lobby", presence, err)
+	}
+
+	// 断开的成员立即从列表中消失
+	ws.RemoveClient("a2", DisconnectKicked)
+	if presence, _ := ws.GetPresence("b", "lobby"); !reflect.DeepEqual(presence["Lobby"], []string{"alice", "bob"}) {
+		t.Fatalf("断开后的成员 = %v, want [alice bob]", presence["Lobby"])
+	}
+
+	if _, err := ws.GetPresence("b", "secret"); err == nil {
+		t.Fatal("未加入的房间应返回错误")
+	}
+	if _, err := ws.GetPresence("nobody", ""); err == nil {
+		t.Fatal("不存在的客户端应返回错误")
+	}
+}
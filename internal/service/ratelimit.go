@@ -0,0 +1,170 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimitWarnInterval 同一客户端限流告警日志的最小间隔
+const rateLimitWarnInterval = time.Second
+
+// tokenBucket 单个客户端的令牌桶
+type tokenBucket struct {
+	tokens   float64
+	last     time.Time
+	lastWarn time.Time
+}
+
+// publishLimiter 按客户端ID限制publish消息速率的令牌桶限流器
+type publishLimiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+	rate    float64 // 每秒补充的令牌数
+	burst   float64 // 桶容量
+	now     func() time.Time
+}
+
+func newPublishLimiter(rate float64, burst int) *publishLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &publishLimiter{
+		buckets: make(map[string]*tokenBucket),
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+	}
+}
+
+// allow 尝试消耗一个令牌；被限流时返回建议的等待时间，以及本次是否应记录告警日志
+func (l *publishLimiter) allow(clientID string) (allowed bool, retryAfter time.Duration, warn bool) {
+	if l.rate <= 0 {
+		return true, 0, false
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	bucket, exists := l.buckets[clientID]
+	if !exists {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[clientID] = bucket
+	}
+
+	// 按流逝时间补充令牌
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.rate
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0, false
+	}
+
+	retryAfter = time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	if now.Sub(bucket.lastWarn) >= rateLimitWarnInterval {
+		bucket.lastWarn = now
+		warn = true
+	}
+	return false, retryAfter, warn
+}
+
+// remove 清理已断开客户端的令牌桶
+func (l *publishLimiter) remove(clientID string) {
+	l.mutex.Lock()
+	delete(l.buckets, clientID)
+	l.mutex.Unlock()
+}
+
+// pruneFull 清理已补满的令牌桶（与不存在等价），按IP限流时避免随来访IP无限增长
+func (l *publishLimiter) pruneFull() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RateLimitState 单个限流器的当前状态（令牌数已按流逝时间补充）
+type RateLimitState struct {
+	Tokens        float64 `json:"tokens"`
+	Burst         float64 `json:"burst"`
+	RatePerSecond float64 `json:"rate_per_second"`
+	Enabled       bool    `json:"enabled"`
+}
+
+// state 返回客户端当前的令牌状态，不消耗令牌；尚未发布过消息的客户端视为满桶
+func (l *publishLimiter) state(clientID string) RateLimitState {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	state := RateLimitState{
+		Tokens:        l.burst,
+		Burst:         l.burst,
+		RatePerSecond: l.rate,
+		Enabled:       l.rate > 0,
+	}
+	if bucket, exists := l.buckets[clientID]; exists {
+		tokens := bucket.tokens + l.now().Sub(bucket.last).Seconds()*l.rate
+		if tokens < l.burst {
+			state.Tokens = tokens
+		}
+	}
+	return state
+}
+
+// reset 将客户端的令牌桶恢复为满桶
+func (l *publishLimiter) reset(clientID string) {
+	l.remove(clientID)
+}
+
+// globalLimiter 全服务器共享的publish令牌桶，用GCRA算法以单个原子变量（理论到达时间）实现，无需加锁
+type globalLimiter struct {
+	interval int64 // 每个令牌的间隔（纳秒）
+	burst    int64 // 允许的突发量对应的时间（纳秒）
+	tat      atomic.Int64
+	now      func() time.Time
+}
+
+func newGlobalLimiter(ratePerSecond int) *globalLimiter {
+	if ratePerSecond <= 0 {
+		return nil
+	}
+	interval := int64(time.Second) / int64(ratePerSecond)
+	return &globalLimiter{
+		interval: interval,
+		// 桶容量为一秒的配额
+		burst: interval * int64(ratePerSecond),
+		now:   time.Now,
+	}
+}
+
+// allow 尝试消耗一个全局令牌，被限流时返回建议的等待时间；limiter为nil表示不限流
+func (l *globalLimiter) allow() (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	now := l.now().UnixNano()
+	for {
+		previous := l.tat.Load()
+		tat := previous
+		if tat < now {
+			tat = now
+		}
+		next := tat + l.interval
+		if wait := next - now - l.burst; wait > 0 {
+			return false, time.Duration(wait)
+		}
+		if l.tat.CompareAndSwap(previous, next) {
+			return true, 0
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"errors"
+	"letshare-server/internal/config"
+	"letshare-server/internal/model"
+	"testing"
+	"time"
+)
+
+func TestPublishLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newPublishLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	// 满桶时允许burst条
+	for i := 0; i < 3; i++ {
+		if allowed, _, _ := limiter.allow("c1"); !allowed {
+			t.Fatalf("第%d条应被允许", i+1)
+		}
+	}
+	allowed, retryAfter, warn := limiter.allow("c1")
+	if allowed || retryAfter != 500*time.Millisecond || !warn {
+		t.Fatalf("allow() = (%v, %v, %v), want (false, 500ms, true)", allowed, retryAfter, warn)
+	}
+	// 一秒内只告警一次
+	if _, _, warn := limiter.allow("c1"); warn {
+		t.Fatal("告警日志应限频")
+	}
+	// 其他客户端不受影响
+	if allowed, _, _ := limiter.allow("c2"); !allowed {
+		t.Fatal("不同客户端的令牌桶应独立")
+	}
+
+	// 按流逝时间补充令牌
+	now = now.Add(500 * time.Millisecond)
+	if allowed, _, _ := limiter.allow("c1"); !allowed {
+		t.Fatal("补充一个令牌后应被允许")
+	}
+
+	limiter.reset("c1")
+	if state := limiter.state("c1"); state.Tokens != 3 || !state.Enabled {
+		t.Fatalf("重置后应为满桶: %+v", state)
+	}
+}
+
+func TestPublishLimiterDisabled(t *testing.T) {
+	limiter := newPublishLimiter(0, 0)
+	for i := 0; i < 100; i++ {
+		if allowed, _, _ := limiter.allow("c1"); !allowed {
+			t.Fatal("rate为0时不限流")
+		}
+	}
+	if limiter.state("c1").Enabled {
+		t.Fatal("rate为0时限流器应为未启用")
+	}
+}
+
+func TestPublishLimiterPruneFull(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := newPublishLimiter(1, 2)
+	limiter.now = func() time.Time { return now }
+
+	limiter.allow("10.0.0.1")
+	limiter.allow("10.0.0.1")
+	limiter.allow("10.0.0.2")
+
+	// 一秒后10.0.0.2已补满，10.0.0.1还差一个令牌
+	now = now.Add(time.Second)
+	limiter.pruneFull()
+	if _, exists := limiter.buckets["10.0.0.2"]; exists {
+		t.Fatal("已补满的令牌桶应被清理")
+	}
+	if _, exists := limiter.buckets["10.0.0.1"]; !exists {
+		t.Fatal("未补满的令牌桶不应被清理")
+	}
+}
+
+func TestRateLimitStateAndReset(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, PublishRatePerSecond: 0.001, PublishBurst: 2})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	client := model.NewClient("c1", "alice", nil)
+	ws.AddClient(client)
+
+	for i := 0; i < 2; i++ {
+		if _, err := ws.AllowPublish(client); err != nil {
+			t.Fatalf("第%d条应被允许: %v", i+1, err)
+		}
+	}
+	if _, err := ws.AllowPublish(client); !errors.Is(err, ErrPublishRateLimited) {
+		t.Fatalf("AllowPublish() error = %v, want ErrPublishRateLimited", err)
+	}
+
+	state, err := ws.GetRateLimitState("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish := state["publish"]
+	if publish.Tokens >= 1 || publish.Burst != 2 || !publish.Enabled {
+		t.Fatalf("publish状态 = %+v, want 令牌耗尽 burst=2", publish)
+	}
+
+	if err := ws.ResetRateLimit("c1"); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := ws.GetRateLimitState("c1"); state["publish"].Tokens != 2 {
+		t.Fatalf("重置后令牌数 = %v, want 2", state["publish"].Tokens)
+	}
+	if _, err := ws.AllowPublish(client); err != nil {
+		t.Fatalf("重置后应允许发布: %v", err)
+	}
+
+	if _, err := ws.GetRateLimitState("nobody"); !errors.Is(err, ErrClientNotFound) {
+		t.Fatalf("GetRateLimitState() error = %v, want ErrClientNotFound", err)
+	}
+	if err := ws.ResetRateLimit("nobody"); !errors.Is(err, ErrClientNotFound) {
+		t.Fatalf("ResetRateLimit() error = %v, want ErrClientNotFound", err)
+	}
+}
+
+func TestGlobalLimiter(t *testing.T) {
+	if allowed, _ := (*globalLimiter)(nil).allow(); !allowed {
+		t.Fatal("未配置全局限流时不限流")
+	}
+
+	now := time.Unix(1700000000, 0)
+	limiter := newGlobalLimiter(4)
+	limiter.now = func() time.Time { return now }
+
+	// 桶容量为一秒的配额
+	for i := 0; i < 4; i++ {
+		if allowed, _ := limiter.allow(); !allowed {
+			t.Fatalf("第%d条应被允许", i+1)
+		}
+	}
+	allowed, retryAfter := limiter.allow()
+	if allowed || retryAfter != 250*time.Millisecond {
+		t.Fatalf("allow() = (%v, %v), want (false, 250ms)", allowed, retryAfter)
+	}
+
+	now = now.Add(250 * time.Millisecond)
+	if allowed, _ := limiter.allow(); !allowed {
+		t.Fatal("经过一个令牌间隔后应被允许")
+	}
+	if allowed, _ := limiter.allow(); allowed {
+		t.Fatal("只补充了一个令牌")
+	}
+}
+
+func TestAllowPublishServerBusy(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, MaxGlobalPublishesPerSecond: 2})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	// 全局限流由所有客户端共享
+	clients := []*model.Client{model.NewClient("a", "alice", nil), model.NewClient("b", "bob", nil)}
+	for _, client := range clients {
+		ws.AddClient(client)
+		if _, err := ws.AllowPublish(client); err != nil {
+			t.Fatalf("%s的第一条应被允许: %v", client.ID, err)
+		}
+	}
+	for i, client := range clients {
+		retryAfter, err := ws.AllowPublish(client)
+		if !errors.Is(err, ErrServerBusy) || retryAfter <= 0 {
+			t.Fatalf("AllowPublish() = (%v, %v), want (>0, ErrServerBusy)", retryAfter, err)
+		}
+		if shed := ws.GetCounters().PublishesShed; shed != int64(i+1) {
+			t.Fatalf("PublishesShed = %d, want %d", shed, i+1)
+		}
+	}
+}
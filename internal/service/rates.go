@@ -0,0 +1,96 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// rateSampleInterval 两个采样点之间的最小间隔
+const rateSampleInterval = time.Minute
+
+// rateSampleCount 环形缓冲区保留的采样点数量（覆盖5分钟窗口）
+const rateSampleCount = 6
+
+// rateSample 某一时刻的累计计数快照
+type rateSample struct {
+	at          time.Time
+	messages    int64
+	connections int64
+}
+
+// rateTracker 按分钟采样累计计数，计算滚动窗口内的变化量
+type rateTracker struct {
+	mutex   sync.Mutex
+	samples [rateSampleCount]rateSample
+	next    int
+	count   int
+	now     func() time.Time
+}
+
+func newRateTracker() *rateTracker {
+	return &rateTracker{now: time.Now}
+}
+
+// sample 记录当前计数（距离上次采样不足一分钟时忽略），由维护任务调用
+func (t *rateTracker) sample(messages, connections int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	if t.count > 0 {
+		last := t.samples[(t.next+rateSampleCount-1)%rateSampleCount]
+		if now.Sub(last.at) < rateSampleInterval {
+			return
+		}
+	}
+
+	t.samples[t.next] = rateSample{at: now, messages: messages, connections: connections}
+	t.next = (t.next + 1) % rateSampleCount
+	if t.count < rateSampleCount {
+		t.count++
+	}
+}
+
+// rates 计算1分钟和5分钟窗口内的消息数和连接数变化
+func (t *rateTracker) rates(messages, connections int64) map[string]int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	result := make(map[string]int64, 4)
+	for _, window := range []struct {
+		name     string
+		duration time.Duration
+	}{
+		{"1m", time.Minute},
+		{"5m", 5 * time.Minute},
+	} {
+		baseline, ok := t.baselineLocked(window.duration)
+		if !ok {
+			result["messages_"+window.name] = 0
+			result["connections_delta_"+window.name] = 0
+			continue
+		}
+		result["messages_"+window.name] = messages - baseline.messages
+		result["connections_delta_"+window.name] = connections - baseline.connections
+	}
+	return result
+}
+
+// baselineLocked 返回窗口起点的采样：距今至少window的最新采样，数据不足时退回最早的采样
+func (t *rateTracker) baselineLocked(window time.Duration) (rateSample, bool) {
+	if t.count == 0 {
+		return rateSample{}, false
+	}
+
+	now := t.now()
+	oldest := (t.next + rateSampleCount - t.count) % rateSampleCount
+	baseline := t.samples[oldest]
+	for i := 0; i < t.count; i++ {
+		sample := t.samples[(oldest+i)%rateSampleCount]
+		if now.Sub(sample.at) < window {
+			break
+		}
+		baseline = sample
+	}
+	return baseline, true
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateTrackerWindows(t *testing.T) {
+	tracker := newRateTracker()
+	if got := tracker.rates(5, 1); got["messages_1m"] != 0 || got["messages_5m"] != 0 {
+		t.Fatalf("没有采样时 rates = %v, want 全为0", got)
+	}
+
+	now := time.Unix(1700000000, 0)
+	tracker.now = func() time.Time { return now }
+	// 每分钟采样一次累计计数：消息数0,10,30，连接数0,1,3
+	for i, counts := range [][2]int64{{0, 0}, {10, 1}, {30, 3}} {
+		if i > 0 {
+			now = now.Add(time.Minute)
+		}
+		tracker.sample(counts[0], counts[1])
+	}
+	// 不足一分钟的采样被忽略
+	now = now.Add(30 * time.Second)
+	tracker.sample(40, 4)
+
+	got := tracker.rates(45, 2)
+	want := map[string]int64{
+		"messages_1m":          35, // 相对距今至少一分钟的最新采样（第1分钟的10）
+		"connections_delta_1m": 1,
+		"messages_5m":          45, // 不足5分钟时相对最早的采样（0）
+		"connections_delta_5m": 2,
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Fatalf("%s = %d, want %d（rates = %v）", key, got[key], value, got)
+		}
+	}
+}
+
+func TestRateTrackerDropsOldSamples(t *testing.T) {
+	tracker := newRateTracker()
+	now := time.Unix(1700000000, 0)
+	tracker.now = func() time.Time { return now }
+
+	// 采样点超过缓冲区容量后覆盖最旧的采样，第i分钟的累计消息数为i*100
+	for i := 0; i < rateSampleCount+3; i++ {
+		if i > 0 {
+			now = now.Add(time.Minute)
+		}
+		tracker.sample(int64(i*100), 0)
+	}
+
+	got := tracker.rates(int64((rateSampleCount+2)*100), 0)
+	if got["messages_1m"] != 100 {
+		t.Fatalf("messages_1m = %d, want 100", got["messages_1m"])
+	}
+	if got["messages_5m"] != 500 {
+		t.Fatalf("messages_5m = %d, want 500", got["messages_5m"])
+	}
+}
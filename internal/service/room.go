@@ -3,6 +3,7 @@ package service
 import (
 	"fmt"
 	"regexp"
+	"strings"
 	"unicode/utf8"
 )
 
@@ -19,25 +20,42 @@ func NewRoomService() *RoomService {
 	}
 }
 
-// ValidateRoomName 验证房间名（与前端tools.ts中的validateRoomName完全一致）
-func (r *RoomService) ValidateRoomName(name string) (bool, string) {
+// 房间名校验失败的机器可读错误码
+const (
+	RoomNameTooShort     = "too_short"
+	RoomNameTooLong      = "too_long"
+	RoomNameInvalidChars = "invalid_chars"
+)
+
+// RoomNameError 房间名校验错误，同时携带错误码和面向用户的提示
+type RoomNameError struct {
+	Code    string
+	Message string
+}
+
+func (e *RoomNameError) Error() string {
+	return e.Message
+}
+
+// ValidateRoomName 验证房间名（与前端tools.ts中的validateRoomName完全一致），通过时返回nil
+func (r *RoomService) ValidateRoomName(name string) *RoomNameError {
 	// 检查长度（按字符数，不是字节数）
 	charCount := utf8.RuneCountInString(name)
 	
 	if charCount < 2 {
-		return false, "房间名太短啦，至少两个字符"
+		return &RoomNameError{Code: RoomNameTooShort, Message: "房间名太短啦，至少两个字符"}
 	}
 	
 	if charCount > 12 {
-		return false, "房间名最多 12 个字符"
+		return &RoomNameError{Code: RoomNameTooLong, Message: "房间名最多 12 个字符"}
 	}
 	
 	// 检查字符规则：中文、字母、数字、空格、下划线、中划线
 	if !r.namePattern.MatchString(name) {
-		return false, "房间名只能包含中文、字母、数字、空格、下划线和中划线"
+		return &RoomNameError{Code: RoomNameInvalidChars, Message: "房间名只能包含中文、字母、数字、空格、下划线和中划线"}
 	}
 	
-	return true, ""
+	return nil
 }
 
 // SanitizeRoomName 清理房间名（移除前后空格）
@@ -65,6 +83,11 @@ func (r *RoomService) SanitizeRoomName(name string) string {
 	return result
 }
 
+// NormalizeRoomName 规范化房间名：去除首尾空格并统一为小写，使大小写或空格不同的写法进入同一房间
+func (r *RoomService) NormalizeRoomName(name string) string {
+	return strings.ToLower(r.SanitizeRoomName(name))
+}
+
 // GenerateRoomID 生成房间ID（用于内部存储）
 func (r *RoomService) GenerateRoomID(name string) string {
 	// 清理并转换为小写，用于内部键值
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"letshare-server/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestValidateRoomName(t *testing.T) {
+	roomService := NewRoomService()
+	tests := []struct {
+		name     string
+		roomName string
+		wantCode string
+	}{
+		{"合法的英文名", "lobby", ""},
+		{"合法的中文名", "会议室", ""},
+		{"中间带空格", "room 1", ""},
+		{"一个字符", "a", RoomNameTooShort},
+		{"空名称", "", RoomNameTooShort},
+		{"按字符数计算长度", strings.Repeat("房", 12), ""},
+		{"超过12个字符", strings.Repeat("a", 13), RoomNameTooLong},
+		{"非法字符", "a/b", RoomNameInvalidChars},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := roomService.ValidateRoomName(tt.roomName)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("ValidateRoomName(%q) = %v, want nil", tt.roomName, err)
+				}
+				return
+			}
+			if err == nil || err.Code != tt.wantCode || err.Message == "" {
+				t.Fatalf("ValidateRoomName(%q) = %+v, want code %s", tt.roomName, err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSubscribeReturnsRoomNameError(t *testing.T) {
+	ws := newPresenceTestService(t)
+	addAuthClient(ws, "c1", "alice", AuthMethodAuthToken)
+
+	_, err := ws.SubscribeToRoom("c1", "a/b", "", false)
+	var nameErr *RoomNameError
+	if !errors.As(err, &nameErr) || nameErr.Code != RoomNameInvalidChars {
+		t.Fatalf("SubscribeToRoom() error = %v, want RoomNameError(%s)", err, RoomNameInvalidChars)
+	}
+}
+
+func TestRoomNameNormalization(t *testing.T) {
+	ws := newPresenceTestService(t)
+	creator := joinRoom(t, ws, "a", "alice", " Lobby ")
+	joinRoom(t, ws, "b", "bob", "LOBBY")
+
+	// 大小写和首尾空格不同的写法进入同一房间，展示名保留创建者的写法
+	info := ws.GetRoomInfo("lobby")
+	if info == nil || info["name"] != "lobby" || info["display_name"] != "Lobby" || info["client_count"] != 2 {
+		t.Fatalf("房间信息 = %v, want name=lobby display_name=Lobby client_count=2", info)
+	}
+	if rooms := ws.GetRoomStats(); len(rooms) != 1 {
+		t.Fatalf("房间数 = %d, want 1", len(rooms))
+	}
+
+	// 下发给客户端的频道使用展示名
+	presence := <-creator.Send
+	if presence.Type != model.MessageTypePresence || presence.Channel != "Lobby" {
+		t.Fatalf("presence频道 = %q, want Lobby", presence.Channel)
+	}
+	if _, err := ws.PublishToRoom("b", "lObBy", "signal:all", []byte(`{}`)); err != nil {
+		t.Fatalf("以其他写法发布应进入同一房间: %v", err)
+	}
+}
@@ -0,0 +1,391 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"letshare-server/internal/model"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// maxSessionIDLength sessionId的最大长度，超长的sessionId不参与会话恢复
+const maxSessionIDLength = 128
+
+// maxBufferedMessages 每个挂起会话最多缓存的消息数，超出时丢弃最旧的消息
+const maxBufferedMessages = 100
+
+// pendingRoom 挂起会话在某个房间内的订阅
+type pendingRoom struct {
+	displayName string
+	events      map[string]bool
+	history     bool
+}
+
+// bufferedMessage buffered房间中为挂起会话缓存的消息
+type bufferedMessage struct {
+	room    string
+	message *model.WebSocketMessage
+}
+
+// pendingSession 异常断开后保留的会话订阅，等待客户端在宽限期内重连恢复
+type pendingSession struct {
+	clientID    string
+	userID      string
+	anonymous   bool   // 挂起的连接是匿名连接，userID由服务端分配，只能由匿名连接凭sessionId（开启时还须恢复令牌）恢复
+	resumeToken string // 挂起的连接下发的恢复令牌，开启恢复令牌时恢复须携带
+	rooms       map[string]*pendingRoom
+	expiresAt   time.Time
+	buffered    []bufferedMessage // 受sessionsMutex保护
+}
+
+// resumableReasons 这些原因断开的连接（网络中断等）保留会话，主动断开或被服务端踢出的不保留
+var resumableReasons = map[DisconnectReason]bool{
+	DisconnectReadError:    true,
+	DisconnectWriteError:   true,
+	DisconnectSlowConsumer: true,
+	DisconnectInactive:     true,
+}
+
+// SessionResumeEnabled 是否开启了会话恢复
+func (ws *WebSocketService) SessionResumeEnabled() bool {
+	return ws.sessionResume > 0
+}
+
+// ResumeTokensEnabled 是否为每次连接下发恢复令牌
+func (ws *WebSocketService) ResumeTokensEnabled() bool {
+	return ws.SessionResumeEnabled() && ws.resumeTokens
+}
+
+// NewResumeToken 生成随机的恢复令牌
+func NewResumeToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// suspendSession 客户端异常断开时挂起其会话：静默退出所有房间（不广播离开事件），返回是否已挂起
+func (ws *WebSocketService) suspendSession(client *model.Client, reason DisconnectReason) bool {
+	if !ws.SessionResumeEnabled() || !resumableReasons[reason] || client.Displaced.Load() || client.SessionID == "" || len(client.SessionID) > maxSessionIDLength {
+		return false
+	}
+
+	session := &pendingSession{
+		clientID:    client.ID,
+		userID:      client.UserID,
+		anonymous:   client.Anonymous,
+		resumeToken: client.ResumeToken,
+		rooms:       make(map[string]*pendingRoom),
+		expiresAt:   time.Now().Add(ws.sessionResume),
+	}
+
+	ws.clientsMutex.RLock()
+	for roomName := range client.Rooms {
+		events := make(map[string]bool, len(client.Events[roomName]))
+		for event := range client.Events[roomName] {
+			events[event] = true
+		}
+		session.rooms[roomName] = &pendingRoom{events: events}
+	}
+	ws.clientsMutex.RUnlock()
+
+	ws.roomsMutex.RLock()
+	for roomName, pending := range session.rooms {
+		pending.displayName = roomName
+		if room, exists := ws.rooms[roomName]; exists {
+			pending.displayName = room.DisplayName
+			pending.history = room.History != nil
+		}
+	}
+	ws.roomsMutex.RUnlock()
+
+	for roomName := range session.rooms {
+		ws.leaveRoom(client.ID, roomName)
+	}
+
+	ws.sessionsMutex.Lock()
+	previous := ws.sessions[client.SessionID]
+	// 达到挂起会话上限时淘汰最早过期的会话，防止断线风暴撑大内存
+	var evicted *pendingSession
+	if previous == nil && ws.maxResumeSessions > 0 && len(ws.sessions) >= ws.maxResumeSessions {
+		evicted = ws.evictOldestSessionLocked()
+	}
+	ws.sessions[client.SessionID] = session
+	ws.sessionsMutex.Unlock()
+
+	// 同一sessionId的旧会话被覆盖或被淘汰的会话，视为真正离开
+	if previous != nil {
+		ws.expireSession(previous)
+	}
+	if evicted != nil {
+		ws.expireSession(evicted)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"client_id":  client.ID,
+		"user_id":    client.UserID,
+		"session_id": client.SessionID,
+		"rooms":      len(session.rooms),
+	}).Info("客户端会话已挂起，等待恢复")
+	return true
+}
+
+// ResumeSession 客户端凭sessionId重连时恢复挂起会话的房间和事件订阅（不广播加入事件），
+// 开启恢复令牌时resumeToken须与挂起连接下发的令牌一致；旧连接尚未被检测到断开时由新连接接管（见takeOverLiveSession）。
+// 返回恢复的房间名，以及buffered房间在断线期间缓存、需要由调用方补发的消息
+func (ws *WebSocketService) ResumeSession(client *model.Client, resumeToken string) ([]string, []*model.WebSocketMessage) {
+	if !ws.SessionResumeEnabled() || client.SessionID == "" {
+		return nil, nil
+	}
+
+	ws.sessionsMutex.Lock()
+	session, exists := ws.sessions[client.SessionID]
+	if !exists || session.userID != client.UserID || session.anonymous != client.Anonymous || time.Now().After(session.expiresAt) {
+		ws.sessionsMutex.Unlock()
+		if ws.resumeTokens && resumeToken != "" {
+			return ws.takeOverLiveSession(client, resumeToken), nil
+		}
+		return nil, nil
+	}
+	// 令牌不匹配时不恢复，也不移除挂起会话；并为本连接换一个新的sessionId，
+	// 避免它断开时以同一sessionId挂起而覆盖原会话
+	if ws.resumeTokens && !resumeTokenMatches(session.resumeToken, resumeToken) {
+		ws.sessionsMutex.Unlock()
+		logrus.WithFields(logrus.Fields{
+			"client_id":  client.ID,
+			"user_id":    client.UserID,
+			"session_id": client.SessionID,
+		}).Warn("恢复令牌无效，不恢复会话")
+		ws.clientsMutex.Lock()
+		client.SessionID = uuid.New().String()
+		ws.clientsMutex.Unlock()
+		return nil, nil
+	}
+	delete(ws.sessions, client.SessionID)
+	buffered := session.buffered
+	ws.sessionsMutex.Unlock()
+
+	restored := make([]string, 0, len(session.rooms))
+	restoredRooms := make(map[string]bool, len(session.rooms))
+	for roomName, pending := range session.rooms {
+		if _, err := ws.subscribeToRoom(client.ID, pending.displayName, "", pending.history, false); err != nil {
+			// 无法恢复（如房间已满），其他成员此前未收到离开事件，此时补发
+			logrus.WithFields(logrus.Fields{
+				"client_id": client.ID,
+				"room":      roomName,
+				"error":     err.Error(),
+			}).Warn("恢复房间订阅失败")
+			ws.announceLeave(roomName, session.clientID, session.userID)
+			continue
+		}
+
+		ws.clientsMutex.Lock()
+		client.Events[roomName] = pending.events
+		ws.clientsMutex.Unlock()
+		restored = append(restored, pending.displayName)
+		restoredRooms[roomName] = true
+	}
+
+	// 只补发已恢复房间的消息
+	replay := make([]*model.WebSocketMessage, 0, len(buffered))
+	for _, entry := range buffered {
+		if restoredRooms[entry.room] {
+			replay = append(replay, entry.message)
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"client_id":  client.ID,
+		"user_id":    client.UserID,
+		"session_id": client.SessionID,
+		"rooms":      len(restored),
+		"buffered":   len(replay),
+	}).Info("客户端会话已恢复")
+	return restored, replay
+}
+
+// takeOverLiveSession 携带恢复令牌重连时，同一会话的旧连接可能仍在线（如网络切换后服务端尚未检测到断开）。
+// 以新连接为准：在同一把锁内把旧连接的房间成员身份和事件订阅转移给新连接（不广播离开和加入），
+// 再以CloseDisplaced关闭旧连接。令牌不匹配时不接管，并为新连接换一个新的sessionId。返回接管的房间名
+func (ws *WebSocketService) takeOverLiveSession(client *model.Client, resumeToken string) []string {
+	ws.roomsMutex.Lock()
+	ws.clientsMutex.Lock()
+	var stale *model.Client
+	for _, candidate := range ws.clients {
+		if candidate.ID != client.ID && candidate.SessionID == client.SessionID && candidate.UserID == client.UserID && candidate.Anonymous == client.Anonymous {
+			stale = candidate
+			break
+		}
+	}
+	if stale == nil || !resumeTokenMatches(stale.ResumeToken, resumeToken) || !stale.Displaced.CompareAndSwap(false, true) {
+		sessionID := client.SessionID
+		// 其他连接扫描时读取SessionID，须在clients锁内修改
+		if stale != nil {
+			client.SessionID = uuid.New().String()
+		}
+		ws.clientsMutex.Unlock()
+		ws.roomsMutex.Unlock()
+		if stale != nil {
+			logrus.WithFields(logrus.Fields{
+				"client_id":  client.ID,
+				"user_id":    client.UserID,
+				"session_id": sessionID,
+			}).Warn("恢复令牌无效，不接管在线会话")
+		}
+		return nil
+	}
+
+	taken := make([]string, 0, len(stale.Rooms))
+	for roomName := range stale.Rooms {
+		if room, exists := ws.rooms[roomName]; exists {
+			delete(room.ClientIDs, stale.ID)
+			room.ClientIDs[client.ID] = true
+			taken = append(taken, room.DisplayName)
+		}
+		client.Rooms[roomName] = true
+		client.Events[roomName] = stale.Events[roomName]
+	}
+	if len(stale.Rooms) > 0 {
+		client.Subscribed.Store(true)
+	}
+	stale.Rooms = make(map[string]bool)
+	stale.Events = make(map[string]map[string]bool)
+	ws.clientsMutex.Unlock()
+	ws.roomsMutex.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"client_id":       client.ID,
+		"stale_client_id": stale.ID,
+		"user_id":         client.UserID,
+		"session_id":      client.SessionID,
+		"rooms":           len(taken),
+	}).Info("新连接接管了仍在线的会话")
+	ws.DisconnectClient(stale.ID, DisconnectDisplaced)
+	return taken
+}
+
+// AnonymousSessionUserID 匿名连接携带sessionId重连时，返回可恢复的挂起会话（或开启恢复令牌时可接管的在线会话）原来的用户ID，
+// 新连接沿用该ID后即可按正常流程恢复；开启恢复令牌时令牌须匹配。没有可恢复的匿名会话时返回空字符串
+func (ws *WebSocketService) AnonymousSessionUserID(sessionID, resumeToken string) string {
+	if !ws.SessionResumeEnabled() || sessionID == "" {
+		return ""
+	}
+
+	ws.sessionsMutex.Lock()
+	session, exists := ws.sessions[sessionID]
+	if exists && session.anonymous && time.Now().Before(session.expiresAt) &&
+		(!ws.resumeTokens || resumeTokenMatches(session.resumeToken, resumeToken)) {
+		ws.sessionsMutex.Unlock()
+		return session.userID
+	}
+	ws.sessionsMutex.Unlock()
+	if !ws.resumeTokens {
+		return ""
+	}
+
+	ws.clientsMutex.RLock()
+	defer ws.clientsMutex.RUnlock()
+	for _, candidate := range ws.clients {
+		if candidate.SessionID == sessionID && candidate.Anonymous && resumeTokenMatches(candidate.ResumeToken, resumeToken) {
+			return candidate.UserID
+		}
+	}
+	return ""
+}
+
+// resumeTokenMatches 以常量时间比较恢复令牌，挂起会话没有令牌（开启前挂起）时不允许恢复
+func resumeTokenMatches(expected, provided string) bool {
+	if expected == "" || provided == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(provided)) == 1
+}
+
+// evictOldestSessionLocked 移除最早过期的挂起会话并返回它（调用时须持有sessionsMutex）
+func (ws *WebSocketService) evictOldestSessionLocked() *pendingSession {
+	var oldestID string
+	var oldest *pendingSession
+	for sessionID, session := range ws.sessions {
+		if oldest == nil || session.expiresAt.Before(oldest.expiresAt) {
+			oldestID, oldest = sessionID, session
+		}
+	}
+	if oldest != nil {
+		delete(ws.sessions, oldestID)
+		logrus.WithField("client_id", oldest.clientID).Warn("挂起会话数已达上限，淘汰最早的会话")
+	}
+	return oldest
+}
+
+// ResumeSessionCount 当前挂起等待恢复的会话数
+func (ws *WebSocketService) ResumeSessionCount() int {
+	ws.sessionsMutex.Lock()
+	defer ws.sessionsMutex.Unlock()
+	return len(ws.sessions)
+}
+
+// bufferForSessions 为会话挂起中、且在该房间内应收到此消息的成员缓存消息；include为nil时不按事件过滤
+func (ws *WebSocketService) bufferForSessions(roomName string, message *model.WebSocketMessage, include func(roomEvents map[string]bool) bool) {
+	ws.sessionsMutex.Lock()
+	defer ws.sessionsMutex.Unlock()
+
+	for _, session := range ws.sessions {
+		pending, inRoom := session.rooms[roomName]
+		if !inRoom || (include != nil && !include(pending.events)) {
+			continue
+		}
+		if len(session.buffered) >= maxBufferedMessages {
+			session.buffered = session.buffered[1:]
+		}
+		session.buffered = append(session.buffered, bufferedMessage{room: roomName, message: message})
+	}
+}
+
+// cleanupExpiredSessions 清理超过宽限期仍未恢复的会话，并补发离开事件
+func (ws *WebSocketService) cleanupExpiredSessions() {
+	now := time.Now()
+
+	ws.sessionsMutex.Lock()
+	var expired []*pendingSession
+	for sessionID, session := range ws.sessions {
+		if now.After(session.expiresAt) {
+			expired = append(expired, session)
+			delete(ws.sessions, sessionID)
+		}
+	}
+	ws.sessionsMutex.Unlock()
+
+	for _, session := range expired {
+		ws.expireSession(session)
+	}
+}
+
+// expireSession 会话不再恢复，向其原先所在的房间广播离开事件
+func (ws *WebSocketService) expireSession(session *pendingSession) {
+	for roomName := range session.rooms {
+		ws.announceLeave(roomName, session.clientID, session.userID)
+	}
+	logrus.WithFields(logrus.Fields{
+		"client_id": session.clientID,
+		"user_id":   session.userID,
+	}).Debug("挂起的会话已过期")
+}
+
+// announceLeave 向房间当前成员广播离开事件（房间已不存在时忽略）
+func (ws *WebSocketService) announceLeave(roomName, clientID, userID string) {
+	ws.roomsMutex.RLock()
+	room, exists := ws.rooms[roomName]
+	roomSize := 0
+	if exists {
+		roomSize = len(room.ClientIDs)
+	}
+	ws.roomsMutex.RUnlock()
+
+	if roomSize > 0 {
+		ws.broadcastPresence(roomName, clientID, userID, model.PresenceLeave, roomSize)
+	}
+}
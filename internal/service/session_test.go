@@ -0,0 +1,307 @@
+package service
+
+import (
+	"fmt"
+	"letshare-server/internal/config"
+	"letshare-server/internal/model"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newResumeTestService 创建开启会话恢复和恢复令牌的服务
+func newResumeTestService(t *testing.T) *WebSocketService {
+	t.Helper()
+	ws := NewWebSocketService(config.WebSocket{
+		MaxRoomUsers:         10,
+		SessionResumeSeconds: 30,
+		ResumeTokens:         true,
+	})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	return ws
+}
+
+// addSessionClient 添加一个带sessionId和恢复令牌的客户端
+func addSessionClient(ws *WebSocketService, id, sessionID, resumeToken string) *model.Client {
+	client := model.NewClient(id, "user-a", nil)
+	client.SessionID = sessionID
+	client.ResumeToken = resumeToken
+	ws.AddClient(client)
+	return client
+}
+
+func TestResumeTokenMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		provided string
+		want     bool
+	}{
+		{"相同令牌", "abc123", "abc123", true},
+		{"不同令牌", "abc123", "abc124", false},
+		{"长度不同", "abc123", "abc12", false},
+		{"未携带令牌", "abc123", "", false},
+		{"会话没有令牌", "", "abc123", false},
+		{"两者都为空", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resumeTokenMatches(tt.expected, tt.provided); got != tt.want {
+				t.Errorf("resumeTokenMatches(%q, %q) = %v, want %v", tt.expected, tt.provided, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewResumeTokenRotates(t *testing.T) {
+	first, err := NewResumeToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewResumeToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 64 || first == second {
+		t.Errorf("恢复令牌应为64位十六进制且每次不同: %q %q", first, second)
+	}
+}
+
+func TestResumeSessionTakesOverLiveClient(t *testing.T) {
+	tests := []struct {
+		name        string
+		resumeToken string
+		wantTaken   bool
+	}{
+		{"令牌匹配时接管", "stale-token", true},
+		{"令牌不匹配时不接管", "wrong-token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := newResumeTestService(t)
+			stale := addSessionClient(ws, "stale", "session-1", "stale-token")
+			if _, err := ws.SubscribeToRoom(stale.ID, "Lobby", "file:offer", false); err != nil {
+				t.Fatal(err)
+			}
+
+			fresh := addSessionClient(ws, "fresh", "session-1", "fresh-token")
+			rooms, _ := ws.ResumeSession(fresh, tt.resumeToken)
+
+			members, _ := ws.GetRoomMembers("lobby")
+			_, staleOnline := ws.GetClient(stale.ID)
+			if !tt.wantTaken {
+				if len(rooms) != 0 || !staleOnline || fresh.SessionID == "session-1" {
+					t.Fatalf("不应接管: rooms=%v staleOnline=%v session=%s", rooms, staleOnline, fresh.SessionID)
+				}
+				return
+			}
+
+			if len(rooms) != 1 || rooms[0] != "Lobby" {
+				t.Fatalf("接管的房间 = %v, want [Lobby]", rooms)
+			}
+			if staleOnline || !stale.Displaced.Load() {
+				t.Fatal("旧连接应被标记为displaced并移除")
+			}
+			if len(members) != 1 {
+				t.Fatalf("房间成员数 = %d, want 1", len(members))
+			}
+			subscriptions, err := ws.GetClientSubscriptions(fresh.ID)
+			if err != nil || len(subscriptions["lobby"]) == 0 {
+				t.Fatalf("新连接应继承事件订阅: %v %v", subscriptions, err)
+			}
+			if ws.ResumeSessionCount() != 0 {
+				t.Fatal("被接管的旧连接不应挂起会话")
+			}
+		})
+	}
+}
+
+// TestResumeSessionConcurrentTakeOver 多个携带同一令牌的连接与仍在线的旧连接重叠，最终只有一个连接持有会话
+func TestResumeSessionConcurrentTakeOver(t *testing.T) {
+	ws := newResumeTestService(t)
+	stale := addSessionClient(ws, "stale", "session-1", "stale-token")
+	if _, err := ws.SubscribeToRoom(stale.ID, "lobby", "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	const resumers = 8
+	clients := make([]*model.Client, resumers)
+	for i := range clients {
+		clients[i] = addSessionClient(ws, fmt.Sprintf("fresh-%d", i), "session-1", fmt.Sprintf("fresh-token-%d", i))
+	}
+
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *model.Client) {
+			defer wg.Done()
+			ws.ResumeSession(client, "stale-token")
+		}(client)
+	}
+	// 接管期间旧连接仍在正常读取房间状态
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			ws.GetRoomMembers("lobby")
+			ws.GetClientSubscriptions(stale.ID)
+		}
+	}()
+	wg.Wait()
+
+	if _, online := ws.GetClient(stale.ID); online {
+		t.Fatal("旧连接应被移除")
+	}
+	members, _ := ws.GetRoomMembers("lobby")
+	if len(members) != 1 {
+		t.Fatalf("房间成员数 = %d, want 1", len(members))
+	}
+	owners := 0
+	for _, client := range clients {
+		subscriptions, err := ws.GetClientSubscriptions(client.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, inRoom := subscriptions["lobby"]; inRoom {
+			owners++
+			if client.SessionID != "session-1" {
+				t.Errorf("接管的连接应保留sessionId，got %s", client.SessionID)
+			}
+		} else if client.SessionID == "session-1" {
+			t.Errorf("未接管的连接 %s 应分配新的sessionId", client.ID)
+		}
+	}
+	if owners != 1 {
+		t.Fatalf("持有会话的连接数 = %d, want 1", owners)
+	}
+}
+
+func TestBufferedRoomReplaysMissedMessages(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{
+		MaxRoomUsers:         10,
+		SessionResumeSeconds: 30,
+		BufferedRooms:        []string{"ctrl-*"},
+	})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	addSessionClient(ws, "a", "session-1", "")
+	for _, roomName := range []string{"ctrl-1", "lobby"} {
+		if _, err := ws.SubscribeToRoom("a", roomName, "file:offer", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bob := model.NewClient("b", "bob", nil)
+	ws.AddClient(bob)
+	for _, roomName := range []string{"ctrl-1", "lobby"} {
+		if _, err := ws.SubscribeToRoom("b", roomName, "", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info := ws.GetRoomInfo("ctrl-1"); info["delivery"] != model.RoomDeliveryBuffered {
+		t.Fatalf("ctrl-1的投递保证 = %v, want buffered", info["delivery"])
+	}
+
+	ws.RemoveClient("a", DisconnectReadError)
+	if ws.ResumeSessionCount() != 1 {
+		t.Fatal("异常断开的会话应挂起")
+	}
+
+	publish := func(roomName, event string) {
+		t.Helper()
+		if _, err := ws.PublishToRoom("b", roomName, event, []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish("ctrl-1", "file:offer")
+	publish("ctrl-1", "signal:other") // 挂起成员未订阅的事件不缓存
+	publish("lobby", "file:offer")    // best_effort房间不缓存
+	if _, err := ws.SendChat("b", "ctrl-1", "hi"); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := addSessionClient(ws, "a2", "session-1", "")
+	rooms, replay := ws.ResumeSession(resumed, "")
+	if len(rooms) != 2 {
+		t.Fatalf("恢复的房间 = %v, want 2个", rooms)
+	}
+	if len(replay) != 2 {
+		t.Fatalf("补发消息数 = %d, want 2", len(replay))
+	}
+	if replay[0].Type != model.MessageTypeMessage || replay[0].Event != "file:offer" || replay[0].Channel != "ctrl-1" {
+		t.Fatalf("第1条补发消息 = %+v, want ctrl-1的file:offer", replay[0])
+	}
+	if replay[1].Type != model.MessageTypeChat {
+		t.Fatalf("第2条补发消息类型 = %s, want chat（不受事件过滤）", replay[1].Type)
+	}
+}
+
+func TestMaxResumeSessionsEvictsOldest(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, SessionResumeSeconds: 30, MaxResumeSessions: 2})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	observer := joinRoom(t, ws, "observer", "observer", "lobby")
+	for i := 1; i <= 3; i++ {
+		client := model.NewClient(fmt.Sprintf("c%d", i), fmt.Sprintf("user-%d", i), nil)
+		client.SessionID = fmt.Sprintf("session-%d", i)
+		ws.AddClient(client)
+		if _, err := ws.SubscribeToRoom(client.ID, "lobby", "signal:all", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	presenceEvents(t, observer)
+
+	ws.RemoveClient("c1", DisconnectReadError)
+	ws.RemoveClient("c2", DisconnectReadError)
+	// 不依赖时钟精度，确保session-1最早过期
+	ws.sessionsMutex.Lock()
+	ws.sessions["session-1"].expiresAt = ws.sessions["session-1"].expiresAt.Add(-time.Second)
+	ws.sessionsMutex.Unlock()
+	if events := presenceEvents(t, observer); len(events) != 0 {
+		t.Fatalf("挂起会话不应广播离开事件: %v", events)
+	}
+
+	ws.RemoveClient("c3", DisconnectReadError)
+	if count := ws.ResumeSessionCount(); count != 2 {
+		t.Fatalf("挂起会话数 = %d, want 2", count)
+	}
+	if got := ws.GetStats()["resume_sessions"]; got != 2 {
+		t.Fatalf("resume_sessions = %v, want 2", got)
+	}
+	// 被淘汰的会话视为真正离开
+	events := presenceEvents(t, observer)
+	if len(events) != 1 || events[0] != [2]string{model.PresenceLeave, "user-1"} {
+		t.Fatalf("presence事件 = %v, want [[leave user-1]]", events)
+	}
+	ws.sessionsMutex.Lock()
+	_, evicted := ws.sessions["session-1"]
+	ws.sessionsMutex.Unlock()
+	if evicted {
+		t.Fatal("最早过期的会话应被淘汰")
+	}
+}
+
+func TestCleanupExpiredSessions(t *testing.T) {
+	ws := newResumeTestService(t)
+	observer := joinRoom(t, ws, "observer", "observer", "lobby")
+	for _, id := range []string{"c1", "c2"} {
+		client := addSessionClient(ws, id, "session-"+id, "")
+		if _, err := ws.SubscribeToRoom(client.ID, "lobby", "signal:all", false); err != nil {
+			t.Fatal(err)
+		}
+		ws.RemoveClient(id, DisconnectReadError)
+	}
+	presenceEvents(t, observer)
+
+	ws.sessionsMutex.Lock()
+	ws.sessions["session-c1"].expiresAt = time.Now().Add(-time.Second)
+	ws.sessionsMutex.Unlock()
+
+	ws.cleanupExpiredSessions()
+	if count := ws.ResumeSessionCount(); count != 1 {
+		t.Fatalf("清理后挂起会话数 = %d, want 1", count)
+	}
+	events := presenceEvents(t, observer)
+	if len(events) != 1 || events[0] != [2]string{model.PresenceLeave, "user-a"} {
+		t.Fatalf("presence事件 = %v, want 过期会话的离开事件", events)
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"letshare-server/internal/model"
+	"sort"
+	"time"
+)
+
+// RoomSnapshot 房间完整状态的调试快照
+type RoomSnapshot struct {
+	Name        string    `json:"name"`
+	DisplayName string    `json:"display_name"`
+	Owner       string    `json:"owner"`
+	MaxUsers    int       `json:"max_users"`
+	Policy      string    `json:"policy"`
+	Delivery    string    `json:"delivery"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	Members []RoomMemberSnapshot `json:"members"`
+	// EventSubscribers 每个事件的订阅成员数
+	EventSubscribers map[string]int `json:"event_subscribers"`
+
+	// HistoryEnabled 房间是否保留历史，History为按时间排序的历史消息
+	HistoryEnabled bool                      `json:"history_enabled"`
+	History        []*model.WebSocketMessage `json:"history"`
+}
+
+// RoomMemberSnapshot 房间成员的连接状态
+type RoomMemberSnapshot struct {
+	ClientID string    `json:"client_id"`
+	UserID   string    `json:"user_id"`
+	LastPing time.Time `json:"last_ping"`
+	Events   []string  `json:"events"`  // 在该房间订阅的事件
+	Pending  int64     `json:"pending"` // 发送队列中尚未写完的消息数
+	Dropped  int64     `json:"dropped"` // 因发送队列溢出丢弃的消息数
+}
+
+// GetRoomSnapshot 汇总房间的属性、成员、事件订阅和历史消息，房间不存在时返回false
+func (ws *WebSocketService) GetRoomSnapshot(roomName string) (*RoomSnapshot, bool) {
+	roomName = ws.roomService.NormalizeRoomName(roomName)
+
+	ws.roomsMutex.RLock()
+	room, exists := ws.rooms[roomName]
+	if !exists {
+		ws.roomsMutex.RUnlock()
+		return nil, false
+	}
+	snapshot := &RoomSnapshot{
+		Name:             room.Name,
+		DisplayName:      room.DisplayName,
+		Owner:            room.Owner,
+		MaxUsers:         room.MaxUsers,
+		Policy:           room.Policy,
+		Delivery:         room.Delivery,
+		CreatedAt:        room.CreatedAt,
+		UpdatedAt:        room.UpdatedAt,
+		Members:          []RoomMemberSnapshot{},
+		EventSubscribers: make(map[string]int),
+		HistoryEnabled:   room.History != nil,
+		History:          []*model.WebSocketMessage{},
+	}
+	if room.History != nil {
+		snapshot.History = append(snapshot.History, room.History.Messages(nil)...)
+	}
+	clientIDs := make([]string, 0, len(room.ClientIDs))
+	for clientID := range room.ClientIDs {
+		clientIDs = append(clientIDs, clientID)
+	}
+	ws.roomsMutex.RUnlock()
+
+	// 与GetRoomMembers一致，先释放房间锁再读取客户端，已断开但尚未清理的客户端跳过
+	ws.clientsMutex.RLock()
+	for _, clientID := range clientIDs {
+		client, exists := ws.clients[clientID]
+		if !exists {
+			continue
+		}
+		events := make([]string, 0, len(client.Events[roomName]))
+		for event := range client.Events[roomName] {
+			events = append(events, event)
+			snapshot.EventSubscribers[event]++
+		}
+		sort.Strings(events)
+		snapshot.Members = append(snapshot.Members, RoomMemberSnapshot{
+			ClientID: client.ID,
+			UserID:   client.UserID,
+			LastPing: client.LastPing,
+			Events:   events,
+			Pending:  client.Pending.Load(),
+			Dropped:  client.Dropped.Load(),
+		})
+	}
+	ws.clientsMutex.RUnlock()
+
+	sort.Slice(snapshot.Members, func(i, j int) bool {
+		return snapshot.Members[i].UserID < snapshot.Members[j].UserID
+	})
+	return snapshot, true
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"letshare-server/internal/config"
+	"letshare-server/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestGetRoomSnapshot(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, RoomHistorySize: 5})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	alice := model.NewClient("a", "alice", nil)
+	ws.AddClient(alice)
+	if _, err := ws.SubscribeToRoom("a", "Lobby", "signal:all", true); err != nil {
+		t.Fatal(err)
+	}
+	bob := model.NewClient("b", "bob", nil)
+	ws.AddClient(bob)
+	for _, event := range []string{"file:offer", "signal:all"} {
+		if _, err := ws.SubscribeToRoom("b", "lobby", event, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ws.PublishToRoom("a", "lobby", "file:offer", []byte(`{"n":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, ok := ws.GetRoomSnapshot("LOBBY")
+	if !ok {
+		t.Fatal("房间应存在")
+	}
+	if snapshot.Name != "lobby" || snapshot.DisplayName != "Lobby" || snapshot.Owner == "" || snapshot.MaxUsers != 10 {
+		t.Fatalf("房间属性 = %+v", snapshot)
+	}
+	if len(snapshot.Members) != 2 || snapshot.Members[0].UserID != "alice" || snapshot.Members[1].UserID != "bob" {
+		t.Fatalf("成员 = %+v, want 按user_id排序的alice和bob", snapshot.Members)
+	}
+	if want := []string{"file:offer", "signal:all"}; !reflect.DeepEqual(snapshot.Members[1].Events, want) {
+		t.Fatalf("bob的事件 = %v, want %v", snapshot.Members[1].Events, want)
+	}
+	if want := map[string]int{"signal:all": 2, "file:offer": 1}; !reflect.DeepEqual(snapshot.EventSubscribers, want) {
+		t.Fatalf("事件订阅数 = %v, want %v", snapshot.EventSubscribers, want)
+	}
+	if snapshot.Members[1].Pending == 0 {
+		t.Fatal("bob的发送队列中有未写出的消息，pending应大于0")
+	}
+	if !snapshot.HistoryEnabled || len(snapshot.History) != 1 || snapshot.History[0].Event != "file:offer" {
+		t.Fatalf("历史 = %v (enabled=%v), want 1条file:offer", snapshot.History, snapshot.HistoryEnabled)
+	}
+
+	if _, ok := ws.GetRoomSnapshot("missing"); ok {
+		t.Fatal("不存在的房间应返回false")
+	}
+}
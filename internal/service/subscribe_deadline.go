@@ -0,0 +1,37 @@
+package service
+
+import (
+	"letshare-server/internal/model"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// watchSubscribeDeadline 开启subscribeTimeout时，客户端在期限内没有订阅过任何房间则断开，
+// 防止只回应ping、从不订阅的连接长期占用连接名额
+func (ws *WebSocketService) watchSubscribeDeadline(client *model.Client) {
+	if ws.subscribeTimeout <= 0 {
+		return
+	}
+
+	go func() {
+		timer := time.NewTimer(ws.subscribeTimeout)
+		defer timer.Stop()
+
+		select {
+		case <-client.Done:
+			return
+		case <-timer.C:
+		}
+
+		if client.Subscribed.Load() {
+			return
+		}
+		logrus.WithFields(logrus.Fields{
+			"client_id": client.ID,
+			"user_id":   client.UserID,
+			"timeout":   ws.subscribeTimeout.String(),
+		}).Info("客户端超时未订阅房间，断开连接")
+		ws.DisconnectClient(client.ID, DisconnectSubscribeTimeout)
+	}()
+}
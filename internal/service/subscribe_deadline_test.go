@@ -0,0 +1,60 @@
+package service
+
+import (
+	"letshare-server/internal/config"
+	"letshare-server/internal/model"
+	"testing"
+	"time"
+)
+
+// waitOffline 等待客户端被移除，超时返回false
+func waitOffline(ws *WebSocketService, clientID string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if _, online := ws.GetClient(clientID); !online {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+func TestSubscribeDeadline(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	// 配置以秒为单位，测试中直接缩短期限
+	ws.subscribeTimeout = 50 * time.Millisecond
+
+	idle := model.NewClient("idle", "alice", nil)
+	ws.AddClient(idle)
+	joinRoom(t, ws, "active", "bob", "lobby")
+
+	if !waitOffline(ws, "idle", time.Second) {
+		t.Fatal("期限内未订阅的客户端应被断开")
+	}
+	if got := ws.GetCounters().Disconnects[string(DisconnectSubscribeTimeout)]; got != 1 {
+		t.Fatalf("subscribe_timeout断开数 = %d, want 1", got)
+	}
+
+	// 订阅过的客户端即使之后取消订阅也不受影响
+	if err := ws.UnsubscribeFromRoom("active", "lobby", ""); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, online := ws.GetClient("active"); !online {
+		t.Fatal("订阅过房间的客户端不应被断开")
+	}
+}
+
+func TestSubscribeDeadlineDisabled(t *testing.T) {
+	ws := newPresenceTestService(t)
+	ws.AddClient(model.NewClient("idle", "alice", nil))
+
+	if ws.subscribeTimeout != 0 {
+		t.Fatalf("subscribeTimeout = %v, want 0（默认不开启）", ws.subscribeTimeout)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, online := ws.GetClient("idle"); !online {
+		t.Fatal("未开启时不应断开未订阅的客户端")
+	}
+}
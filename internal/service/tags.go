@@ -0,0 +1,84 @@
+package service
+
+import (
+	"letshare-server/internal/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tagIndex 按标签索引在线客户端：tag -> value -> clientID，受tagsMutex保护
+type tagIndex map[string]map[string]map[string]bool
+
+// indexTags 客户端连接时将其标签加入索引
+func (ws *WebSocketService) indexTags(client *model.Client) {
+	if len(client.Tags) == 0 {
+		return
+	}
+
+	ws.tagsMutex.Lock()
+	defer ws.tagsMutex.Unlock()
+
+	for tag, value := range client.Tags {
+		values, ok := ws.tags[tag]
+		if !ok {
+			values = make(map[string]map[string]bool)
+			ws.tags[tag] = values
+		}
+		clientIDs, ok := values[value]
+		if !ok {
+			clientIDs = make(map[string]bool)
+			values[value] = clientIDs
+		}
+		clientIDs[client.ID] = true
+	}
+}
+
+// unindexTags 客户端断开时从索引中移除，空的条目一并删除
+func (ws *WebSocketService) unindexTags(client *model.Client) {
+	if len(client.Tags) == 0 {
+		return
+	}
+
+	ws.tagsMutex.Lock()
+	defer ws.tagsMutex.Unlock()
+
+	for tag, value := range client.Tags {
+		values := ws.tags[tag]
+		delete(values[value], client.ID)
+		if len(values[value]) == 0 {
+			delete(values, value)
+		}
+		if len(values) == 0 {
+			delete(ws.tags, tag)
+		}
+	}
+}
+
+// BroadcastToTag 向带有指定标签值的所有在线客户端发送广播消息（不限房间），返回接收的连接数
+func (ws *WebSocketService) BroadcastToTag(tag, value, event string, data interface{}) int {
+	ws.tagsMutex.RLock()
+	clientIDs := make([]string, 0, len(ws.tags[tag][value]))
+	for clientID := range ws.tags[tag][value] {
+		clientIDs = append(clientIDs, clientID)
+	}
+	ws.tagsMutex.RUnlock()
+
+	message := model.NewWebSocketMessage(model.MessageTypeBroadcast, "", event, data)
+
+	count := 0
+	for _, clientID := range clientIDs {
+		if client, exists := ws.GetClient(clientID); exists {
+			ws.sendToClient(client, message)
+			count++
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"tag":        tag,
+		"value":      value,
+		"event":      event,
+		"recipients": count,
+	}).Info("按标签广播消息")
+
+	return count
+}
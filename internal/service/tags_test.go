@@ -0,0 +1,51 @@
+package service
+
+import (
+	"letshare-server/internal/model"
+	"testing"
+)
+
+// addTaggedClient 添加一个带标签的客户端
+func addTaggedClient(ws *WebSocketService, id string, tags map[string]string) *model.Client {
+	client := model.NewClient(id, id, nil)
+	client.Tags = tags
+	ws.AddClient(client)
+	return client
+}
+
+func TestBroadcastToTag(t *testing.T) {
+	ws := newPresenceTestService(t)
+	ios := addTaggedClient(ws, "a", map[string]string{"user_type": "ios", "app_version": "2.0"})
+	android := addTaggedClient(ws, "b", map[string]string{"user_type": "android", "app_version": "2.0"})
+	untagged := addTaggedClient(ws, "c", nil)
+
+	if count := ws.BroadcastToTag("user_type", "ios", "notice", map[string]string{"text": "hi"}); count != 1 {
+		t.Fatalf("user_type=ios的接收数 = %d, want 1", count)
+	}
+	if message := <-ios.Send; message.Type != model.MessageTypeBroadcast || message.Event != "notice" {
+		t.Fatalf("收到的消息 = %+v, want notice广播", message)
+	}
+	if len(android.Send) != 0 || len(untagged.Send) != 0 {
+		t.Fatal("标签不匹配的客户端不应收到广播")
+	}
+
+	if count := ws.BroadcastToTag("app_version", "2.0", "upgrade", nil); count != 2 {
+		t.Fatalf("app_version=2.0的接收数 = %d, want 2", count)
+	}
+	if count := ws.BroadcastToTag("user_type", "web", "notice", nil); count != 0 {
+		t.Fatalf("没有匹配客户端时接收数 = %d, want 0", count)
+	}
+
+	// 断开的客户端从索引中移除，空条目一并删除
+	ws.RemoveClient("a", DisconnectKicked)
+	if count := ws.BroadcastToTag("user_type", "ios", "notice", nil); count != 0 {
+		t.Fatalf("断开后接收数 = %d, want 0", count)
+	}
+	ws.RemoveClient("b", DisconnectKicked)
+	ws.tagsMutex.RLock()
+	remaining := len(ws.tags)
+	ws.tagsMutex.RUnlock()
+	if remaining != 0 {
+		t.Fatalf("所有带标签的客户端断开后索引中还有 %d 个标签", remaining)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import "errors"
+
+// token校验失败的类型，调用方通过errors.Is区分原因
+var (
+	ErrTokenFormat   = errors.New("token格式错误")
+	ErrTokenMismatch = errors.New("token无效")
+	ErrTokenExpired  = errors.New("token已过期")
+	// ErrTokenNotYetValid 当前时间早于nbf（超出时钟偏差容忍）
+	ErrTokenNotYetValid = errors.New("token尚未生效")
+)
+
+// 连接的认证方式：JWT和签名AuthToken证明了其中的用户身份；固定AuthToken只证明持有共享密钥，userId由客户端自行声明
+const (
+	AuthMethodJWT         = "jwt"
+	AuthMethodSignedToken = "signed_token"
+	AuthMethodAuthToken   = "auth_token"
+)
+
+// IdentityVerified 该认证方式下连接的UserID是否可信
+func IdentityVerified(authMethod string) bool {
+	return authMethod == AuthMethodJWT || authMethod == AuthMethodSignedToken
+}
+
+// TokenAuthMethod 按格式判断token对应的认证方式
+func TokenAuthMethod(token string) string {
+	switch {
+	case IsJWT(token):
+		return AuthMethodJWT
+	case IsSignedAuthToken(token):
+		return AuthMethodSignedToken
+	default:
+		return AuthMethodAuthToken
+	}
+}
+
+// TokenErrorReason 返回token校验失败的机器可读原因（format/mismatch/expired/not_yet_valid），未知错误返回invalid
+func TokenErrorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrTokenFormat):
+		return "format"
+	case errors.Is(err, ErrTokenMismatch):
+		return "mismatch"
+	case errors.Is(err, ErrTokenExpired):
+		return "expired"
+	case errors.Is(err, ErrTokenNotYetValid):
+		return "not_yet_valid"
+	default:
+		return "invalid"
+	}
+}
+
+// VerifyToken 按格式校验连接token：JWT和签名AuthToken返回其中的声明，固定AuthToken校验通过时声明为nil
+func VerifyToken(authService *AuthService, jwtService *JWTService, token string) (*Claims, error) {
+	switch TokenAuthMethod(token) {
+	case AuthMethodJWT:
+		return jwtService.ValidateToken(token)
+	case AuthMethodSignedToken:
+		return authService.ValidateSignedToken(token)
+	}
+	if err := authService.ValidateAuthToken(token); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
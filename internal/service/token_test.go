@@ -0,0 +1,100 @@
+package service
+
+import (
+	"errors"
+	"letshare-server/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyTokenErrors(t *testing.T) {
+	t.Setenv("SERVER_AUTH_SECRET", "explicit-secret")
+	authService := NewAuthService(config.Auth{AllowStaticToken: true})
+	jwtService := NewJWTService("test-secret", 1, 0)
+	authToken, _ := authService.GenerateAuthToken()
+	expired := signClaims(t, jwtService, Claims{UserID: "alice", ExpiresAt: time.Now().Unix() - 10})
+	signed, err := authService.GenerateSignedToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedExpired, err := authService.signedToken("alice", time.Now().Unix()-10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 把用户ID换成bob，保留原签名
+	parts := strings.Split(signed, ".")
+	parts[1] = "Ym9i"
+	tampered := strings.Join(parts, ".")
+
+	tests := []struct {
+		name       string
+		token      string
+		wantErr    error
+		wantReason string
+	}{
+		{"AuthToken有效", authToken, nil, ""},
+		{"AuthToken不匹配", "not-the-token", ErrTokenMismatch, "mismatch"},
+		{"JWT格式错误", "a.b.c", ErrTokenFormat, "format"},
+		{"JWT已过期", expired, ErrTokenExpired, "expired"},
+		{"签名AuthToken有效", signed, nil, ""},
+		{"签名AuthToken已过期", signedExpired, ErrTokenExpired, "expired"},
+		{"签名AuthToken被篡改", tampered, ErrTokenMismatch, "mismatch"},
+		{"签名AuthToken格式错误", "v1.!.x.y.z", ErrTokenMismatch, "mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifyToken(authService, jwtService, tt.token)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("VerifyToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil && TokenErrorReason(err) != tt.wantReason {
+				t.Fatalf("TokenErrorReason() = %q, want %q", TokenErrorReason(err), tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestSignedAuthToken(t *testing.T) {
+	t.Setenv("SERVER_AUTH_SECRET", "explicit-secret")
+	authService := NewAuthService(config.Auth{TokenTTLSeconds: 60})
+
+	first, err := authService.GenerateSignedToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := authService.GenerateSignedToken("alice")
+	if first == second {
+		t.Fatal("每个签名AuthToken应带不同的token ID")
+	}
+	if TokenAuthMethod(first) != AuthMethodSignedToken || !IdentityVerified(AuthMethodSignedToken) {
+		t.Fatalf("TokenAuthMethod() = %q, want %q", TokenAuthMethod(first), AuthMethodSignedToken)
+	}
+
+	claims, err := authService.ValidateSignedToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != "alice" {
+		t.Fatalf("UserID = %q, want alice", claims.UserID)
+	}
+	if remaining := claims.ExpiresAt - time.Now().Unix(); remaining < 55 || remaining > 60 {
+		t.Fatalf("有效期剩余%d秒，want 约60秒", remaining)
+	}
+
+	// 其他密钥签发的token无效
+	t.Setenv("SERVER_AUTH_SECRET", "other-secret")
+	if _, err := NewAuthService(config.Auth{}).ValidateSignedToken(first); !errors.Is(err, ErrTokenMismatch) {
+		t.Fatalf("换密钥后 error = %v, want %v", err, ErrTokenMismatch)
+	}
+}
+
+func TestStaticAuthTokenDisabled(t *testing.T) {
+	t.Setenv("SERVER_AUTH_SECRET", "explicit-secret")
+	authService := NewAuthService(config.Auth{AllowStaticToken: false})
+	token, _ := authService.GenerateAuthToken()
+
+	if _, err := VerifyToken(authService, NewJWTService("test-secret", 1, 0), token); !errors.Is(err, ErrTokenMismatch) {
+		t.Fatalf("停用固定AuthToken后 error = %v, want %v", err, ErrTokenMismatch)
+	}
+}
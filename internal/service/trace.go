@@ -0,0 +1,84 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxTraceStateBytes tracestate请求头的最大长度（W3C建议实现至少支持512字节）
+const maxTraceStateBytes = 512
+
+// ParseTraceparent 解析W3C traceparent请求头（version-traceid-parentid-flags），格式无效时返回false
+func ParseTraceparent(header string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 {
+		return "", "", false
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	// 版本00必须恰好4段，更高版本允许在后面追加字段；ff为保留的无效版本
+	if !isLowerHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return "", "", false
+	}
+	if !isLowerHex(traceID, 32) || !isLowerHex(spanID, 16) || !isLowerHex(flags, 2) {
+		return "", "", false
+	}
+	if strings.Trim(traceID, "0") == "" || strings.Trim(spanID, "0") == "" {
+		return "", "", false
+	}
+	return traceID, spanID, true
+}
+
+// TruncateTraceState 限制tracestate的长度，超长时丢弃整个值（截断会产生无效的列表项）
+func TruncateTraceState(state string) string {
+	if len(state) > maxTraceStateBytes {
+		return ""
+	}
+	return state
+}
+
+// isLowerHex 是否为指定长度的小写十六进制字符串
+func isLowerHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// traceContext 连接的追踪上下文
+type traceContext struct {
+	traceID string
+	spanID  string
+}
+
+// traceHook 为带有client_id字段的日志补充该连接的trace_id/span_id，使日志可以与前端的链路追踪关联
+type traceHook struct {
+	ws *WebSocketService
+}
+
+// Levels 返回此hook关心的日志级别
+func (hook *traceHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 实现logrus.Hook接口（logrus在触发hook前已复制Data，可以直接修改）
+func (hook *traceHook) Fire(entry *logrus.Entry) error {
+	clientID, ok := entry.Data["client_id"].(string)
+	if !ok {
+		return nil
+	}
+	value, ok := hook.ws.traces.Load(clientID)
+	if !ok {
+		return nil
+	}
+	trace := value.(traceContext)
+	entry.Data["trace_id"] = trace.traceID
+	entry.Data["span_id"] = trace.spanID
+	return nil
+}
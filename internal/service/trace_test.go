@@ -0,0 +1,87 @@
+package service
+
+import (
+	"letshare-server/internal/model"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		wantOK bool
+	}{
+		{"合法的版本00", "00-" + testTraceID + "-" + testSpanID + "-01", true},
+		{"首尾空格", " 00-" + testTraceID + "-" + testSpanID + "-00 ", true},
+		{"更高版本允许追加字段", "01-" + testTraceID + "-" + testSpanID + "-01-extra", true},
+		{"版本00不允许追加字段", "00-" + testTraceID + "-" + testSpanID + "-01-extra", false},
+		{"保留版本ff", "ff-" + testTraceID + "-" + testSpanID + "-01", false},
+		{"大写十六进制", "00-" + strings.ToUpper(testTraceID) + "-" + testSpanID + "-01", false},
+		{"trace_id全为0", "00-" + strings.Repeat("0", 32) + "-" + testSpanID + "-01", false},
+		{"span_id全为0", "00-" + testTraceID + "-" + strings.Repeat("0", 16) + "-01", false},
+		{"trace_id长度错误", "00-" + testTraceID[:30] + "-" + testSpanID + "-01", false},
+		{"段数不足", "00-" + testTraceID + "-" + testSpanID, false},
+		{"空值", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traceID, spanID, ok := ParseTraceparent(tt.header)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseTraceparent(%q) ok = %v, want %v", tt.header, ok, tt.wantOK)
+			}
+			if ok && (traceID != testTraceID || spanID != testSpanID) {
+				t.Fatalf("ParseTraceparent(%q) = (%s, %s)", tt.header, traceID, spanID)
+			}
+		})
+	}
+}
+
+func TestTruncateTraceState(t *testing.T) {
+	if got := TruncateTraceState("vendor=value"); got != "vendor=value" {
+		t.Fatalf("TruncateTraceState() = %q, want 原值", got)
+	}
+	if got := TruncateTraceState(strings.Repeat("a", maxTraceStateBytes+1)); got != "" {
+		t.Fatal("超长的tracestate应整个丢弃")
+	}
+}
+
+func TestTraceHookAddsTraceFields(t *testing.T) {
+	ws := newPresenceTestService(t)
+	client := model.NewClient("c1", "alice", nil)
+	client.TraceID = testTraceID
+	client.SpanID = testSpanID
+	ws.AddClient(client)
+	ws.AddClient(model.NewClient("c2", "bob", nil))
+	hook := &traceHook{ws: ws}
+
+	fire := func(data logrus.Fields) logrus.Fields {
+		entry := &logrus.Entry{Data: data}
+		if err := hook.Fire(entry); err != nil {
+			t.Fatal(err)
+		}
+		return entry.Data
+	}
+
+	if data := fire(logrus.Fields{"client_id": "c1"}); data["trace_id"] != testTraceID || data["span_id"] != testSpanID {
+		t.Fatalf("带追踪上下文的连接日志字段 = %v", data)
+	}
+	for _, data := range []logrus.Fields{{"client_id": "c2"}, {"user_id": "alice"}} {
+		if got := fire(data); got["trace_id"] != nil {
+			t.Fatalf("没有追踪上下文的日志不应补充trace_id: %v", got)
+		}
+	}
+
+	// 断开后不再补充
+	ws.RemoveClient("c1", DisconnectKicked)
+	if data := fire(logrus.Fields{"client_id": "c1"}); data["trace_id"] != nil {
+		t.Fatalf("断开后的日志字段 = %v", data)
+	}
+}
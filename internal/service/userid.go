@@ -0,0 +1,33 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"unicode/utf8"
+)
+
+// maxUserIDLength 客户端通过userId参数声明的用户ID的最大字符数
+const maxUserIDLength = 64
+
+// userIDPattern 用户ID允许的字符：中文、字母、数字以及 _ - . @ :（可覆盖UUID、邮箱等常见格式）
+var userIDPattern = regexp.MustCompile(`^[\p{Han}a-zA-Z0-9_.@:-]+$`)
+
+var (
+	ErrUserIDTooLong      = errors.New("userId过长，最多64个字符")
+	ErrUserIDInvalidChars = errors.New("userId只能包含中文、字母、数字和 _ - . @ :")
+	ErrUserIDMismatch     = errors.New("userId与token中的用户不一致")
+)
+
+// ValidateUserID 校验客户端声明的用户ID，空字符串视为未声明
+func ValidateUserID(userID string) error {
+	if userID == "" {
+		return nil
+	}
+	if utf8.RuneCountInString(userID) > maxUserIDLength {
+		return ErrUserIDTooLong
+	}
+	if !userIDPattern.MatchString(userID) {
+		return ErrUserIDInvalidChars
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateUserID(t *testing.T) {
+	tests := []struct {
+		name    string
+		userID  string
+		wantErr error
+	}{
+		{"未声明", "", nil},
+		{"字母数字", "alice_01", nil},
+		{"邮箱", "alice@example.com", nil},
+		{"UUID", "6f1c2d3e-0000-4a4a-9b9b-123456789abc", nil},
+		{"中文", "张三", nil},
+		{"带冒号的命名空间", "tenant:alice", nil},
+		{"64个字符", strings.Repeat("a", 64), nil},
+		{"64个中文字符", strings.Repeat("中", 64), nil},
+		{"超过64个字符", strings.Repeat("a", 65), ErrUserIDTooLong},
+		{"空格", "alice bob", ErrUserIDInvalidChars},
+		{"斜杠", "../admin", ErrUserIDInvalidChars},
+		{"HTML", "<script>", ErrUserIDInvalidChars},
+		{"换行", "alice\nuser_id=admin", ErrUserIDInvalidChars},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateUserID(tt.userID); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateUserID(%q) = %v, want %v", tt.userID, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,16 +2,37 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"letshare-server/internal/config"
 	"letshare-server/internal/model"
 	"letshare-server/pkg/logger"
+	"path"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 )
 
+// otherOrigin 超出跟踪上限的Origin统一计入该分组
+const otherOrigin = "other"
+
+// 未配置时的默认值
+const (
+	defaultPingInterval        = 30 * time.Second
+	defaultPongTimeout         = 60 * time.Second
+	defaultInactiveTimeout     = 5 * time.Minute
+	defaultMaintenanceInterval = 30 * time.Second
+	defaultSendBufferSize      = 256
+)
+
+// writeTimeout 写协程单条消息的写超时
+const writeTimeout = 10 * time.Second
+
 type WebSocketService struct {
 	clients      map[string]*model.Client // clientID -> Client
 	rooms        map[string]*model.Room   // roomName -> Room
@@ -19,28 +40,275 @@ type WebSocketService struct {
 	roomsMutex   sync.RWMutex
 	maxRoomUsers int
 	roomService  *RoomService
+
+	// 订阅时是否精简冗余的事件订阅
+	normalizeEvents bool
+
+	// 每个用户当前拥有（创建）的房间数，受roomsMutex保护
+	ownedRooms           map[string]int
+	maxRoomsOwnedPerUser int
+
+	// 单个客户端最多可同时订阅的房间数
+	maxRoomsPerClient int
+
+	// 当前连接数（原子计数，供/load等轻量接口读取）
+	connectionCount atomic.Int64
+	maxConnections  int
+
+	// 已准入（升级前占用名额）的连接数和按IP统计的连接数，maxConnectionsPerIP为0时不限制单IP
+	admissionMutex      sync.Mutex
+	admitted            int
+	ipConnections       map[string]int
+	maxConnectionsPerIP int
+
+	// 累计发布的消息数，以及按分钟采样的滚动速率
+	messagesPublished atomic.Int64
+	// 累计送达的消息数（每个接收者计一次）
+	messagesDelivered atomic.Int64
+	rates             *rateTracker
+
+	// 按Origin统计的连接数，数量受maxTrackedOrigins限制，防止伪造Origin撑大map
+	originCounts      map[string]int
+	originsMutex      sync.Mutex
+	maxTrackedOrigins int
+
+	// 最近一次维护任务成功完成的时间（UnixNano），用于健康检查
+	lastMaintenanceRun atomic.Int64
+
+	inactiveTimeout     time.Duration
+	maintenanceInterval time.Duration
+	// ping控制帧间隔和pong超时（读超时），pongTimeout至少为pingInterval的两倍
+	pingInterval time.Duration
+	pongTimeout  time.Duration
+	// 连接后必须在该时间内订阅房间，否则断开，0表示不限制
+	subscribeTimeout time.Duration
+	// JWT过期后连接保持只读的宽限期，0表示过期即断开
+	tokenExpiryGrace time.Duration
+
+	// 每个客户端发送队列的容量，队列写满视为慢消费者并断开
+	sendBufferSize int
+
+	// 匹配这些模式的房间创建时使用broadcast_all策略
+	broadcastAllRooms []string
+
+	// 匹配这些模式的房间创建时使用buffered投递
+	bufferedRooms []string
+
+	// 按房间名模式覆盖的人数上限
+	roomUserLimits map[string]int
+
+	// 按房间名模式覆盖的publish数据最大字节数
+	roomMessageBytes map[string]int
+
+	// 开启历史的房间每个事件保留的消息数，0表示禁用
+	roomHistorySize int
+
+	// 聊天消息的最大字符数，0表示不限制
+	chatMaxLength int
+
+	// 房间已满时建议备选房间的策略，为空时不提供建议
+	roomFullSuggestions string
+
+	// 超过该时间没有成员变化和消息的房间由维护任务关闭，0表示不关闭
+	roomIdleTimeout time.Duration
+
+	// 每个客户端的publish限流器
+	publishLimiter *publishLimiter
+	// /auth/verify按客户端IP的限流器，速率与publish相同
+	verifyLimiter *publishLimiter
+
+	// 全服务器的publish限流器（未配置时为nil），以及因此丢弃的消息数
+	globalLimiter *globalLimiter
+	publishesShed atomic.Int64
+
+	// 发送队列写满时的默认处理策略，以及因此丢弃的消息数
+	sendOverflowPolicy string
+	messagesDropped    atomic.Int64
+
+	// 迁移中不再接受新连接
+	draining atomic.Bool
+
+	// 初始化完成（维护任务已启动）后为true，开始关闭时置为false，供就绪探针使用
+	ready atomic.Bool
+
+	// 关闭服务时等待通知写出的宽限期，以及建议客户端的重连延迟
+	shutdownGrace          time.Duration
+	shutdownReconnectDelay time.Duration
+
+	// 按原因统计的断开次数
+	disconnects disconnectCounters
+
+	// 启动以来的累计计数
+	connectionsAccepted atomic.Int64
+	errorsSent          atomic.Int64
+
+	// 按房间规模档位统计的广播扇出耗时
+	fanoutLatency *fanoutLatency
+
+	// 携带traceparent的连接的追踪上下文（clientID -> traceContext），日志hook读取时不加锁
+	traces sync.Map
+
+	// 按标签索引的在线客户端
+	tags      tagIndex
+	tagsMutex sync.RWMutex
+
+	// 异常断开后等待客户端凭sessionId恢复订阅的会话，超过sessionResume后由维护任务清理
+	sessions      map[string]*pendingSession
+	sessionsMutex sync.Mutex
+	sessionResume time.Duration
+	// 挂起会话数的上限，0表示不限制
+	maxResumeSessions int
+	// 是否为每次连接下发恢复令牌，并在恢复会话时校验
+	resumeTokens bool
 }
 
-func NewWebSocketService(maxRoomUsers int) *WebSocketService {
+// Counters 启动以来的累计计数（用于Prometheus等监控）
+type Counters struct {
+	ConnectionsAccepted int64
+	MessagesPublished   int64
+	MessagesDelivered   int64
+	ErrorsSent          int64
+	PublishesShed       int64
+	MessagesDropped     int64
+	Disconnects         map[string]int64
+}
+
+func NewWebSocketService(cfg config.WebSocket) *WebSocketService {
 	ws := &WebSocketService{
-		clients:      make(map[string]*model.Client),
-		rooms:        make(map[string]*model.Room),
-		maxRoomUsers: maxRoomUsers,
-		roomService:  NewRoomService(),
+		clients:                make(map[string]*model.Client),
+		rooms:                  make(map[string]*model.Room),
+		maxRoomUsers:           cfg.MaxRoomUsers,
+		roomService:            NewRoomService(),
+		maxConnections:         cfg.MaxConnections,
+		ipConnections:          make(map[string]int),
+		maxConnectionsPerIP:    cfg.MaxConnectionsPerIP,
+		ownedRooms:             make(map[string]int),
+		maxRoomsOwnedPerUser:   cfg.MaxRoomsOwnedPerUser,
+		maxRoomsPerClient:      cfg.MaxRoomsPerClient,
+		normalizeEvents:        cfg.NormalizeEvents,
+		rates:                  newRateTracker(),
+		originCounts:           make(map[string]int),
+		maxTrackedOrigins:      cfg.MaxTrackedOrigins,
+		inactiveTimeout:        time.Duration(cfg.InactiveTimeoutSeconds) * time.Second,
+		pingInterval:           time.Duration(cfg.PingIntervalSeconds) * time.Second,
+		pongTimeout:            time.Duration(cfg.PongTimeoutSeconds) * time.Second,
+		subscribeTimeout:       time.Duration(cfg.SubscribeTimeoutSeconds) * time.Second,
+		tokenExpiryGrace:       time.Duration(cfg.TokenExpiryGraceSeconds) * time.Second,
+		maintenanceInterval:    time.Duration(cfg.MaintenanceIntervalSeconds) * time.Second,
+		sendBufferSize:         cfg.SendBufferSize,
+		sendOverflowPolicy:     cfg.SendOverflowPolicy,
+		broadcastAllRooms:      cfg.BroadcastAllRooms,
+		bufferedRooms:          cfg.BufferedRooms,
+		roomUserLimits:         cfg.RoomUserLimits,
+		roomMessageBytes:       cfg.RoomMessageBytes,
+		roomHistorySize:        cfg.RoomHistorySize,
+		chatMaxLength:          cfg.ChatMaxLength,
+		roomFullSuggestions:    cfg.RoomFullSuggestions,
+		roomIdleTimeout:        time.Duration(cfg.RoomIdleTimeoutSeconds) * time.Second,
+		publishLimiter:         newPublishLimiter(cfg.PublishRatePerSecond, cfg.PublishBurst),
+		verifyLimiter:          newPublishLimiter(cfg.PublishRatePerSecond, cfg.PublishBurst),
+		globalLimiter:          newGlobalLimiter(cfg.MaxGlobalPublishesPerSecond),
+		shutdownGrace:          time.Duration(cfg.ShutdownGraceSeconds) * time.Second,
+		shutdownReconnectDelay: time.Duration(cfg.ShutdownReconnectDelaySeconds) * time.Second,
+		disconnects:            newDisconnectCounters(),
+		fanoutLatency:          newFanoutLatency(),
+		tags:                   make(tagIndex),
+		sessions:               make(map[string]*pendingSession),
+		sessionResume:          time.Duration(cfg.SessionResumeSeconds) * time.Second,
+		maxResumeSessions:      cfg.MaxResumeSessions,
+		resumeTokens:           cfg.ResumeTokens,
+	}
+	for _, pattern := range ws.broadcastAllRooms {
+		if _, err := path.Match(pattern, ""); err != nil {
+			logrus.WithField("pattern", pattern).Warn("broadcast_all_rooms中的房间模式无效，将被忽略")
+		}
+	}
+	for _, pattern := range ws.bufferedRooms {
+		if _, err := path.Match(pattern, ""); err != nil {
+			logrus.WithField("pattern", pattern).Warn("buffered_rooms中的房间模式无效，将被忽略")
+		}
+	}
+	if ws.sendOverflowPolicy == "" {
+		ws.sendOverflowPolicy = OverflowDisconnect
+	} else if !ValidOverflowPolicy(ws.sendOverflowPolicy) {
+		logrus.WithField("policy", ws.sendOverflowPolicy).Warn("send_overflow_policy无效，使用disconnect")
+		ws.sendOverflowPolicy = OverflowDisconnect
+	}
+	switch ws.roomFullSuggestions {
+	case RoomSuggestionNone, RoomSuggestionNumericSuffix:
+	default:
+		logrus.WithField("strategy", ws.roomFullSuggestions).Warn("room_full_suggestions策略无效，将不提供备选房间")
+		ws.roomFullSuggestions = RoomSuggestionNone
+	}
+	if len(ws.bufferedRooms) > 0 && ws.sessionResume <= 0 {
+		logrus.Warn("buffered_rooms需要开启session_resume_seconds才会缓存消息")
+	}
+	if ws.sendBufferSize <= 0 {
+		ws.sendBufferSize = defaultSendBufferSize
 	}
+	if ws.inactiveTimeout <= 0 {
+		ws.inactiveTimeout = defaultInactiveTimeout
+	}
+	if ws.maintenanceInterval <= 0 {
+		ws.maintenanceInterval = defaultMaintenanceInterval
+	}
+	if ws.pingInterval <= 0 {
+		ws.pingInterval = defaultPingInterval
+	}
+	if ws.pongTimeout <= 0 {
+		ws.pongTimeout = defaultPongTimeout
+	}
+	// pong超时至少容纳一次ping未及时响应，否则高延迟网络下正常客户端也会被断开
+	if ws.pongTimeout < 2*ws.pingInterval {
+		logrus.WithFields(logrus.Fields{
+			"ping_interval": ws.pingInterval,
+			"pong_timeout":  ws.pongTimeout,
+		}).Warn("pong超时应至少为ping间隔的两倍，按两倍处理")
+		ws.pongTimeout = 2 * ws.pingInterval
+	}
+	// 超时不大于ping间隔时，正常响应pong的客户端也可能被误判为非活跃
+	if ws.inactiveTimeout <= ws.pingInterval {
+		logrus.WithFields(logrus.Fields{
+			"inactive_timeout": ws.inactiveTimeout,
+			"ping_interval":    ws.pingInterval,
+		}).Warn("非活跃超时应大于ping间隔，否则可能误断开正常客户端")
+	}
+	ws.lastMaintenanceRun.Store(time.Now().UnixNano())
+
+	// 为连接相关的日志补充追踪ID，须在文件/内存日志hook之前执行
+	logger.PrependHook(&traceHook{ws: ws})
 
 	// 启动定期清理
 	go ws.startMaintenance()
 
+	ws.ready.Store(true)
 	return ws
 }
 
-// AddClient 添加新客户端
+// Ready 服务是否可以接收流量：初始化完成，且未在关闭或迁移中
+func (ws *WebSocketService) Ready() bool {
+	return ws.ready.Load() && !ws.Draining()
+}
+
+// AddClient 添加新客户端，并启动该客户端的写协程
 func (ws *WebSocketService) AddClient(client *model.Client) {
 	ws.clientsMutex.Lock()
 	defer ws.clientsMutex.Unlock()
 
+	client.Send = make(chan *model.WebSocketMessage, ws.sendBufferSize)
+	if conn, ok := client.Connection.(*websocket.Conn); ok {
+		go ws.writePump(client, conn)
+	}
+
 	ws.clients[client.ID] = client
+	ws.connectionCount.Add(1)
+	ws.connectionsAccepted.Add(1)
+	ws.trackOrigin(client)
+	ws.indexTags(client)
+	if client.TraceID != "" {
+		ws.traces.Store(client.ID, traceContext{traceID: client.TraceID, spanID: client.SpanID})
+	}
+	ws.watchSubscribeDeadline(client)
 
 	logrus.WithFields(logrus.Fields{
 		"client_id": client.ID,
@@ -48,8 +316,8 @@ func (ws *WebSocketService) AddClient(client *model.Client) {
 	}).Info("客户端连接")
 }
 
-// RemoveClient 移除客户端 - 彻底清理所有引用
-func (ws *WebSocketService) RemoveClient(clientID string) {
+// RemoveClient 移除客户端 - 彻底清理所有引用，reason只在客户端实际被移除时计数一次
+func (ws *WebSocketService) RemoveClient(clientID string, reason DisconnectReason) {
 	ws.clientsMutex.Lock()
 	client, exists := ws.clients[clientID]
 	if !exists {
@@ -59,38 +327,159 @@ func (ws *WebSocketService) RemoveClient(clientID string) {
 
 	// 先从clients map中移除，防止其他goroutine访问
 	delete(ws.clients, clientID)
+	ws.connectionCount.Add(-1)
 	ws.clientsMutex.Unlock()
+	ws.disconnects.record(reason)
 
 	// 彻底清理客户端资源
+	ws.publishLimiter.remove(clientID)
+
 	if client != nil {
-		ws.cleanupClientResources(client)
+		ws.releaseClientConnection(client)
+		ws.untrackOrigin(client)
+		ws.unindexTags(client)
+		ws.cleanupClientResources(client, reason)
 	}
 
 	logrus.WithField("client_id", clientID).Info("客户端断开")
+	ws.traces.Delete(clientID)
+}
+
+// trackOrigin 记录客户端Origin的连接数，超过跟踪上限的新Origin计入other
+func (ws *WebSocketService) trackOrigin(client *model.Client) {
+	origin, _ := client.Metadata["origin"].(string)
+	if origin == "" {
+		origin = "unknown"
+	}
+
+	ws.originsMutex.Lock()
+	defer ws.originsMutex.Unlock()
+
+	// other分组本身不占用跟踪名额
+	trackedOrigins := len(ws.originCounts)
+	if _, ok := ws.originCounts[otherOrigin]; ok {
+		trackedOrigins--
+	}
+	if _, tracked := ws.originCounts[origin]; !tracked && trackedOrigins >= ws.maxTrackedOrigins {
+		origin = otherOrigin
+	}
+	ws.originCounts[origin]++
+	client.Metadata["origin_bucket"] = origin
+}
+
+// untrackOrigin 客户端断开时减少对应Origin的连接数，归零后释放该条目
+func (ws *WebSocketService) untrackOrigin(client *model.Client) {
+	bucket, ok := client.Metadata["origin_bucket"].(string)
+	if !ok {
+		return
+	}
+
+	ws.originsMutex.Lock()
+	defer ws.originsMutex.Unlock()
+
+	ws.originCounts[bucket]--
+	if ws.originCounts[bucket] <= 0 {
+		delete(ws.originCounts, bucket)
+	}
+}
+
+// writePump 写协程：串行地把发送队列中的消息写入连接，慢客户端不会阻塞广播
+func (ws *WebSocketService) writePump(client *model.Client, conn *websocket.Conn) {
+	for {
+		select {
+		case <-client.Done:
+			return
+		case message := <-client.Send:
+			conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			var err error
+			if message.Binary != nil {
+				err = conn.WriteMessage(websocket.BinaryMessage, message.Binary)
+			} else {
+				err = conn.WriteJSON(message)
+			}
+			client.Pending.Add(-1)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"client_id": client.ID,
+					"error":     err.Error(),
+				}).Error("发送消息失败")
+
+				// 连接出错，移除客户端
+				ws.RemoveClient(client.ID, DisconnectWriteError)
+				return
+			}
+		}
+	}
 }
 
 // cleanupClientResources 彻底清理客户端相关资源
-func (ws *WebSocketService) cleanupClientResources(client *model.Client) {
+func (ws *WebSocketService) cleanupClientResources(client *model.Client, reason DisconnectReason) {
+	// 通知写协程退出（RemoveClient保证每个客户端只清理一次）
+	close(client.Done)
+
 	// 关闭WebSocket连接
 	if conn, ok := client.Connection.(*websocket.Conn); ok {
 		conn.Close()
 	}
 
-	// 从所有房间中移除客户端
-	roomsToCleanup := make([]string, 0, len(client.Rooms))
-	for roomName := range client.Rooms {
-		roomsToCleanup = append(roomsToCleanup, roomName)
+	// 从所有房间中移除客户端；可恢复的会话静默离开，等待客户端重连
+	if !ws.suspendSession(client, reason) {
+		ws.clientsMutex.RLock()
+		roomsToCleanup := make([]string, 0, len(client.Rooms))
+		for roomName := range client.Rooms {
+			roomsToCleanup = append(roomsToCleanup, roomName)
+		}
+		ws.clientsMutex.RUnlock()
+
+		for _, roomName := range roomsToCleanup {
+			ws.removeClientFromRoom(client.ID, client.UserID, roomName)
+		}
+	}
+	// 不清空Rooms、Events等字段：处理器和恢复会话可能仍在持锁读写它们，客户端对象随引用释放被回收
+}
+
+// ErrRoomGone 客户端记录显示已订阅，但房间已被并发删除（如取消订阅使房间清空），重新订阅后可重试
+var ErrRoomGone = errors.New("房间已被删除，请重新订阅")
+
+// memberSnapshot 在房间锁内确认客户端仍是房间成员，并复制除其自身外的成员列表
+func (ws *WebSocketService) memberSnapshot(client *model.Client, roomName string) (*model.Room, []string, error) {
+	ws.roomsMutex.RLock()
+	room, roomExists := ws.rooms[roomName]
+	if roomExists && room.ClientIDs[client.ID] {
+		// 发送消息算作房间活动，空闲房间清理据此判断
+		room.LastActivity.Store(time.Now().UnixNano())
+		memberIDs := make([]string, 0, len(room.ClientIDs))
+		for memberID := range room.ClientIDs {
+			if memberID != client.ID {
+				memberIDs = append(memberIDs, memberID)
+			}
+		}
+		ws.roomsMutex.RUnlock()
+		return room, memberIDs, nil
 	}
+	ws.roomsMutex.RUnlock()
 
-	for _, roomName := range roomsToCleanup {
-		ws.removeClientFromRoom(client.ID, roomName)
+	if ws.inRoom(client, roomName) {
+		return nil, nil, ErrRoomGone
 	}
+	return nil, nil, fmt.Errorf("客户端未订阅房间: %s", roomName)
+}
 
-	// 清理客户端内部引用
-	client.Rooms = nil
-	client.Events = nil
-	client.Connection = nil
-	client.Metadata = nil
+// inRoom 客户端是否已订阅房间（同一客户端的消息可能被并发处理，读取订阅需要加锁）
+func (ws *WebSocketService) inRoom(client *model.Client, roomName string) bool {
+	ws.clientsMutex.RLock()
+	defer ws.clientsMutex.RUnlock()
+	return client.Rooms[roomName]
+}
+
+// PingInterval 服务端发送ping控制帧的间隔
+func (ws *WebSocketService) PingInterval() time.Duration {
+	return ws.pingInterval
+}
+
+// PongTimeout 连接的读超时，每次收到pong或消息时顺延
+func (ws *WebSocketService) PongTimeout() time.Duration {
+	return ws.pongTimeout
 }
 
 // GetClient 获取客户端
@@ -101,48 +490,94 @@ func (ws *WebSocketService) GetClient(clientID string) (*model.Client, bool) {
 	return client, exists
 }
 
-// SubscribeToRoom 订阅房间
-func (ws *WebSocketService) SubscribeToRoom(clientID, roomName, event string) error {
-	// 验证房间名
-	if valid, errMsg := ws.roomService.ValidateRoomName(roomName); !valid {
-		return fmt.Errorf(errMsg)
+// SubscribeToRoom 订阅房间，成功时返回该房间实际生效的人数上限。
+// keepHistory只在创建房间时生效：开启后房间保留最近的消息，供后加入的成员回放
+func (ws *WebSocketService) SubscribeToRoom(clientID, roomName, event string, keepHistory bool) (int, error) {
+	return ws.subscribeToRoom(clientID, roomName, event, keepHistory, true)
+}
+
+// subscribeToRoom 订阅房间，announce为false时不广播加入事件也不回放历史（用于恢复会话）
+func (ws *WebSocketService) subscribeToRoom(clientID, roomName, event string, keepHistory, announce bool) (int, error) {
+	// 验证房间名（去除首尾空格后），以规范化后的名称作为房间键，保留原始写法用于展示
+	displayName := ws.roomService.SanitizeRoomName(roomName)
+	if err := ws.roomService.ValidateRoomName(displayName); err != nil {
+		return 0, err
 	}
+	roomName = ws.roomService.NormalizeRoomName(roomName)
 
 	client, exists := ws.GetClient(clientID)
 	if !exists {
-		return fmt.Errorf("客户端不存在")
+		return 0, fmt.Errorf("客户端不存在")
+	}
+
+	// JWT限定了房间时只能订阅该房间
+	if allowedRoom := ws.AllowedRoom(client); allowedRoom != "" && ws.roomService.NormalizeRoomName(allowedRoom) != roomName {
+		return 0, ErrRoomNotAllowed
+	}
+
+	// 已在房间内时只追加事件，不重新走加入流程（房间数和人数检查、成员变化时间、加入通知）
+	if maxUsers, ok := ws.addRoomEvent(client, roomName, event); ok {
+		return maxUsers, nil
+	}
+
+	// 检查客户端订阅的房间数（重复订阅已加入的房间不计入）
+	ws.clientsMutex.RLock()
+	subscribedRooms := len(client.Rooms)
+	alreadySubscribed := client.Rooms[roomName]
+	ws.clientsMutex.RUnlock()
+	if ws.maxRoomsPerClient > 0 && !alreadySubscribed && subscribedRooms >= ws.maxRoomsPerClient {
+		return 0, fmt.Errorf("已达到最大房间订阅数，最多%d个", ws.maxRoomsPerClient)
 	}
 
 	// 检查房间人数限制
 	ws.roomsMutex.Lock()
 	room, roomExists := ws.rooms[roomName]
 	if !roomExists {
-		room = model.NewRoom(roomName)
+		// 新建房间时检查该用户拥有的房间数，加入已有房间不受此限制
+		quota := quotaKey(client)
+		if ws.maxRoomsOwnedPerUser > 0 && ws.ownedRooms[quota] >= ws.maxRoomsOwnedPerUser {
+			ws.roomsMutex.Unlock()
+			return 0, fmt.Errorf("创建的房间数已达上限，最多%d个", ws.maxRoomsOwnedPerUser)
+		}
+		room = model.NewRoom(roomName, client.UserID)
+		room.DisplayName = displayName
+		room.QuotaKey = quota
+		room.Policy = ws.roomPolicy(roomName)
+		room.Delivery = ws.roomDelivery(roomName)
+		room.MaxUsers = ws.roomMaxUsers(roomName)
+		if keepHistory && ws.roomHistorySize > 0 {
+			room.History = model.NewRoomHistory(ws.roomHistorySize)
+		}
 		ws.rooms[roomName] = room
+		ws.ownedRooms[quota]++
 	}
 
 	// 检查房间是否已满（修复：检查clientID而不是Client指针）
-	if len(room.ClientIDs) >= ws.maxRoomUsers {
+	maxUsers := room.MaxUsers
+	if len(room.ClientIDs) >= maxUsers {
 		if _, exists := room.ClientIDs[clientID]; !exists {
+			fullErr := &RoomFullError{Room: displayName, MaxUsers: maxUsers}
+			// 限定了房间的客户端无法加入其他房间，不提供建议
+			if ws.AllowedRoom(client) == "" {
+				fullErr.Suggestions = ws.roomSuggestions(displayName)
+			}
 			ws.roomsMutex.Unlock()
-			return fmt.Errorf("房间已满，最多支持%d个用户", ws.maxRoomUsers)
+			return 0, fullErr
 		}
 	}
 
 	// 添加客户端ID到房间（避免循环引用）
+	joined := !room.ClientIDs[clientID]
 	room.ClientIDs[clientID] = true
 	room.UpdatedAt = time.Now()
+	roomSize := len(room.ClientIDs)
 	ws.roomsMutex.Unlock()
 
 	// 更新客户端信息
 	ws.clientsMutex.Lock()
 	client.Rooms[roomName] = true
-	if event != "" {
-		client.Events[event] = true
-	} else {
-		// 如果没有指定事件，默认订阅所有事件
-		client.Events["signal:all"] = true
-	}
+	client.Subscribed.Store(true)
+	ws.addEventLocked(client, roomName, event)
 	ws.clientsMutex.Unlock()
 
 	logrus.WithFields(logrus.Fields{
@@ -150,23 +585,128 @@ func (ws *WebSocketService) SubscribeToRoom(clientID, roomName, event string) er
 		"user_id":   client.UserID,
 		"room":      roomName,
 		"event":     event,
-		"room_size": len(room.ClientIDs),
+		"room_size": roomSize,
 	}).Info("客户端订阅房间")
 
-	return nil
+	// 只有首次加入房间时才通知其他成员，重复订阅（如追加事件）不触发
+	if joined && announce {
+		ws.broadcastPresence(roomName, clientID, client.UserID, model.PresenceJoin, roomSize)
+		ws.replayHistory(client, roomName)
+	}
+
+	return maxUsers, nil
+}
+
+// addRoomEvent 客户端已是房间成员时为其追加事件订阅并返回房间人数上限，不是成员时返回false。
+// 持有rooms读锁期间追加，保证房间不会同时被删除或客户端被移出
+func (ws *WebSocketService) addRoomEvent(client *model.Client, roomName, event string) (int, bool) {
+	ws.roomsMutex.RLock()
+	defer ws.roomsMutex.RUnlock()
+
+	room, exists := ws.rooms[roomName]
+	if !exists || !room.ClientIDs[client.ID] {
+		return 0, false
+	}
+
+	ws.clientsMutex.Lock()
+	ws.addEventLocked(client, roomName, event)
+	ws.clientsMutex.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"client_id": client.ID,
+		"room":      roomName,
+		"event":     event,
+	}).Debug("客户端在已加入的房间追加事件订阅")
+	return room.MaxUsers, true
+}
+
+// addEventLocked 记录客户端在房间内订阅的事件，event为空时订阅所有事件（调用时须持有clientsMutex写锁）
+func (ws *WebSocketService) addEventLocked(client *model.Client, roomName, event string) {
+	roomEvents, ok := client.Events[roomName]
+	if !ok {
+		roomEvents = make(map[string]bool)
+		client.Events[roomName] = roomEvents
+	}
+	if event != "" {
+		roomEvents[event] = true
+	} else {
+		// 如果没有指定事件，默认订阅所有事件
+		roomEvents["signal:all"] = true
+	}
+	if ws.normalizeEvents {
+		normalizeRoomEvents(roomEvents)
+	}
+}
+
+// replayHistory 向新加入的成员回放房间历史消息（按其订阅的事件过滤）
+func (ws *WebSocketService) replayHistory(client *model.Client, roomName string) {
+	ws.clientsMutex.RLock()
+	roomEvents := make(map[string]bool, len(client.Events[roomName]))
+	for event := range client.Events[roomName] {
+		roomEvents[event] = true
+	}
+	ws.clientsMutex.RUnlock()
+
+	ws.roomsMutex.RLock()
+	room, exists := ws.rooms[roomName]
+	if !exists || room.History == nil {
+		ws.roomsMutex.RUnlock()
+		return
+	}
+	policy := room.Policy
+	messages := room.History.Messages(func(event string) bool {
+		// 与广播时的事件过滤规则一致
+		return receivesEvent(policy, roomEvents, event)
+	})
+	ws.roomsMutex.RUnlock()
+
+	for _, message := range messages {
+		ws.sendToClient(client, message)
+	}
+}
+
+// recordHistory 将广播消息记入房间历史（房间未开启历史时忽略），回放的副本在data中带有replayed: true
+func (ws *WebSocketService) recordHistory(roomName, msgType, event string, data json.RawMessage) {
+	ws.roomsMutex.Lock()
+	defer ws.roomsMutex.Unlock()
+
+	room, exists := ws.rooms[roomName]
+	if !exists || room.History == nil {
+		return
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil || payload == nil {
+		payload = map[string]interface{}{"value": data}
+	}
+	payload["replayed"] = true
+	room.History.Add(event, model.NewWebSocketMessage(msgType, room.DisplayName, event, payload))
+}
+
+// normalizeRoomEvents 精简房间内的事件订阅：已订阅signal:all时其余具体事件都是多余的
+func normalizeRoomEvents(roomEvents map[string]bool) {
+	if !roomEvents["signal:all"] {
+		return
+	}
+	for event := range roomEvents {
+		if event != "signal:all" {
+			delete(roomEvents, event)
+		}
+	}
 }
 
 // UnsubscribeFromRoom 取消订阅房间
 func (ws *WebSocketService) UnsubscribeFromRoom(clientID, roomName, event string) error {
+	roomName = ws.roomService.NormalizeRoomName(roomName)
 	client, exists := ws.GetClient(clientID)
 	if !exists {
 		return fmt.Errorf("客户端不存在")
 	}
 
-	// 如果指定了特定事件，只移除该事件订阅
+	// 如果指定了特定事件，只移除该房间内的该事件订阅
 	if event != "" && event != "signal:all" {
 		ws.clientsMutex.Lock()
-		delete(client.Events, event)
+		delete(client.Events[roomName], event)
 		ws.clientsMutex.Unlock()
 
 		logrus.WithFields(logrus.Fields{
@@ -179,7 +719,7 @@ func (ws *WebSocketService) UnsubscribeFromRoom(clientID, roomName, event string
 	}
 
 	// 完全离开房间
-	ws.removeClientFromRoom(clientID, roomName)
+	ws.removeClientFromRoom(clientID, client.UserID, roomName)
 
 	logrus.WithFields(logrus.Fields{
 		"client_id": clientID,
@@ -190,53 +730,59 @@ func (ws *WebSocketService) UnsubscribeFromRoom(clientID, roomName, event string
 	return nil
 }
 
-// PublishToRoom 发布消息到房间
-func (ws *WebSocketService) PublishToRoom(clientID, roomName, event string, data json.RawMessage) error {
-	client, exists := ws.GetClient(clientID)
-	if !exists {
-		return fmt.Errorf("客户端不存在")
+// PublishToRoom 发布消息到房间，返回实际接收消息的客户端数
+func (ws *WebSocketService) PublishToRoom(clientID, roomName, event string, data json.RawMessage) (int, error) {
+	count, err := ws.broadcastToRoom(clientID, roomName, event, func(_ *model.Client, channel string) (*model.WebSocketMessage, error) {
+		return model.NewWebSocketMessage(model.MessageTypeMessage, channel, event, data), nil
+	})
+	if err == nil {
+		ws.recordHistory(ws.roomService.NormalizeRoomName(roomName), model.MessageTypeMessage, event, data)
 	}
+	return count, err
+}
 
-	// 检查客户端是否在房间中
-	if !client.Rooms[roomName] {
-		return fmt.Errorf("客户端未订阅房间: %s", roomName)
-	}
+// PublishBinaryToRoom 以二进制帧发布消息到房间，帧头携带频道、事件和发送者，返回实际接收消息的客户端数
+func (ws *WebSocketService) PublishBinaryToRoom(clientID, roomName, event string, payload []byte) (int, error) {
+	return ws.broadcastToRoom(clientID, roomName, event, func(sender *model.Client, channel string) (*model.WebSocketMessage, error) {
+		return model.NewBinaryMessage(channel, event, sender.UserID, payload)
+	})
+}
 
-	ws.roomsMutex.RLock()
-	room, roomExists := ws.rooms[roomName]
-	ws.roomsMutex.RUnlock()
+// broadcastToRoom 将消息按房间分发策略发送给房间内其他成员，newMessage根据发送者和房间展示名构造待发送的消息
+func (ws *WebSocketService) broadcastToRoom(clientID, roomName, event string, newMessage func(sender *model.Client, channel string) (*model.WebSocketMessage, error)) (int, error) {
+	start := time.Now()
+	roomName = ws.roomService.NormalizeRoomName(roomName)
 
-	if !roomExists {
-		return fmt.Errorf("房间不存在: %s", roomName)
+	client, exists := ws.GetClient(clientID)
+	if !exists {
+		return 0, fmt.Errorf("客户端不存在")
+	}
+
+	room, memberIDs, err := ws.memberSnapshot(client, roomName)
+	if err != nil {
+		return 0, err
 	}
 
 	// 创建消息
-	message := model.NewWebSocketMessage(model.MessageTypeMessage, roomName, event, data)
+	message, err := newMessage(client, room.DisplayName)
+	if err != nil {
+		return 0, err
+	}
 
 	// 广播到房间中的所有客户端
 	count := 0
-	for roomClientID := range room.ClientIDs {
-		if roomClientID == clientID {
-			continue // 不发送给自己
-		}
-
+	for _, roomClientID := range memberIDs {
 		// 获取房间中的客户端
 		roomClient, exists := ws.GetClient(roomClientID)
 		if !exists {
-			// 客户端不存在，从房间中移除
-			ws.removeClientFromRoom(roomClientID, roomName)
+			// 客户端正在断开：由它自己的移除流程离开房间并带上userId通知其他成员，这里只跳过
 			continue
 		}
 
-		// 检查事件过滤
-		shouldReceive := false
-		if event == "" || event == "signal:all" {
-			// 广播消息，检查是否订阅了signal:all
-			shouldReceive = roomClient.Events["signal:all"]
-		} else {
-			// 特定事件消息，检查是否订阅了该事件或signal:all
-			shouldReceive = roomClient.Events[event] || roomClient.Events["signal:all"]
-		}
+		// 检查事件过滤（只看该客户端在当前房间内的订阅）
+		ws.clientsMutex.RLock()
+		shouldReceive := receivesEvent(room.Policy, roomClient.Events[roomName], event)
+		ws.clientsMutex.RUnlock()
 
 		if !shouldReceive {
 			continue
@@ -246,73 +792,504 @@ func (ws *WebSocketService) PublishToRoom(clientID, roomName, event string, data
 		count++
 	}
 
+	if room.Delivery == model.RoomDeliveryBuffered {
+		ws.bufferForSessions(roomName, message, func(roomEvents map[string]bool) bool {
+			return receivesEvent(room.Policy, roomEvents, event)
+		})
+	}
+
+	ws.messagesPublished.Add(1)
+	ws.messagesDelivered.Add(int64(count))
+	// 从进入到全部入队的耗时，不包含写协程实际写出的时间
+	roomSize := len(memberIDs) + 1
+	ws.fanoutLatency.observe(roomSize, time.Since(start))
+
 	logrus.WithFields(logrus.Fields{
 		"client_id":  clientID,
 		"user_id":    client.UserID,
 		"room":       roomName,
 		"event":      event,
 		"recipients": count,
-		"room_size":  len(room.ClientIDs),
+		"room_size":  roomSize,
 	}).Debug("消息已广播")
 
+	return count, nil
+}
+
+// ErrPublishRateLimited 客户端超出了自身的publish速率限制
+var ErrPublishRateLimited = errors.New("发布消息过于频繁")
+
+// ErrServerBusy 全服务器的publish总速率已达上限
+var ErrServerBusy = errors.New("服务器繁忙")
+
+// AllowPublish 依次检查客户端和全服务器的publish速率限制，超出时返回对应的错误和建议的等待时间
+func (ws *WebSocketService) AllowPublish(client *model.Client) (time.Duration, error) {
+	allowed, retryAfter, warn := ws.publishLimiter.allow(client.ID)
+	if warn {
+		logrus.WithFields(logrus.Fields{
+			"client_id":   client.ID,
+			"user_id":     client.UserID,
+			"retry_after": retryAfter,
+		}).Warn("客户端发布消息过于频繁，已限流")
+	}
+	if !allowed {
+		return retryAfter, ErrPublishRateLimited
+	}
+
+	// 全局限流作为最后的保护，单个客户端的洪泛先被自身的限流器拦下
+	if allowed, retryAfter := ws.globalLimiter.allow(); !allowed {
+		if ws.publishesShed.Add(1)%100 == 1 {
+			logrus.WithField("shed_total", ws.publishesShed.Load()).Warn("全局publish速率已达上限，正在丢弃消息")
+		}
+		return retryAfter, ErrServerBusy
+	}
+	return 0, nil
+}
+
+// AllowVerify 检查/auth/verify按客户端IP的速率限制，超出时返回false和建议的等待时间
+func (ws *WebSocketService) AllowVerify(ip string) (bool, time.Duration) {
+	allowed, retryAfter, warn := ws.verifyLimiter.allow(ip)
+	if warn {
+		logrus.WithFields(logrus.Fields{
+			"client_ip":   ip,
+			"retry_after": retryAfter,
+		}).Warn("token校验请求过于频繁，已限流")
+	}
+	return allowed, retryAfter
+}
+
+// ErrClientNotFound 指定的客户端不存在或已断开
+var ErrClientNotFound = errors.New("客户端不存在")
+
+// GetRateLimitState 返回客户端各限流器的当前状态（目前只有publish，chat与其共用）
+func (ws *WebSocketService) GetRateLimitState(clientID string) (map[string]RateLimitState, error) {
+	if _, exists := ws.GetClient(clientID); !exists {
+		return nil, ErrClientNotFound
+	}
+	return map[string]RateLimitState{
+		"publish": ws.publishLimiter.state(clientID),
+	}, nil
+}
+
+// ResetRateLimit 将客户端的限流令牌恢复为满桶（用于解除误限流）
+func (ws *WebSocketService) ResetRateLimit(clientID string) error {
+	if _, exists := ws.GetClient(clientID); !exists {
+		return ErrClientNotFound
+	}
+	ws.publishLimiter.reset(clientID)
+	logrus.WithField("client_id", clientID).Info("客户端限流状态已重置")
 	return nil
 }
 
-// sendToClient 发送消息给客户端
+// ErrRoomNotAllowed 客户端的token限定了房间，不能订阅其他房间
+var ErrRoomNotAllowed = errors.New("token不允许订阅该房间")
+
+// ErrTargetNotInRoom 点对点消息的目标用户不在房间中
+var ErrTargetNotInRoom = errors.New("目标用户不在房间中")
+
+// PublishToUser 发送点对点消息给房间内指定用户（同一用户的多个连接都会收到），不受事件订阅过滤，返回接收的连接数
+func (ws *WebSocketService) PublishToUser(clientID, roomName, event, toUserID string, data json.RawMessage) (int, error) {
+	roomName = ws.roomService.NormalizeRoomName(roomName)
+	client, exists := ws.GetClient(clientID)
+	if !exists {
+		return 0, fmt.Errorf("客户端不存在")
+	}
+
+	room, memberIDs, err := ws.memberSnapshot(client, roomName)
+	if err != nil {
+		return 0, err
+	}
+
+	message := model.NewWebSocketMessage(model.MessageTypeMessage, room.DisplayName, event, data)
+	message.To = toUserID
+
+	count := 0
+	for _, memberID := range memberIDs {
+		member, exists := ws.GetClient(memberID)
+		if !exists || member.UserID != toUserID {
+			continue
+		}
+		ws.sendToClient(member, message)
+		count++
+	}
+
+	if count == 0 {
+		return 0, ErrTargetNotInRoom
+	}
+
+	ws.messagesPublished.Add(1)
+	ws.messagesDelivered.Add(int64(count))
+
+	logrus.WithFields(logrus.Fields{
+		"client_id":  clientID,
+		"user_id":    client.UserID,
+		"room":       roomName,
+		"event":      event,
+		"to":         toUserID,
+		"recipients": count,
+	}).Debug("点对点消息已发送")
+
+	return count, nil
+}
+
+// SendToClient 将消息放入客户端的发送队列（非阻塞）
+func (ws *WebSocketService) SendToClient(client *model.Client, message *model.WebSocketMessage) {
+	ws.sendToClient(client, message)
+}
+
+// sendToClient 发送消息给客户端：非阻塞入队，队列已满说明客户端消费过慢，直接移除
 func (ws *WebSocketService) sendToClient(client *model.Client, message *model.WebSocketMessage) {
-	conn, ok := client.Connection.(*websocket.Conn)
-	if !ok {
-		logrus.WithField("client_id", client.ID).Error("WebSocket连接类型错误")
-		return
+	select {
+	case <-client.Done:
+		return // 客户端已被移除
+	default:
 	}
 
-	if err := conn.WriteJSON(message); err != nil {
-		logrus.WithFields(logrus.Fields{
-			"client_id": client.ID,
-			"error":     err.Error(),
-		}).Error("发送消息失败")
+	client.Pending.Add(1)
+	select {
+	case client.Send <- message:
+		if message.Type == model.MessageTypeError {
+			ws.errorsSent.Add(1)
+		}
+	default:
+		client.Pending.Add(-1)
+		ws.handleSendOverflow(client, message)
+	}
+}
 
-		// 连接出错，移除客户端
-		ws.RemoveClient(client.ID)
+// removeClientFromRoom 从房间中移除客户端，并通知房间内其他成员
+func (ws *WebSocketService) removeClientFromRoom(clientID, userID, roomName string) {
+	left, roomSize := ws.leaveRoom(clientID, roomName)
+	if left && roomSize > 0 {
+		ws.broadcastPresence(roomName, clientID, userID, model.PresenceLeave, roomSize)
 	}
 }
 
-// removeClientFromRoom 从房间中移除客户端
-func (ws *WebSocketService) removeClientFromRoom(clientID, roomName string) {
+// leaveRoom 将客户端移出房间（不通知其他成员），返回是否确实移除以及剩余人数
+func (ws *WebSocketService) leaveRoom(clientID, roomName string) (bool, int) {
 	ws.roomsMutex.Lock()
-	defer ws.roomsMutex.Unlock()
 
 	room, exists := ws.rooms[roomName]
 	if !exists {
-		return
+		ws.roomsMutex.Unlock()
+		return false, 0
 	}
 
-	// 从房间中移除客户端ID
+	// 从房间中移除客户端ID（只有真正移除时才发送离开事件，避免重复通知）
+	left := room.ClientIDs[clientID]
 	delete(room.ClientIDs, clientID)
 	room.UpdatedAt = time.Now()
+	roomSize := len(room.ClientIDs)
 
 	// 更新客户端信息（如果客户端还存在）
 	if client, exists := ws.GetClient(clientID); exists {
 		ws.clientsMutex.Lock()
 		delete(client.Rooms, roomName)
 		// 清理该房间相关的事件订阅
-		for event := range client.Events {
-			if event != "signal:all" {
-				delete(client.Events, event)
-			}
-		}
+		delete(client.Events, roomName)
 		ws.clientsMutex.Unlock()
 	}
 
 	// 如果房间为空，删除房间
-	if len(room.ClientIDs) == 0 {
-		delete(ws.rooms, roomName)
+	if roomSize == 0 {
+		ws.deleteRoomLocked(room)
 		logrus.WithField("room", roomName).Debug("空房间已删除")
 	}
+	ws.roomsMutex.Unlock()
+
+	return left, roomSize
+}
+
+// broadcastPresence 向房间内除当事人外的成员广播加入/离开事件（调用时不能持有锁）
+func (ws *WebSocketService) broadcastPresence(roomName, clientID, userID, event string, roomSize int) {
+	ws.roomsMutex.RLock()
+	room, exists := ws.rooms[roomName]
+	if !exists {
+		ws.roomsMutex.RUnlock()
+		return
+	}
+	memberIDs := make([]string, 0, len(room.ClientIDs))
+	for memberID := range room.ClientIDs {
+		if memberID != clientID {
+			memberIDs = append(memberIDs, memberID)
+		}
+	}
+	channel := room.DisplayName
+	ws.roomsMutex.RUnlock()
+
+	message := model.NewWebSocketMessage(model.MessageTypePresence, channel, event, map[string]interface{}{
+		"user_id":   userID,
+		"room_size": roomSize,
+	})
+
+	for _, memberID := range memberIDs {
+		if member, exists := ws.GetClient(memberID); exists {
+			ws.sendToClient(member, message)
+		}
+	}
+}
+
+// deleteRoomLocked 删除房间并释放房主的房间配额（调用方需持有roomsMutex写锁）
+func (ws *WebSocketService) deleteRoomLocked(room *model.Room) {
+	delete(ws.rooms, room.Name)
+
+	ws.ownedRooms[room.QuotaKey]--
+	if ws.ownedRooms[room.QuotaKey] <= 0 {
+		delete(ws.ownedRooms, room.QuotaKey)
+	}
+}
+
+// quotaKey 房间配额的计数键：JWT或签名AuthToken认证的连接按用户ID计数，同一用户的多个连接共享配额；
+// 自行声明userId或匿名的连接按客户端ID计数，避免冒用他人的userId占满其配额
+func quotaKey(client *model.Client) string {
+	if IdentityVerified(client.AuthMethod) {
+		return "user:" + client.UserID
+	}
+	return "client:" + client.ID
+}
+
+// GetClientSubscriptions 获取客户端按房间划分的事件订阅（roomName -> 已排序的事件列表）
+func (ws *WebSocketService) GetClientSubscriptions(clientID string) (map[string][]string, error) {
+	client, exists := ws.GetClient(clientID)
+	if !exists {
+		return nil, fmt.Errorf("客户端不存在")
+	}
+
+	ws.clientsMutex.RLock()
+	defer ws.clientsMutex.RUnlock()
+
+	subscriptions := make(map[string][]string, len(client.Rooms))
+	for roomName := range client.Rooms {
+		events := make([]string, 0, len(client.Events[roomName]))
+		for event := range client.Events[roomName] {
+			events = append(events, event)
+		}
+		sort.Strings(events)
+		subscriptions[roomName] = events
+	}
+
+	return subscriptions, nil
+}
+
+// GetClients 获取所有在线客户端的快照（用于管理接口）
+func (ws *WebSocketService) GetClients() []map[string]interface{} {
+	ws.clientsMutex.RLock()
+	defer ws.clientsMutex.RUnlock()
+
+	clients := make([]map[string]interface{}, 0, len(ws.clients))
+	for _, client := range ws.clients {
+		rooms := make([]string, 0, len(client.Rooms))
+		for roomName := range client.Rooms {
+			rooms = append(rooms, roomName)
+		}
+		sort.Strings(rooms)
+
+		metadata := make(map[string]interface{}, len(client.Metadata))
+		for key, value := range client.Metadata {
+			metadata[key] = value
+		}
+
+		clients = append(clients, map[string]interface{}{
+			"id":        client.ID,
+			"user_id":   client.UserID,
+			"rooms":     rooms,
+			"last_ping": client.LastPing,
+			"metadata":  metadata,
+			"tags":      client.Tags,
+			"dropped":   client.Dropped.Load(),
+		})
+	}
+	return clients
+}
+
+// GetRoomMembers 获取房间内所有成员的用户ID，房间不存在时返回false
+func (ws *WebSocketService) GetRoomMembers(roomName string) ([]string, bool) {
+	roomName = ws.roomService.NormalizeRoomName(roomName)
+	ws.roomsMutex.RLock()
+	room, exists := ws.rooms[roomName]
+	if !exists {
+		ws.roomsMutex.RUnlock()
+		return nil, false
+	}
+	clientIDs := make([]string, 0, len(room.ClientIDs))
+	for clientID := range room.ClientIDs {
+		clientIDs = append(clientIDs, clientID)
+	}
+	ws.roomsMutex.RUnlock()
+
+	members := make([]string, 0, len(clientIDs))
+	for _, clientID := range clientIDs {
+		// 已断开但尚未从房间清理的客户端直接跳过
+		client, exists := ws.GetClient(clientID)
+		if !exists {
+			continue
+		}
+		members = append(members, client.UserID)
+	}
+	sort.Strings(members)
+
+	return members, true
+}
+
+// roomMaxUsers 根据配置的房间模式决定新房间的人数上限，未匹配时使用全局上限
+func (ws *WebSocketService) roomMaxUsers(roomName string) int {
+	for pattern, limit := range ws.roomUserLimits {
+		if matched, _ := path.Match(pattern, roomName); matched && limit > 0 {
+			return limit
+		}
+	}
+	return ws.maxRoomUsers
+}
+
+// RoomMessageLimit 房间内publish数据的最大字节数：匹配room_message_bytes模式时取其中最小的覆盖值，
+// 且不超过全局上限（连接级读限制由全局上限决定），未匹配时使用全局上限
+func (ws *WebSocketService) RoomMessageLimit(roomName string, globalLimit int) int {
+	roomName = ws.roomService.NormalizeRoomName(roomName)
+	limit := globalLimit
+	for pattern, override := range ws.roomMessageBytes {
+		if matched, _ := path.Match(pattern, roomName); matched && override > 0 && override < limit {
+			limit = override
+		}
+	}
+	return limit
+}
+
+// roomPolicy 根据配置的房间模式决定新房间的分发策略
+func (ws *WebSocketService) roomPolicy(roomName string) string {
+	for _, pattern := range ws.broadcastAllRooms {
+		if matched, _ := path.Match(pattern, roomName); matched {
+			return model.RoomPolicyBroadcastAll
+		}
+	}
+	return model.RoomPolicyEventFiltered
+}
+
+// roomDelivery 根据房间名决定新建房间的投递保证
+func (ws *WebSocketService) roomDelivery(roomName string) string {
+	for _, pattern := range ws.bufferedRooms {
+		if matched, _ := path.Match(pattern, roomName); matched {
+			return model.RoomDeliveryBuffered
+		}
+	}
+	return model.RoomDeliveryBestEffort
+}
+
+// receivesEvent 按房间策略和成员在该房间内的事件订阅判断是否应收到该事件的消息
+func receivesEvent(policy string, roomEvents map[string]bool, event string) bool {
+	if policy == model.RoomPolicyBroadcastAll {
+		// 广播房间的成员收到所有消息
+		return true
+	}
+	if event == "" || event == "signal:all" {
+		// 广播消息，检查是否订阅了signal:all
+		return roomEvents["signal:all"]
+	}
+	// 特定事件消息，检查是否订阅了该事件、signal:all或匹配的通配模式
+	if roomEvents[event] || roomEvents["signal:all"] {
+		return true
+	}
+	for pattern := range roomEvents {
+		if matchEventPattern(pattern, event) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchEventPattern 以*结尾的订阅为前缀匹配（如file:*匹配file:start），其余订阅不在此匹配
+func matchEventPattern(pattern, event string) bool {
+	prefix, ok := strings.CutSuffix(pattern, "*")
+	return ok && strings.HasPrefix(event, prefix)
+}
+
+// GetRoomStats 获取所有房间的统计信息（含各事件的订阅人数），按房间名排序
+func (ws *WebSocketService) GetRoomStats() []map[string]interface{} {
+	// 锁顺序与leaveRoom一致：先rooms后clients
+	ws.roomsMutex.RLock()
+	defer ws.roomsMutex.RUnlock()
+	ws.clientsMutex.RLock()
+	defer ws.clientsMutex.RUnlock()
+
+	stats := make([]map[string]interface{}, 0, len(ws.rooms))
+	for _, room := range ws.rooms {
+		stats = append(stats, map[string]interface{}{
+			"name":              room.Name,
+			"display_name":      room.DisplayName,
+			"member_count":      len(room.ClientIDs),
+			"max_users":         room.MaxUsers,
+			"policy":            room.Policy,
+			"delivery":          room.Delivery,
+			"event_subscribers": ws.eventSubscribersLocked(room),
+			"created_at":        room.CreatedAt,
+			"updated_at":        room.UpdatedAt,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i]["name"].(string) < stats[j]["name"].(string)
+	})
+	return stats
+}
+
+// ListRooms 列出所有房间的概要信息，按成员数从多到少排序（成员数相同时按房间名）；
+// 数据在读锁内复制，序列化时不会与房间变更竞争
+func (ws *WebSocketService) ListRooms() []map[string]interface{} {
+	ws.roomsMutex.RLock()
+	rooms := make([]map[string]interface{}, 0, len(ws.rooms))
+	for _, room := range ws.rooms {
+		rooms = append(rooms, map[string]interface{}{
+			"name":         room.Name,
+			"display_name": room.DisplayName,
+			"member_count": len(room.ClientIDs),
+			"created_at":   room.CreatedAt,
+			"updated_at":   room.UpdatedAt,
+		})
+	}
+	ws.roomsMutex.RUnlock()
+
+	sort.Slice(rooms, func(i, j int) bool {
+		ci, cj := rooms[i]["member_count"].(int), rooms[j]["member_count"].(int)
+		if ci != cj {
+			return ci > cj
+		}
+		return rooms[i]["name"].(string) < rooms[j]["name"].(string)
+	})
+	return rooms
+}
+
+// GetRoomEventStats 房间内各事件的订阅人数（始终包含signal:all），房间不存在时返回false
+func (ws *WebSocketService) GetRoomEventStats(roomName string) (map[string]int, bool) {
+	roomName = ws.roomService.NormalizeRoomName(roomName)
+	ws.roomsMutex.RLock()
+	defer ws.roomsMutex.RUnlock()
+
+	room, exists := ws.rooms[roomName]
+	if !exists {
+		return nil, false
+	}
+	ws.clientsMutex.RLock()
+	defer ws.clientsMutex.RUnlock()
+	return ws.eventSubscribersLocked(room), true
+}
+
+// eventSubscribersLocked 统计房间成员在该房间内订阅的各事件人数（通配订阅如file:*按原样计数）；
+// 调用时须依次持有roomsMutex和clientsMutex（读锁即可）
+func (ws *WebSocketService) eventSubscribersLocked(room *model.Room) map[string]int {
+	counts := map[string]int{"signal:all": 0}
+	for clientID := range room.ClientIDs {
+		client, exists := ws.clients[clientID]
+		if !exists {
+			continue
+		}
+		for event := range client.Events[room.Name] {
+			counts[event]++
+		}
+	}
+	return counts
 }
 
 // GetRoomInfo 获取房间信息
 func (ws *WebSocketService) GetRoomInfo(roomName string) map[string]interface{} {
+	roomName = ws.roomService.NormalizeRoomName(roomName)
 	ws.roomsMutex.RLock()
 	defer ws.roomsMutex.RUnlock()
 
@@ -323,8 +1300,11 @@ func (ws *WebSocketService) GetRoomInfo(roomName string) map[string]interface{}
 
 	return map[string]interface{}{
 		"name":         room.Name,
+		"display_name": room.DisplayName,
 		"client_count": len(room.ClientIDs),
-		"max_users":    ws.maxRoomUsers,
+		"max_users":    room.MaxUsers,
+		"policy":       room.Policy,
+		"delivery":     room.Delivery,
 		"created_at":   room.CreatedAt,
 		"updated_at":   room.UpdatedAt,
 	}
@@ -332,20 +1312,43 @@ func (ws *WebSocketService) GetRoomInfo(roomName string) map[string]interface{}
 
 // startMaintenance 启动维护任务
 func (ws *WebSocketService) startMaintenance() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(ws.maintenanceInterval)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		ws.cleanupInactiveClients()
-		logger.CleanupLogs()
+		ws.runMaintenance()
 	}
 }
 
+// runMaintenance 执行一轮维护任务，panic时记录日志并等待下一轮
+func (ws *WebSocketService) runMaintenance() {
+	defer func() {
+		if r := recover(); r != nil {
+			logrus.WithField("panic", r).Error("维护任务发生panic")
+		}
+	}()
+
+	ws.cleanupInactiveClients()
+	ws.DisconnectExpiredTokens()
+	ws.cleanupExpiredSessions()
+	ws.cleanupIdleRooms()
+	ws.verifyLimiter.pruneFull()
+	logger.CleanupLogs()
+	ws.rates.sample(ws.messagesPublished.Load(), ws.connectionCount.Load())
+	ws.lastMaintenanceRun.Store(time.Now().UnixNano())
+}
+
+// MaintenanceStatus 返回维护任务最近一次完成的时间，以及是否仍在按时运行（未超过两个周期）
+func (ws *WebSocketService) MaintenanceStatus() (time.Time, bool) {
+	lastRun := time.Unix(0, ws.lastMaintenanceRun.Load())
+	return lastRun, time.Since(lastRun) <= 2*ws.maintenanceInterval
+}
+
 // cleanupInactiveClients 清理非活跃客户端
 func (ws *WebSocketService) cleanupInactiveClients() {
 	ws.clientsMutex.RLock()
 	var inactiveClients []string
-	timeout := 5 * time.Minute
+	timeout := ws.inactiveTimeout
 
 	for clientID, client := range ws.clients {
 		if time.Since(client.LastPing) > timeout {
@@ -356,34 +1359,178 @@ func (ws *WebSocketService) cleanupInactiveClients() {
 
 	// 移除非活跃客户端
 	for _, clientID := range inactiveClients {
-		ws.RemoveClient(clientID)
+		ws.DisconnectClient(clientID, DisconnectInactive)
 		logrus.WithField("client_id", clientID).Info("清理非活跃客户端")
 	}
 }
 
-// Shutdown 关闭服务
-func (ws *WebSocketService) Shutdown() {
+// AllowedRoom 连接所用JWT限定的房间，未限定时返回空字符串
+func (ws *WebSocketService) AllowedRoom(client *model.Client) string {
+	ws.clientsMutex.RLock()
+	defer ws.clientsMutex.RUnlock()
+	allowedRoom, _ := client.Metadata["allowed_room"].(string)
+	return allowedRoom
+}
+
+// TokenExpired 连接所用的JWT是否已过期（开启宽限期时，过期但未断开的连接为只读）
+func (ws *WebSocketService) TokenExpired(client *model.Client) bool {
+	expiresAt := client.TokenExpiresAt.Load()
+	return expiresAt > 0 && time.Now().Unix() >= expiresAt
+}
+
+// DisconnectExpiredTokens 断开JWT已过期的客户端：先发送token:expired通知，等待写出后再关闭连接；返回断开的客户端数。
+// 开启宽限期时，宽限期内的客户端只收到一次只读通知，超过宽限期仍未刷新才断开
+func (ws *WebSocketService) DisconnectExpiredTokens() int {
+	now := time.Now().Unix()
+	graceSeconds := int64(ws.tokenExpiryGrace / time.Second)
+
+	ws.clientsMutex.RLock()
+	var expired, readOnly []*model.Client
+	for _, client := range ws.clients {
+		expiresAt := client.TokenExpiresAt.Load()
+		if expiresAt <= 0 || now < expiresAt {
+			continue
+		}
+		if now < expiresAt+graceSeconds {
+			if client.TokenExpiryNotified.Swap(expiresAt) != expiresAt {
+				readOnly = append(readOnly, client)
+			}
+			continue
+		}
+		expired = append(expired, client)
+	}
+	ws.clientsMutex.RUnlock()
+
+	for _, client := range readOnly {
+		expiresAt := client.TokenExpiresAt.Load()
+		ws.sendToClient(client, model.NewWebSocketMessage(model.MessageTypeTokenExpired, "", "", map[string]interface{}{
+			"expired_at":    expiresAt,
+			"read_only":     true,
+			"disconnect_at": expiresAt + graceSeconds,
+		}))
+		logrus.WithFields(logrus.Fields{
+			"client_id":     client.ID,
+			"user_id":       client.UserID,
+			"disconnect_at": expiresAt + graceSeconds,
+		}).Info("客户端token已过期，连接转为只读")
+	}
+
+	if len(expired) == 0 {
+		return 0
+	}
+
+	for _, client := range expired {
+		ws.sendToClient(client, model.NewWebSocketMessage(model.MessageTypeTokenExpired, "", "", map[string]interface{}{
+			"expired_at": client.TokenExpiresAt.Load(),
+		}))
+	}
+	ws.waitForSendQueues(expired, closeWriteTimeout)
+
+	disconnected := 0
+	for _, client := range expired {
+		// 等待期间客户端可能已刷新token
+		if expiresAt := client.TokenExpiresAt.Load(); expiresAt == 0 || time.Now().Unix() < expiresAt {
+			continue
+		}
+		ws.DisconnectClient(client.ID, DisconnectTokenExpired)
+		disconnected++
+		logrus.WithFields(logrus.Fields{
+			"client_id": client.ID,
+			"user_id":   client.UserID,
+		}).Info("客户端token已过期，断开连接")
+	}
+	return disconnected
+}
+
+// Shutdown 关闭服务：先通知所有客户端，等待发送队列写出（最多宽限期），再关闭连接
+func (ws *WebSocketService) Shutdown(reason string) {
+	ws.ready.Store(false)
 	logrus.Info("正在关闭WebSocket服务...")
 
 	ws.clientsMutex.Lock()
 	clientIDs := make([]string, 0, len(ws.clients))
-	for clientID := range ws.clients {
+	clients := make([]*model.Client, 0, len(ws.clients))
+	for clientID, client := range ws.clients {
 		clientIDs = append(clientIDs, clientID)
+		clients = append(clients, client)
 	}
 	ws.clientsMutex.Unlock()
 
+	// 通知客户端服务即将关闭，避免客户端立即重连
+	notice := model.NewWebSocketMessage(model.MessageTypeShutdown, "", "", map[string]interface{}{
+		"reason":             reason,
+		"reconnect_delay_ms": ws.shutdownReconnectDelay.Milliseconds(),
+	})
+	for _, client := range clients {
+		ws.sendToClient(client, notice)
+	}
+	ws.waitForSendQueues(clients, ws.shutdownGrace)
+
 	// 逐个清理客户端
 	for _, clientID := range clientIDs {
-		ws.RemoveClient(clientID)
+		ws.DisconnectClient(clientID, DisconnectShutdown)
 	}
 
 	ws.roomsMutex.Lock()
 	ws.rooms = make(map[string]*model.Room)
+	ws.ownedRooms = make(map[string]int)
 	ws.roomsMutex.Unlock()
 
 	logrus.Info("WebSocket服务已关闭")
 }
 
+// waitForSendQueues 等待客户端已入队的消息全部写出，最多等待timeout
+func (ws *WebSocketService) waitForSendQueues(clients []*model.Client, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		pending := false
+		for _, client := range clients {
+			select {
+			case <-client.Done:
+				continue // 已断开的客户端无需等待
+			default:
+			}
+			if client.Pending.Load() > 0 {
+				pending = true
+				break
+			}
+		}
+		if !pending {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// GetCounters 获取启动以来的累计计数
+func (ws *WebSocketService) GetCounters() Counters {
+	return Counters{
+		ConnectionsAccepted: ws.connectionsAccepted.Load(),
+		MessagesPublished:   ws.messagesPublished.Load(),
+		MessagesDelivered:   ws.messagesDelivered.Load(),
+		ErrorsSent:          ws.errorsSent.Load(),
+		PublishesShed:       ws.publishesShed.Load(),
+		MessagesDropped:     ws.messagesDropped.Load(),
+		Disconnects:         ws.disconnects.snapshot(),
+	}
+}
+
+// GetLoad 获取当前负载（仅原子读取，不加锁）
+func (ws *WebSocketService) GetLoad() map[string]interface{} {
+	connections := ws.connectionCount.Load()
+
+	loadPercent := 0.0
+	if ws.maxConnections > 0 {
+		loadPercent = float64(connections) * 100 / float64(ws.maxConnections)
+	}
+
+	return map[string]interface{}{
+		"connections":     connections,
+		"max_connections": ws.maxConnections,
+		"load_percent":    loadPercent,
+	}
+}
+
 // GetStats 获取基本统计信息
 func (ws *WebSocketService) GetStats() map[string]interface{} {
 	ws.clientsMutex.RLock()
@@ -394,8 +1541,24 @@ func (ws *WebSocketService) GetStats() map[string]interface{} {
 	totalRooms := len(ws.rooms)
 	ws.roomsMutex.RUnlock()
 
+	ws.originsMutex.Lock()
+	origins := make(map[string]int, len(ws.originCounts))
+	for origin, count := range ws.originCounts {
+		origins[origin] = count
+	}
+	ws.originsMutex.Unlock()
+
 	return map[string]interface{}{
-		"active_connections": activeConnections,
-		"total_rooms":        totalRooms,
+		"active_connections":        activeConnections,
+		"total_rooms":               totalRooms,
+		"origins":                   origins,
+		"rates":                     ws.rates.rates(ws.messagesPublished.Load(), ws.connectionCount.Load()),
+		"messages_published":        ws.messagesPublished.Load(),
+		"messages_delivered":        ws.messagesDelivered.Load(),
+		"publishes_shed":            ws.publishesShed.Load(),
+		"messages_dropped":          ws.messagesDropped.Load(),
+		"resume_sessions":           ws.ResumeSessionCount(),
+		"disconnects":               ws.disconnects.snapshot(),
+		"publish_fanout_latency_ms": ws.fanoutLatency.snapshot(),
 	}
 }
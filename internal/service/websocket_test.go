@@ -0,0 +1,578 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"letshare-server/internal/config"
+	"letshare-server/internal/model"
+	"testing"
+	"time"
+)
+
+// newQuotaTestService 创建每个用户最多拥有两个房间的服务
+func newQuotaTestService(t *testing.T) *WebSocketService {
+	t.Helper()
+	ws := NewWebSocketService(config.WebSocket{
+		MaxRoomUsers:         10,
+		MaxRoomsOwnedPerUser: 2,
+	})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	return ws
+}
+
+// addAuthClient 添加一个指定认证方式的客户端
+func addAuthClient(ws *WebSocketService, id, userID, authMethod string) *model.Client {
+	client := model.NewClient(id, userID, nil)
+	client.AuthMethod = authMethod
+	ws.AddClient(client)
+	return client
+}
+
+// createRooms 依次创建房间，返回第一个失败的错误
+func createRooms(ws *WebSocketService, clientID string, names ...string) error {
+	for _, name := range names {
+		if _, err := ws.SubscribeToRoom(clientID, name, "signal:all", false); err != nil {
+			return fmt.Errorf("创建%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func TestOwnedRoomQuotaSharedByVerifiedUser(t *testing.T) {
+	ws := newQuotaTestService(t)
+	addAuthClient(ws, "phone", "alice", AuthMethodJWT)
+	addAuthClient(ws, "laptop", "alice", AuthMethodJWT)
+
+	if err := createRooms(ws, "phone", "room-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := createRooms(ws, "laptop", "room-2"); err != nil {
+		t.Fatal(err)
+	}
+	// 同一JWT用户的多个连接共享配额
+	if err := createRooms(ws, "laptop", "room-3"); err == nil {
+		t.Fatal("同一用户超过配额后仍能创建房间")
+	}
+
+	// 房间删除后释放配额
+	if err := ws.UnsubscribeFromRoom("phone", "room-1", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := createRooms(ws, "laptop", "room-3"); err != nil {
+		t.Fatalf("释放配额后应能创建房间: %v", err)
+	}
+}
+
+func TestOwnedRoomQuotaIgnoresClaimedUserID(t *testing.T) {
+	ws := newQuotaTestService(t)
+	addAuthClient(ws, "victim", "alice", AuthMethodJWT)
+	addAuthClient(ws, "claimer", "alice", AuthMethodAuthToken)
+	addAuthClient(ws, "claimer-2", "alice", AuthMethodAuthToken)
+
+	// 自行声明userId的连接按客户端ID计数，不会占用该用户的配额
+	if err := createRooms(ws, "claimer", "c-1", "c-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := createRooms(ws, "claimer", "c-3"); err == nil {
+		t.Fatal("单个连接超过配额后仍能创建房间")
+	}
+	if err := createRooms(ws, "claimer-2", "d-1", "d-2"); err != nil {
+		t.Fatalf("声明相同userId的其他连接应有独立配额: %v", err)
+	}
+	if err := createRooms(ws, "victim", "v-1", "v-2"); err != nil {
+		t.Fatalf("JWT用户的配额不应被声明相同userId的连接占用: %v", err)
+	}
+}
+
+func TestOwnedRoomQuotaOnlyCountsCreatedRooms(t *testing.T) {
+	ws := newQuotaTestService(t)
+	addAuthClient(ws, "owner", "alice", AuthMethodJWT)
+	addAuthClient(ws, "guest", "bob", AuthMethodJWT)
+
+	if err := createRooms(ws, "owner", "a-1", "a-2", "a-3"); err == nil {
+		t.Fatal("超过配额后仍能创建房间")
+	}
+	// 加入他人创建的房间不计入配额
+	if err := createRooms(ws, "guest", "b-1", "b-2", "a-1", "a-2"); err != nil {
+		t.Fatalf("加入已有房间不应受配额限制: %v", err)
+	}
+}
+
+func TestOwnedRoomQuotaDisabledByDefault(t *testing.T) {
+	ws := newPresenceTestService(t)
+	addAuthClient(ws, "owner", "alice", AuthMethodJWT)
+	if err := createRooms(ws, "owner", "r-1", "r-2", "r-3", "r-4", "r-5"); err != nil {
+		t.Fatalf("默认不限制创建的房间数: %v", err)
+	}
+}
+
+func TestGetClientSubscriptions(t *testing.T) {
+	ws := newPresenceTestService(t)
+	ws.AddClient(model.NewClient("c1", "alice", nil))
+	subscribe := func(room, event string) {
+		t.Helper()
+		if _, err := ws.SubscribeToRoom("c1", room, event, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subscribe("lobby", "signal:offer")
+	subscribe("lobby", "signal:answer")
+	subscribe("chat", "")
+
+	subscriptions, err := ws.GetClientSubscriptions("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 事件按房间划分且已排序，未指定事件时为signal:all
+	want := map[string]string{
+		"lobby": "[signal:answer signal:offer]",
+		"chat":  "[signal:all]",
+	}
+	if len(subscriptions) != len(want) {
+		t.Fatalf("subscriptions = %v, want %v", subscriptions, want)
+	}
+	for room, events := range want {
+		if got := fmt.Sprint(subscriptions[room]); got != events {
+			t.Fatalf("%s的事件 = %s, want %s", room, got, events)
+		}
+	}
+
+	if _, err := ws.GetClientSubscriptions("missing"); err == nil {
+		t.Fatal("客户端不存在时应返回错误")
+	}
+}
+
+func TestOriginTrackingCapped(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, MaxTrackedOrigins: 2})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	connect := func(id, origin string) {
+		client := model.NewClient(id, id, nil)
+		client.Metadata["origin"] = origin
+		ws.AddClient(client)
+	}
+	origins := func() string {
+		return fmt.Sprint(ws.GetStats()["origins"])
+	}
+
+	connect("a1", "https://a.example")
+	connect("a2", "https://a.example")
+	connect("b1", "https://b.example")
+	// 超出跟踪上限的新Origin计入other，已跟踪的Origin照常计数
+	connect("c1", "https://c.example")
+	connect("d1", "https://d.example")
+	if got, want := origins(), "map[https://a.example:2 https://b.example:1 other:2]"; got != want {
+		t.Fatalf("origins = %s, want %s", got, want)
+	}
+
+	// 断开后从原分组中减去，归零的Origin释放名额
+	ws.RemoveClient("b1", DisconnectClientClose)
+	ws.RemoveClient("c1", DisconnectClientClose)
+	if got, want := origins(), "map[https://a.example:2 other:1]"; got != want {
+		t.Fatalf("断开后 origins = %s, want %s", got, want)
+	}
+	connect("e1", "https://e.example")
+	if got, want := origins(), "map[https://a.example:2 https://e.example:1 other:1]"; got != want {
+		t.Fatalf("释放名额后 origins = %s, want %s", got, want)
+	}
+}
+
+func TestMaintenanceStatus(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, MaintenanceIntervalSeconds: 30})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	if _, ok := ws.MaintenanceStatus(); !ok {
+		t.Fatal("刚启动的服务应视为维护任务正常")
+	}
+
+	// 超过两个周期未完成维护任务
+	ws.lastMaintenanceRun.Store(time.Now().Add(-61 * time.Second).UnixNano())
+	if _, ok := ws.MaintenanceStatus(); ok {
+		t.Fatal("维护任务超过两个周期未运行时应返回异常")
+	}
+
+	ws.runMaintenance()
+	lastRun, ok := ws.MaintenanceStatus()
+	if !ok || time.Since(lastRun) > time.Second {
+		t.Fatalf("完成一轮维护后 last_run = %v, ok = %v", lastRun, ok)
+	}
+}
+
+func TestGetLoad(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxConnections int
+		clients        int
+		wantPercent    float64
+	}{
+		{"未设置连接上限", 0, 3, 0},
+		{"按上限计算负载", 4, 3, 75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, MaxConnections: tt.maxConnections})
+			t.Cleanup(func() { ws.Shutdown("test") })
+			for i := 0; i < tt.clients; i++ {
+				ws.AddClient(model.NewClient(fmt.Sprintf("c%d", i), "alice", nil))
+			}
+
+			load := ws.GetLoad()
+			if load["connections"] != int64(tt.clients) || load["max_connections"] != tt.maxConnections || load["load_percent"] != tt.wantPercent {
+				t.Fatalf("GetLoad() = %v, want connections=%d max_connections=%d load_percent=%v", load, tt.clients, tt.maxConnections, tt.wantPercent)
+			}
+		})
+	}
+}
+
+func TestNormalizeEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize bool
+		want      string
+	}{
+		{"默认保留所有事件", false, "[signal:all signal:answer signal:offer]"},
+		{"订阅signal:all后精简", true, "[signal:all]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, NormalizeEvents: tt.normalize})
+			t.Cleanup(func() { ws.Shutdown("test") })
+			ws.AddClient(model.NewClient("c1", "alice", nil))
+			for _, event := range []string{"signal:offer", "signal:all", "signal:answer"} {
+				if _, err := ws.SubscribeToRoom("c1", "lobby", event, false); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			subscriptions, err := ws.GetClientSubscriptions("c1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(subscriptions["lobby"]); got != tt.want {
+				t.Fatalf("lobby的事件 = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// messageEvents 取出客户端发送队列中已有的房间消息，返回其事件
+func messageEvents(client *model.Client) []string {
+	var events []string
+	for {
+		select {
+		case message := <-client.Send:
+			if message.Type == model.MessageTypeMessage {
+				events = append(events, message.Event)
+			}
+		default:
+			return events
+		}
+	}
+}
+
+func TestRoomPolicy(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, BroadcastAllRooms: []string{"chat-*"}})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	ws.AddClient(model.NewClient("sender", "alice", nil))
+	receiver := model.NewClient("receiver", "bob", nil)
+	ws.AddClient(receiver)
+	for _, room := range []string{"chat-1", "lobby"} {
+		if _, err := ws.SubscribeToRoom("sender", room, "signal:all", false); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ws.SubscribeToRoom("receiver", room, "signal:offer", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		room       string
+		wantPolicy string
+		wantEvents string
+	}{
+		{"匹配模式的房间广播所有事件", "chat-1", model.RoomPolicyBroadcastAll, "[signal:offer signal:answer]"},
+		{"其余房间按订阅过滤", "lobby", model.RoomPolicyEventFiltered, "[signal:offer]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if policy := ws.GetRoomInfo(tt.room)["policy"]; policy != tt.wantPolicy {
+				t.Fatalf("policy = %v, want %s", policy, tt.wantPolicy)
+			}
+			messageEvents(receiver)
+			for _, event := range []string{"signal:offer", "signal:answer"} {
+				if _, err := ws.PublishToRoom("sender", tt.room, event, json.RawMessage(`{}`)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := fmt.Sprint(messageEvents(receiver)); got != tt.wantEvents {
+				t.Fatalf("收到的事件 = %s, want %s", got, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestMaxRoomsPerClient(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, MaxRoomsPerClient: 2})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	addAuthClient(ws, "c1", "alice", AuthMethodAuthToken)
+
+	if err := createRooms(ws, "c1", "room-1", "room-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := createRooms(ws, "c1", "room-3"); err == nil {
+		t.Fatal("超过房间订阅上限后仍能订阅新房间")
+	}
+	// 在已加入的房间追加事件不受上限影响
+	if _, err := ws.SubscribeToRoom("c1", "room-1", "signal:offer", false); err != nil {
+		t.Fatalf("已加入的房间应能追加事件: %v", err)
+	}
+
+	// 退出房间后释放名额
+	if err := ws.UnsubscribeFromRoom("c1", "room-2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := createRooms(ws, "c1", "room-3"); err != nil {
+		t.Fatalf("退出房间后应能订阅新房间: %v", err)
+	}
+}
+
+func TestMessageTotals(t *testing.T) {
+	ws := newPresenceTestService(t)
+	joinRoom(t, ws, "a", "alice", "lobby")
+	joinRoom(t, ws, "b", "bob", "lobby")
+	joinRoom(t, ws, "c", "carol", "lobby")
+
+	// 一次发布投递给房间内其他两个成员
+	for i := 0; i < 2; i++ {
+		if _, err := ws.PublishToRoom("a", "lobby", "signal:all", json.RawMessage(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 未通过检查的发布不计数
+	if _, err := ws.PublishToRoom("a", "other", "signal:all", json.RawMessage(`{}`)); err == nil {
+		t.Fatal("向未加入的房间发布应失败")
+	}
+
+	stats := ws.GetStats()
+	if stats["messages_published"] != int64(2) || stats["messages_delivered"] != int64(4) {
+		t.Fatalf("messages_published = %v, messages_delivered = %v, want 2, 4", stats["messages_published"], stats["messages_delivered"])
+	}
+	if counters := ws.GetCounters(); counters.MessagesPublished != 2 {
+		t.Fatalf("GetCounters().MessagesPublished = %d, want 2", counters.MessagesPublished)
+	}
+}
+
+func TestEffectiveRoomMaxUsers(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, RoomUserLimits: map[string]int{"meeting-*": 2}})
+	t.Cleanup(func() { ws.Shutdown("test") })
+	for _, id := range []string{"a", "b", "c"} {
+		addAuthClient(ws, id, id, AuthMethodAuthToken)
+	}
+
+	tests := []struct {
+		name string
+		room string
+		want int
+	}{
+		{"全局上限", "lobby", 10},
+		{"按模式覆盖", "meeting-1", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxUsers, err := ws.SubscribeToRoom("a", tt.room, "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if maxUsers != tt.want {
+				t.Fatalf("订阅确认的max_users = %d, want %d", maxUsers, tt.want)
+			}
+		})
+	}
+
+	// 房间已满的错误报告该房间实际生效的上限
+	if _, err := ws.SubscribeToRoom("b", "meeting-1", "", false); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ws.SubscribeToRoom("c", "meeting-1", "", false)
+	var fullErr *RoomFullError
+	if !errors.As(err, &fullErr) || fullErr.MaxUsers != 2 {
+		t.Fatalf("SubscribeToRoom() error = %v, want RoomFullError(MaxUsers=2)", err)
+	}
+}
+
+func TestWildcardEventSubscription(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		event  string
+		want   bool
+	}{
+		{"前缀匹配", []string{"file:*"}, "file:start", true},
+		{"前缀匹配多级事件", []string{"file:*"}, "file:chunk:ack", true},
+		{"不同前缀", []string{"file:*"}, "chat:message", false},
+		{"通配订阅不接收广播消息", []string{"file:*"}, "signal:all", false},
+		{"单独的*匹配所有具名事件", []string{"*"}, "chat:message", true},
+		{"*只在结尾生效", []string{"file:*:ack"}, "file:chunk:ack", false},
+		{"精确订阅", []string{"file:start"}, "file:start", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roomEvents := make(map[string]bool)
+			for _, event := range tt.events {
+				roomEvents[event] = true
+			}
+			if got := receivesEvent(model.RoomPolicyEventFiltered, roomEvents, tt.event); got != tt.want {
+				t.Fatalf("receivesEvent(%v, %q) = %v, want %v", tt.events, tt.event, got, tt.want)
+			}
+		})
+	}
+
+	ws := newPresenceTestService(t)
+	joinRoom(t, ws, "a", "alice", "lobby")
+	bob := model.NewClient("b", "bob", nil)
+	ws.AddClient(bob)
+	if _, err := ws.SubscribeToRoom("b", "lobby", "file:*", false); err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range []string{"file:start", "chat:message", "file:end"} {
+		if _, err := ws.PublishToRoom("a", "lobby", event, []byte(`{}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := messageEvents(bob); len(got) != 2 || got[0] != "file:start" || got[1] != "file:end" {
+		t.Fatalf("bob收到的事件 = %v, want [file:start file:end]", got)
+	}
+}
+
+func TestPublishToDeletedRoom(t *testing.T) {
+	ws := newPresenceTestService(t)
+	joinRoom(t, ws, "a", "alice", "lobby")
+
+	// 模拟发布前房间被并发删除：客户端的订阅还在，房间已不存在
+	ws.roomsMutex.Lock()
+	delete(ws.rooms, "lobby")
+	ws.roomsMutex.Unlock()
+
+	if _, err := ws.PublishToRoom("a", "lobby", "signal:all", []byte(`{}`)); !errors.Is(err, ErrRoomGone) {
+		t.Fatalf("PublishToRoom() error = %v, want ErrRoomGone", err)
+	}
+	if _, err := ws.SendChat("a", "lobby", "hi"); !errors.Is(err, ErrRoomGone) {
+		t.Fatalf("SendChat() error = %v, want ErrRoomGone", err)
+	}
+	// 未订阅的房间仍是普通错误
+	if _, err := ws.PublishToRoom("a", "other", "signal:all", []byte(`{}`)); err == nil || errors.Is(err, ErrRoomGone) {
+		t.Fatalf("PublishToRoom() error = %v, want 非ErrRoomGone的错误", err)
+	}
+}
+
+func TestRoomMessageLimit(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{
+		MaxRoomUsers:     10,
+		RoomMessageBytes: map[string]int{"chat-*": 4096, "chat-small*": 1024, "huge-*": 1 << 30, "zero-*": 0},
+	})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	tests := []struct {
+		room string
+		want int
+	}{
+		{"chat-1", 4096},
+		{"Chat-1", 4096},       // 按规范化后的房间名匹配
+		{"chat-small-1", 1024}, // 匹配多个模式时取最小值
+		{"huge-1", 512 * 1024}, // 不超过全局上限
+		{"zero-1", 512 * 1024}, // 0不作为覆盖值
+		{"lobby", 512 * 1024},  // 未匹配时使用全局上限
+	}
+	for _, tt := range tests {
+		if got := ws.RoomMessageLimit(tt.room, 512*1024); got != tt.want {
+			t.Fatalf("RoomMessageLimit(%q) = %d, want %d", tt.room, got, tt.want)
+		}
+	}
+}
+
+func TestTokenExpiryGrace(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 10, TokenExpiryGraceSeconds: 60})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	now := time.Now().Unix()
+	inGrace := model.NewClient("grace", "alice", nil)
+	inGrace.TokenExpiresAt.Store(now - 1)
+	pastGrace := model.NewClient("past", "bob", nil)
+	pastGrace.TokenExpiresAt.Store(now - 120)
+	valid := model.NewClient("valid", "carol", nil)
+	valid.TokenExpiresAt.Store(now + 3600)
+	for _, client := range []*model.Client{inGrace, pastGrace, valid} {
+		ws.AddClient(client)
+	}
+
+	if disconnected := ws.DisconnectExpiredTokens(); disconnected != 1 {
+		t.Fatalf("断开数 = %d, want 1（只有超过宽限期的）", disconnected)
+	}
+	if _, online := ws.GetClient("past"); online {
+		t.Fatal("超过宽限期的客户端应被断开")
+	}
+
+	// 宽限期内的连接保持在线、转为只读，并只收到一次通知
+	if _, online := ws.GetClient("grace"); !online || !ws.TokenExpired(inGrace) {
+		t.Fatalf("宽限期内应在线且只读: online=%v expired=%v", online, ws.TokenExpired(inGrace))
+	}
+	notice := <-inGrace.Send
+	var data struct {
+		ReadOnly     bool  `json:"read_only"`
+		DisconnectAt int64 `json:"disconnect_at"`
+	}
+	if err := json.Unmarshal(notice.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if notice.Type != model.MessageTypeTokenExpired || !data.ReadOnly || data.DisconnectAt != now-1+60 {
+		t.Fatalf("只读通知 = %+v %+v", notice, data)
+	}
+	ws.DisconnectExpiredTokens()
+	if len(inGrace.Send) != 0 {
+		t.Fatal("同一过期时间只通知一次")
+	}
+
+	if ws.TokenExpired(valid) || len(valid.Send) != 0 {
+		t.Fatal("未过期的连接不受影响")
+	}
+}
+
+func TestResubscribeAddsEvent(t *testing.T) {
+	ws := NewWebSocketService(config.WebSocket{MaxRoomUsers: 2, MaxRoomsPerClient: 1})
+	t.Cleanup(func() { ws.Shutdown("test") })
+
+	alice := model.NewClient("a", "alice", nil)
+	ws.AddClient(alice)
+	if _, err := ws.SubscribeToRoom("a", "lobby", "file:offer", false); err != nil {
+		t.Fatal(err)
+	}
+	bob := joinRoom(t, ws, "b", "bob", "lobby")
+	presenceEvents(t, alice)
+	updatedAt := ws.GetRoomInfo("lobby")["updated_at"]
+
+	// 房间已满、订阅房间数已达上限时，已加入的成员仍可追加事件
+	for _, event := range []string{"file:answer", "file:answer"} {
+		if maxUsers, err := ws.SubscribeToRoom("a", "lobby", event, false); err != nil || maxUsers != 2 {
+			t.Fatalf("追加事件订阅 = (%d, %v), want (2, nil)", maxUsers, err)
+		}
+	}
+
+	subscriptions, _ := ws.GetClientSubscriptions("a")
+	if events := subscriptions["lobby"]; len(events) != 2 {
+		t.Fatalf("alice的事件 = %v, want [file:answer file:offer]", events)
+	}
+	if events := presenceEvents(t, bob); len(events) != 0 {
+		t.Fatalf("追加事件不应广播加入事件: %v", events)
+	}
+	if got := ws.GetRoomInfo("lobby")["updated_at"]; got != updatedAt {
+		t.Fatal("追加事件不应更新房间的成员变化时间")
+	}
+
+	if _, err := ws.PublishToRoom("b", "lobby", "file:answer", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := messageEvents(alice); len(got) != 1 || got[0] != "file:answer" {
+		t.Fatalf("alice收到的事件 = %v, want [file:answer]", got)
+	}
+}
@@ -0,0 +1,101 @@
+package certreload
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// checkInterval 两次检查证书文件修改时间的最小间隔
+const checkInterval = 10 * time.Second
+
+// Reloader 从磁盘加载TLS证书，并在文件变化或手动触发时重新加载
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mutex       sync.RWMutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	lastCheck   time.Time
+}
+
+// New 创建证书重载器并立即加载一次证书
+func New(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 从磁盘重新加载证书（例如收到SIGHUP时调用）
+func (r *Reloader) Reload() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("读取证书文件失败: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("读取私钥文件失败: %w", err)
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("加载证书失败: %w", err)
+	}
+
+	r.mutex.Lock()
+	r.cert = &cert
+	r.certModTime = certInfo.ModTime()
+	r.keyModTime = keyInfo.ModTime()
+	r.lastCheck = time.Now()
+	r.mutex.Unlock()
+
+	logrus.WithField("cert_file", r.certFile).Info("TLS证书已加载")
+	return nil
+}
+
+// GetCertificate 实现tls.Config.GetCertificate，证书文件变化时自动重新加载
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if r.changed() {
+		if err := r.Reload(); err != nil {
+			// 重新加载失败时继续使用旧证书，避免新证书写入一半时中断握手
+			logrus.WithError(err).Warn("TLS证书重新加载失败，继续使用旧证书")
+		}
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.cert, nil
+}
+
+// changed 检查证书文件的修改时间是否变化（按checkInterval节流）
+func (r *Reloader) changed() bool {
+	r.mutex.Lock()
+	if time.Since(r.lastCheck) < checkInterval {
+		r.mutex.Unlock()
+		return false
+	}
+	r.lastCheck = time.Now()
+	certModTime, keyModTime := r.certModTime, r.keyModTime
+	r.mutex.Unlock()
+
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false
+	}
+	return !certInfo.ModTime().Equal(certModTime) || !keyInfo.ModTime().Equal(keyModTime)
+}
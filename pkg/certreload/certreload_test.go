@@ -0,0 +1,133 @@
+package certreload
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert 生成自签名证书写入certFile/keyFile，返回证书的DER编码
+func writeCert(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{certFile, keyFile} {
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return der
+}
+
+// currentCert 跳过检查间隔后取当前证书
+func currentCert(t *testing.T, r *Reloader) []byte {
+	t.Helper()
+	r.mutex.Lock()
+	r.lastCheck = time.Time{}
+	r.mutex.Unlock()
+
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Certificate[0]
+}
+
+func TestReloaderPicksUpChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+	first := writeCert(t, certFile, keyFile, "first", start)
+
+	r, err := New(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(currentCert(t, r), first) {
+		t.Fatal("应返回启动时加载的证书")
+	}
+
+	// 证书续期后，下次握手使用新证书
+	second := writeCert(t, certFile, keyFile, "second", start.Add(time.Minute))
+	if !bytes.Equal(currentCert(t, r), second) {
+		t.Fatal("证书文件变化后应重新加载")
+	}
+
+	// 新文件无效时继续使用旧证书
+	if err := os.WriteFile(certFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(certFile, start.Add(2*time.Minute), start.Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(currentCert(t, r), second) {
+		t.Fatal("重新加载失败时应继续使用旧证书")
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("手动重新加载无效证书应返回错误")
+	}
+}
+
+func TestReloaderThrottlesChecks(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Hour)
+	first := writeCert(t, certFile, keyFile, "first", start)
+
+	r, err := New(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := writeCert(t, certFile, keyFile, "second", start.Add(time.Minute))
+
+	// 检查间隔内不重新读取文件
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cert.Certificate[0], first) {
+		t.Fatal("检查间隔内不应重新加载证书")
+	}
+
+	// SIGHUP时手动重新加载不受间隔限制
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	cert, _ = r.GetCertificate(&tls.ClientHelloInfo{})
+	if !bytes.Equal(cert.Certificate[0], second) {
+		t.Fatal("手动重新加载后应使用新证书")
+	}
+}
@@ -1,9 +1,11 @@
 package logger
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -22,19 +24,58 @@ type LogEntry struct {
 }
 
 type FileHook struct {
-	logDir     string
-	maxEntries int
-	mutex      sync.Mutex
+	logDir          string
+	maxEntries      int
+	maxRewriteBytes int64
+	mutex           sync.Mutex
+
+	// 以追加模式打开的errors.log，以及当前文件大小（用于在两次整理之间限制文件增长）
+	file *os.File
+	size int64
+	day  string // 当前文件对应的日期（YYYY-MM-DD），日期变化时轮转
+
+	maxFileBytes int64 // 大于0时按大小轮转，取代按条目数整理
+	maxBackups   int
 }
 
+// Options 日志系统初始化参数
+type Options struct {
+	Level           string
+	MaxEntries      int
+	MaxRewriteBytes int64  // 读取/整理errors.log时最多处理的字节数，整理后的文件不超过该大小，两次整理之间不超过其两倍
+	FileEnabled     bool   // 为false时不创建日志目录和文件hook，只输出到标准输出
+	MaxFileBytes    int64  // errors.log超过该大小时轮转为errors-YYYY-MM-DD.log，0表示只按日期轮转
+	MaxBackups      int    // 最多保留的轮转文件数
+	HashUserIDs     bool   // 为true时日志中的用户ID替换为加盐哈希
+	UserIDSalt      string // 用户ID哈希的盐值，为空时使用随机盐
+}
+
+// ErrFileLoggingDisabled 文件日志被禁用时GetErrorLogs返回的错误
+var ErrFileLoggingDisabled = errors.New("文件日志已禁用")
+
+// defaultMaxRewriteBytes 未配置时的读写上限（1MB）
+const defaultMaxRewriteBytes int64 = 1 << 20
+
 var (
-	fileHook *FileHook
-	once     sync.Once
+	fileHook     *FileHook
+	fileDisabled bool
+	once         sync.Once
 )
 
 // Init 初始化日志系统
-func Init(level string, maxEntries int) {
+func Init(opts Options) {
 	once.Do(func() {
+		level := opts.Level
+		maxEntries := opts.MaxEntries
+		maxRewriteBytes := opts.MaxRewriteBytes
+		if maxRewriteBytes <= 0 {
+			maxRewriteBytes = defaultMaxRewriteBytes
+		}
+		maxBackups := opts.MaxBackups
+		if maxBackups < 0 {
+			maxBackups = 0
+		}
+
 		// 设置日志级别
 		logLevel, err := logrus.ParseLevel(level)
 		if err != nil {
@@ -43,9 +84,29 @@ func Init(level string, maxEntries int) {
 		logrus.SetLevel(logLevel)
 		
 		// 设置日志格式
-		logrus.SetFormatter(&logrus.JSONFormatter{
+		var formatter logrus.Formatter = &logrus.JSONFormatter{
 			TimestampFormat: time.RFC3339,
-		})
+		}
+		if opts.HashUserIDs {
+			// 要求脱敏时无法生成盐值则拒绝启动，不能输出原始用户ID
+			h, err := newHasher(opts.UserIDSalt)
+			if err != nil {
+				logrus.WithError(err).Fatal("初始化用户ID脱敏失败")
+			}
+			userIDHasher = h
+			formatter = &sanitizingFormatter{inner: formatter}
+		}
+		logrus.SetFormatter(formatter)
+
+		// 内存中保留最近的所有级别日志，与文件日志是否开启无关
+		recentLogs = newRecentHook(maxEntries)
+		logrus.AddHook(recentLogs)
+		
+		if !opts.FileEnabled {
+			fileDisabled = true
+			logrus.WithField("level", level).Info("日志系统已初始化（文件日志已禁用）")
+			return
+		}
 		
 		// 创建日志目录
 		logDir := "logs"
@@ -56,21 +117,38 @@ func Init(level string, maxEntries int) {
 		
 		// 创建文件hook
 		fileHook = &FileHook{
-			logDir:     logDir,
-			maxEntries: maxEntries,
+			logDir:          logDir,
+			maxEntries:      maxEntries,
+			maxRewriteBytes: maxRewriteBytes,
+			maxFileBytes:    opts.MaxFileBytes,
+			maxBackups:      maxBackups,
 		}
 		
 		// 添加hook到logrus
 		logrus.AddHook(fileHook)
 		
 		logrus.WithFields(logrus.Fields{
-			"level":       level,
-			"max_entries": maxEntries,
-			"log_dir":     logDir,
+			"level":             level,
+			"max_entries":       maxEntries,
+			"max_rewrite_bytes": maxRewriteBytes,
+			"max_file_bytes":    opts.MaxFileBytes,
+			"max_backups":       maxBackups,
+			"log_dir":           logDir,
 		}).Info("日志系统已初始化")
 	})
 }
 
+// PrependHook 添加一个在已注册hook之前执行的hook，用于补充字段（如追踪ID），
+// 使文件日志和内存日志也能看到补充的字段
+func PrependHook(hook logrus.Hook) {
+	hooks := make(logrus.LevelHooks)
+	hooks.Add(hook)
+	for level, existing := range logrus.StandardLogger().Hooks {
+		hooks[level] = append(hooks[level], existing...)
+	}
+	logrus.StandardLogger().ReplaceHooks(hooks)
+}
+
 // Fire 实现logrus.Hook接口
 func (hook *FileHook) Fire(entry *logrus.Entry) error {
 	// 只记录错误和警告日志到文件
@@ -90,7 +168,7 @@ func (hook *FileHook) Fire(entry *logrus.Entry) error {
 	
 	// 复制字段
 	for k, v := range entry.Data {
-		logEntry.Fields[k] = v
+		logEntry.Fields[k] = sanitizeValue(k, v)
 	}
 	
 	// 写入文件
@@ -107,131 +185,279 @@ func (hook *FileHook) Levels() []logrus.Level {
 	}
 }
 
-// writeToFile 写入日志到文件
+// writeToFile 以追加方式写入一行日志，条目数的裁剪由CleanupLogs定期完成；
+// 两次整理之间文件超过上限的两倍时立即整理一次，保证文件大小有界
 func (hook *FileHook) writeToFile(entry LogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化日志失败: %w", err)
+	}
+	data = append(data, '\n')
+
+	if err := hook.openFile(); err != nil {
+		return err
+	}
+
+	// 日期变化或写入后超过大小上限时，先轮转再写入新文件
+	today := time.Now().Format("2006-01-02")
+	tooLarge := hook.maxFileBytes > 0 && hook.size > 0 && hook.size+int64(len(data)) > hook.maxFileBytes
+	if hook.day != today || tooLarge {
+		if err := hook.rotate(); err != nil {
+			return err
+		}
+		if err := hook.openFile(); err != nil {
+			return err
+		}
+	}
+
+	n, err := hook.file.Write(data)
+	hook.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("写入日志文件失败: %w", err)
+	}
+
+	if hook.maxFileBytes <= 0 && hook.size > 2*hook.maxRewriteBytes {
+		return hook.compact()
+	}
+	return nil
+}
+
+// rotate 将当前errors.log重命名为errors-YYYY-MM-DD.log（同一天多次轮转时追加序号），
+// 并删除超出maxBackups的旧文件（调用时须持有mutex）
+func (hook *FileHook) rotate() error {
 	filename := filepath.Join(hook.logDir, "errors.log")
-	
-	// 读取现有日志
-	var logs []LogEntry
-	if data, err := ioutil.ReadFile(filename); err == nil {
-		// 尝试解析每一行JSON
-		lines := strings.Split(string(data), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line == "" {
-				continue
-			}
-			var logEntry LogEntry
-			if err := json.Unmarshal([]byte(line), &logEntry); err == nil {
-				logs = append(logs, logEntry)
-			}
+	day := hook.day
+	hook.file.Close()
+	hook.file = nil
+
+	// 空文件无需保留，下次写入时重新创建即可
+	if hook.size == 0 {
+		return nil
+	}
+
+	target := filepath.Join(hook.logDir, fmt.Sprintf("errors-%s.log", day))
+	for i := 1; ; i++ {
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			break
 		}
+		target = filepath.Join(hook.logDir, fmt.Sprintf("errors-%s.%d.log", day, i))
 	}
-	
-	// 添加新日志
-	logs = append(logs, entry)
-	
-	// 如果超过最大条目数，删除最旧的
+	if err := os.Rename(filename, target); err != nil {
+		return fmt.Errorf("轮转日志文件失败: %w", err)
+	}
+
+	hook.pruneBackups()
+	return nil
+}
+
+// pruneBackups 按修改时间删除最旧的轮转文件，只保留maxBackups个
+func (hook *FileHook) pruneBackups() {
+	backups, err := filepath.Glob(filepath.Join(hook.logDir, "errors-*.log"))
+	if err != nil || len(backups) <= hook.maxBackups {
+		return
+	}
+
+	modTimes := make(map[string]time.Time, len(backups))
+	for _, name := range backups {
+		if info, err := os.Stat(name); err == nil {
+			modTimes[name] = info.ModTime()
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return modTimes[backups[i]].Before(modTimes[backups[j]])
+	})
+
+	for _, name := range backups[:len(backups)-hook.maxBackups] {
+		os.Remove(name)
+	}
+}
+
+// openFile 以追加模式打开日志文件（已打开时直接返回）
+func (hook *FileHook) openFile() error {
+	if hook.file != nil {
+		return nil
+	}
+	file, err := os.OpenFile(filepath.Join(hook.logDir, "errors.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("读取日志文件信息失败: %w", err)
+	}
+	hook.file = file
+	hook.size = info.Size()
+	// 已有内容的文件沿用其最后修改的日期，重启后跨天的旧日志也会被轮转
+	hook.day = time.Now().Format("2006-01-02")
+	if hook.size > 0 {
+		hook.day = info.ModTime().Format("2006-01-02")
+	}
+	return nil
+}
+
+// compact 将日志文件裁剪到最近的maxEntries条（调用时须持有mutex）
+func (hook *FileHook) compact() error {
+	filename := filepath.Join(hook.logDir, "errors.log")
+
+	// 读取现有日志
+	logs, err := readTailEntries(filename, hook.maxRewriteBytes)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取日志文件失败: %w", err)
+	}
+
+	// 按时间排序（从旧到新）
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].Timestamp.Before(logs[j].Timestamp)
+	})
+
+	// 保留最新的日志条目
 	if len(logs) > hook.maxEntries {
 		logs = logs[len(logs)-hook.maxEntries:]
 	}
+
+	// 写回文件：写失败时原文件保持不变
+	if err := hook.rewriteFile(filename, logs); err != nil {
+		return err
+	}
+	// 原文件已被替换，追加句柄仍指向旧文件，关闭后下次写入时重新打开
+	if hook.file != nil {
+		hook.file.Close()
+		hook.file = nil
+	}
+	if info, err := os.Stat(filename); err == nil {
+		hook.size = info.Size()
+	}
+	return nil
+}
+
+// rewriteFile 将日志写入同目录的临时文件后重命名覆盖原文件，超出磁盘大小上限时丢弃最旧的条目
+func (hook *FileHook) rewriteFile(filename string, logs []LogEntry) error {
+	lines := make([][]byte, 0, len(logs))
+	var total int64
+	for i := len(logs) - 1; i >= 0; i-- {
+		data, err := json.Marshal(logs[i])
+		if err != nil {
+			continue
+		}
+		data = append(data, '\n')
+		if total+int64(len(data)) > hook.maxRewriteBytes {
+			break
+		}
+		total += int64(len(data))
+		lines = append(lines, data)
+	}
 	
-	// 写回文件
-	file, err := os.Create(filename)
+	file, err := os.CreateTemp(filepath.Dir(filename), "errors-*.tmp")
 	if err != nil {
-		return fmt.Errorf("创建日志文件失败: %w", err)
+		return fmt.Errorf("创建临时日志文件失败: %w", err)
 	}
-	defer file.Close()
 	
-	for _, log := range logs {
-		if data, err := json.Marshal(log); err == nil {
-			file.WriteString(string(data) + "\n")
-		}
+	// lines是从新到旧收集的，按从旧到新写回
+	for i := len(lines) - 1; i >= 0 && err == nil; i-- {
+		_, err = file.Write(lines[i])
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("写回日志文件失败: %w", err)
 	}
 	
 	return nil
 }
 
-// CleanupLogs 清理日志（由维护任务调用）
-func CleanupLogs() {
-	if fileHook == nil {
-		return
+// readTailEntries 从文件末尾读取至多maxBytes字节并解析日志条目，避免大文件占满内存
+func readTailEntries(filename string, maxBytes int64) ([]LogEntry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
 	
-	fileHook.mutex.Lock()
-	defer fileHook.mutex.Unlock()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
 	
-	filename := filepath.Join(fileHook.logDir, "errors.log")
+	offset := int64(0)
+	if info.Size() > maxBytes {
+		offset = info.Size() - maxBytes
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
 	
-	// 读取现有日志
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return
+	reader := bufio.NewReader(io.LimitReader(file, maxBytes))
+	
+	// 从文件中间开始读时，第一行很可能不完整，直接丢弃
+	if offset > 0 {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, nil
+		}
 	}
 	
 	var logs []LogEntry
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
+	for {
+		line, err := reader.ReadString('\n')
 		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+		if line != "" {
+			var logEntry LogEntry
+			if jsonErr := json.Unmarshal([]byte(line), &logEntry); jsonErr == nil {
+				logs = append(logs, logEntry)
+			}
 		}
-		var logEntry LogEntry
-		if err := json.Unmarshal([]byte(line), &logEntry); err == nil {
-			logs = append(logs, logEntry)
+		if err != nil {
+			break
 		}
 	}
 	
-	// 按时间排序
-	sort.Slice(logs, func(i, j int) bool {
-		return logs[i].Timestamp.After(logs[j].Timestamp)
-	})
-	
-	// 保留最新的日志条目
-	if len(logs) > fileHook.maxEntries {
-		logs = logs[:fileHook.maxEntries]
-	}
-	
-	// 写回文件
-	file, err := os.Create(filename)
-	if err != nil {
+	return logs, nil
+}
+
+// CleanupLogs 清理日志（由维护任务调用）
+func CleanupLogs() {
+	if fileHook == nil {
 		return
 	}
-	defer file.Close()
 	
-	for _, log := range logs {
-		if data, err := json.Marshal(log); err == nil {
-			file.WriteString(string(data) + "\n")
-		}
+	fileHook.mutex.Lock()
+	// 按大小轮转时文件已有上限，不再按条目数裁剪
+	var err error
+	if fileHook.maxFileBytes <= 0 {
+		err = fileHook.compact()
+	}
+	fileHook.mutex.Unlock()
+
+	// 释放锁后再记录，这条日志本身也会经过该hook
+	if err != nil {
+		logrus.WithError(err).Error("整理日志文件失败")
 	}
 }
 
 // GetErrorLogs 获取错误日志（用于监控）
 func GetErrorLogs(limit int) ([]LogEntry, error) {
+	if fileDisabled {
+		return nil, ErrFileLoggingDisabled
+	}
 	if fileHook == nil {
 		return nil, fmt.Errorf("日志系统未初始化")
 	}
 	
 	filename := filepath.Join(fileHook.logDir, "errors.log")
 	
-	data, err := ioutil.ReadFile(filename)
+	logs, err := readTailEntries(filename, fileHook.maxRewriteBytes)
 	if err != nil {
 		return nil, err
 	}
 	
-	var logs []LogEntry
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		var logEntry LogEntry
-		if err := json.Unmarshal([]byte(line), &logEntry); err == nil {
-			logs = append(logs, logEntry)
-		}
-	}
-	
 	// 按时间排序，最新的在前
 	sort.Slice(logs, func(i, j int) bool {
 		return logs[i].Timestamp.After(logs[j].Timestamp)
@@ -0,0 +1,176 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newTestFileHook 在临时目录中创建文件hook
+func newTestFileHook(t *testing.T, maxEntries int) *FileHook {
+	t.Helper()
+	hook := &FileHook{
+		logDir:          t.TempDir(),
+		maxEntries:      maxEntries,
+		maxRewriteBytes: defaultMaxRewriteBytes,
+	}
+	t.Cleanup(func() {
+		if hook.file != nil {
+			hook.file.Close()
+		}
+	})
+	return hook
+}
+
+// writeEntries 依次写入n条日志，消息为prefix加序号
+func writeEntries(t *testing.T, hook *FileHook, prefix string, n int) {
+	t.Helper()
+	base := time.Now()
+	for i := 0; i < n; i++ {
+		entry := LogEntry{Timestamp: base.Add(time.Duration(i) * time.Millisecond), Level: "error", Message: fmt.Sprintf("%s-%d", prefix, i)}
+		if err := hook.writeToFile(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readMessages 读取errors.log中的日志消息（从旧到新）
+func readMessages(t *testing.T, hook *FileHook) []string {
+	t.Helper()
+	logs, err := readTailEntries(filepath.Join(hook.logDir, "errors.log"), defaultMaxRewriteBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make([]string, len(logs))
+	for i, entry := range logs {
+		messages[i] = entry.Message
+	}
+	return messages
+}
+
+func TestCompactReplacesFile(t *testing.T) {
+	hook := newTestFileHook(t, 3)
+	writeEntries(t, hook, "old", 5)
+
+	if err := hook.compact(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readMessages(t, hook); fmt.Sprint(got) != "[old-2 old-3 old-4]" {
+		t.Fatalf("整理后的日志 = %v, want 最新的3条", got)
+	}
+	if temps, _ := filepath.Glob(filepath.Join(hook.logDir, "*.tmp")); len(temps) != 0 {
+		t.Fatalf("不应遗留临时文件: %v", temps)
+	}
+
+	// 整理后继续写入的日志应出现在新文件中
+	writeEntries(t, hook, "new", 1)
+	if got := readMessages(t, hook); fmt.Sprint(got) != "[old-2 old-3 old-4 new-0]" {
+		t.Fatalf("整理后写入的日志 = %v", got)
+	}
+}
+
+func TestRewriteFileKeepsOriginalOnError(t *testing.T) {
+	hook := newTestFileHook(t, 3)
+	writeEntries(t, hook, "old", 2)
+
+	// 目标目录不存在，临时文件无法创建
+	missing := filepath.Join(hook.logDir, "missing", "errors.log")
+	if err := hook.rewriteFile(missing, []LogEntry{{Message: "x"}}); err == nil {
+		t.Fatal("无法写入时应返回错误")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Fatalf("失败时不应创建目标文件: %v", err)
+	}
+	if got := readMessages(t, hook); len(got) != 2 {
+		t.Fatalf("原日志应保持不变: %v", got)
+	}
+}
+
+func TestCompactLargeFileBoundedMemory(t *testing.T) {
+	const maxRewriteBytes = 64 << 10
+	hook := newTestFileHook(t, 1<<20)
+	hook.maxRewriteBytes = maxRewriteBytes
+
+	// 构造远大于上限的errors.log
+	var buf bytes.Buffer
+	base := time.Now().Add(-time.Hour)
+	last := 0
+	for ; buf.Len() < 16<<20; last++ {
+		data, _ := json.Marshal(LogEntry{Timestamp: base.Add(time.Duration(last) * time.Millisecond), Level: "error", Message: fmt.Sprintf("entry-%d", last)})
+		buf.Write(append(data, '\n'))
+	}
+	filename := filepath.Join(hook.logDir, "errors.log")
+	if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileSize := int64(buf.Len())
+	buf = bytes.Buffer{}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if err := hook.compact(); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+
+	// 只读取文件末尾的maxRewriteBytes字节，分配量与文件大小无关
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > uint64(fileSize/4) {
+		t.Fatalf("整理%d字节的日志分配了%d字节内存", fileSize, allocated)
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > maxRewriteBytes {
+		t.Fatalf("整理后文件大小 = %d, want <= %d", info.Size(), maxRewriteBytes)
+	}
+	messages := readMessages(t, hook)
+	if len(messages) == 0 {
+		t.Fatal("整理后应保留最新的日志")
+	}
+	if got, want := messages[len(messages)-1], fmt.Sprintf("entry-%d", last-1); got != want {
+		t.Fatalf("最后一条日志 = %q, want %q", got, want)
+	}
+}
+
+func TestInitFileLoggingDisabled(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		// 恢复包级状态，避免影响其他测试
+		once = sync.Once{}
+		fileHook, fileDisabled, recentLogs = nil, false, nil
+		logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	})
+
+	Init(Options{Level: "info", MaxEntries: 10, FileEnabled: false})
+	logrus.Error("文件日志禁用时的错误")
+
+	if _, err := os.Stat(filepath.Join(dir, "logs")); !os.IsNotExist(err) {
+		t.Fatalf("禁用文件日志时不应创建日志目录: %v", err)
+	}
+	if _, err := GetErrorLogs(10); !errors.Is(err, ErrFileLoggingDisabled) {
+		t.Fatalf("GetErrorLogs() error = %v, want %v", err, ErrFileLoggingDisabled)
+	}
+	// 内存中的最近日志不受影响
+	if logs := GetRecentLogs("error", 10); len(logs) != 1 || logs[0].Message != "文件日志禁用时的错误" {
+		t.Fatalf("GetRecentLogs() = %+v", logs)
+	}
+}
@@ -0,0 +1,92 @@
+package logger
+
+import (
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultRecentEntries 未配置MaxEntries时内存中保留的日志条数
+const defaultRecentEntries = 200
+
+// recentHook 在内存环形缓冲区中保留最近的所有级别日志（不写磁盘），供/logs查询
+type recentHook struct {
+	mutex   sync.Mutex
+	entries []LogEntry
+	next    int  // 下一条写入的位置
+	full    bool // 缓冲区是否已写满一轮
+}
+
+var recentLogs *recentHook
+
+func newRecentHook(size int) *recentHook {
+	if size <= 0 {
+		size = defaultRecentEntries
+	}
+	return &recentHook{entries: make([]LogEntry, size)}
+}
+
+// Levels 返回此hook关心的日志级别（全部级别，实际受全局日志级别限制）
+func (hook *recentHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 实现logrus.Hook接口
+func (hook *recentHook) Fire(entry *logrus.Entry) error {
+	logEntry := LogEntry{
+		Timestamp: entry.Time,
+		Level:     entry.Level.String(),
+		Message:   entry.Message,
+		Fields:    make(map[string]interface{}, len(entry.Data)),
+	}
+	for k, v := range entry.Data {
+		// error类型序列化为JSON时会丢失内容，与JSONFormatter一致转为字符串
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		logEntry.Fields[k] = sanitizeValue(k, v)
+	}
+
+	hook.mutex.Lock()
+	hook.entries[hook.next] = logEntry
+	hook.next = (hook.next + 1) % len(hook.entries)
+	if hook.next == 0 {
+		hook.full = true
+	}
+	hook.mutex.Unlock()
+	return nil
+}
+
+// GetRecentLogs 返回内存中最近的日志（最新的在前），只包含级别不低于level的条目；
+// level无法解析时返回所有级别，limit<=0时不限制数量
+func GetRecentLogs(level string, limit int) []LogEntry {
+	if recentLogs == nil {
+		return []LogEntry{}
+	}
+	minLevel, err := logrus.ParseLevel(level)
+	if err != nil {
+		minLevel = logrus.TraceLevel
+	}
+
+	hook := recentLogs
+	hook.mutex.Lock()
+	defer hook.mutex.Unlock()
+
+	count := hook.next
+	if hook.full {
+		count = len(hook.entries)
+	}
+	logs := make([]LogEntry, 0, count)
+	for i := 1; i <= count; i++ {
+		entry := hook.entries[(hook.next-i+len(hook.entries))%len(hook.entries)]
+		// logrus的级别数值越小越严重
+		if entryLevel, err := logrus.ParseLevel(entry.Level); err == nil && entryLevel > minLevel {
+			continue
+		}
+		logs = append(logs, entry)
+		if limit > 0 && len(logs) >= limit {
+			break
+		}
+	}
+	return logs
+}
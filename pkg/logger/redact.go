@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// userIDFields 值为用户ID的日志字段
+var userIDFields = map[string]bool{
+	"user_id": true,
+	"to":      true,
+	"from":    true,
+}
+
+// userIDQueryParams 请求路径中携带用户ID的查询参数
+var userIDQueryParams = []string{"userId"}
+
+// userIDHasher 开启hash_user_ids时用于脱敏的加盐哈希，为nil时原样输出
+var userIDHasher *hasher
+
+// randRead 生成随机盐使用的随机源
+var randRead = rand.Read
+
+type hasher struct {
+	salt []byte
+}
+
+// newHasher 创建哈希器，未配置盐值时使用随机盐（哈希值只在本次进程内稳定）；
+// 随机盐生成失败时返回错误，不能退化为可预测的盐
+func newHasher(salt string) (*hasher, error) {
+	if salt != "" {
+		return &hasher{salt: []byte(salt)}, nil
+	}
+	random := make([]byte, 32)
+	if _, err := randRead(random); err != nil {
+		return nil, fmt.Errorf("生成用户ID哈希的随机盐失败: %w", err)
+	}
+	logrus.Warn("未配置log.user_id_salt，用户ID哈希使用随机盐，重启后哈希值会变化")
+	return &hasher{salt: random}, nil
+}
+
+// hash 返回用户ID的HMAC-SHA256前缀，同一盐值下相同ID得到相同结果，可用于关联日志
+func (h *hasher) hash(userID string) string {
+	mac := hmac.New(sha256.New, h.salt)
+	mac.Write([]byte(userID))
+	return "u_" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// hashUserID 返回日志中使用的用户ID：开启hash_user_ids时为加盐哈希，否则原样返回
+func hashUserID(userID string) string {
+	if userIDHasher == nil || userID == "" {
+		return userID
+	}
+	return userIDHasher.hash(userID)
+}
+
+// sanitizeFields 返回将用户ID字段替换为哈希后的字段副本，不修改原字段
+func sanitizeFields(data logrus.Fields) logrus.Fields {
+	sanitized := make(logrus.Fields, len(data))
+	for key, value := range data {
+		sanitized[key] = sanitizeValue(key, value)
+	}
+	return sanitized
+}
+
+// sanitizeValue 对用户ID字段和请求路径中的用户ID参数做脱敏
+func sanitizeValue(key string, value interface{}) interface{} {
+	if userIDHasher == nil {
+		return value
+	}
+	str, ok := value.(string)
+	if !ok {
+		return value
+	}
+	if userIDFields[key] {
+		return hashUserID(str)
+	}
+	if key == "path" {
+		return sanitizePath(str)
+	}
+	return value
+}
+
+// sanitizePath 替换请求路径查询参数中的用户ID
+func sanitizePath(path string) string {
+	idx := strings.IndexByte(path, '?')
+	if idx < 0 {
+		return path
+	}
+	query, err := url.ParseQuery(path[idx+1:])
+	if err != nil {
+		return path
+	}
+	changed := false
+	for _, param := range userIDQueryParams {
+		values, ok := query[param]
+		if !ok {
+			continue
+		}
+		for i, v := range values {
+			values[i] = hashUserID(v)
+		}
+		changed = true
+	}
+	if !changed {
+		return path
+	}
+	return path[:idx+1] + query.Encode()
+}
+
+// sanitizingFormatter 在格式化前对用户ID脱敏（标准输出），文件日志由FileHook单独处理
+type sanitizingFormatter struct {
+	inner logrus.Formatter
+}
+
+// Format 实现logrus.Formatter接口，使用字段副本格式化，不影响其他hook看到的原始字段
+func (f *sanitizingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	copied := *entry
+	copied.Data = sanitizeFields(entry.Data)
+	return f.inner.Format(&copied)
+}
@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestSanitizeFields(t *testing.T) {
+	userIDHasher = &hasher{salt: []byte("test-salt")}
+	t.Cleanup(func() { userIDHasher = nil })
+
+	fields := logrus.Fields{
+		"user_id":   "alice",
+		"to":        "bob",
+		"from":      "carol",
+		"client_id": "c-1",
+		"path":      "/ws?token=t&userId=alice",
+		"rooms":     3,
+	}
+	sanitized := sanitizeFields(fields)
+
+	for _, key := range []string{"user_id", "to", "from"} {
+		value, _ := sanitized[key].(string)
+		if !strings.HasPrefix(value, "u_") || value == fields[key] {
+			t.Errorf("%s应被哈希，got %v", key, sanitized[key])
+		}
+	}
+	if sanitized["user_id"] != hashUserID("alice") {
+		t.Error("同一盐值下相同ID的哈希应一致")
+	}
+	if sanitized["client_id"] != "c-1" || sanitized["rooms"] != 3 {
+		t.Errorf("非用户ID字段不应改变: %v", sanitized)
+	}
+	if path := sanitized["path"].(string); strings.Contains(path, "alice") || !strings.Contains(path, "token=t") {
+		t.Errorf("路径中的userId应被哈希: %s", path)
+	}
+	if fields["user_id"] != "alice" {
+		t.Error("不应修改原字段")
+	}
+}
+
+func TestSanitizeFieldsDisabled(t *testing.T) {
+	userIDHasher = nil
+	if got := sanitizeValue("user_id", "alice"); got != "alice" {
+		t.Fatalf("未开启hash_user_ids时应原样输出，got %v", got)
+	}
+}
+
+func TestNewHasherRandomFailure(t *testing.T) {
+	randRead = func([]byte) (int, error) { return 0, errors.New("entropy unavailable") }
+	t.Cleanup(func() { randRead = rand.Read })
+
+	if h, err := newHasher(""); err == nil || h != nil {
+		t.Fatalf("随机盐生成失败时应返回错误，got (%v, %v)", h, err)
+	}
+	// 配置了盐值时不依赖随机源
+	if _, err := newHasher("configured"); err != nil {
+		t.Fatalf("newHasher(configured) error = %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package response
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Envelope 所有HTTP接口统一的响应结构
+type Envelope struct {
+	Data  interface{} `json:"data"`
+	Error *string     `json:"error"`
+	Code  int         `json:"code"`
+}
+
+// Success 返回成功响应，payload放在data中
+func Success(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, Envelope{
+		Data: data,
+		Code: status,
+	})
+}
+
+// Error 返回错误响应
+func Error(c *gin.Context, status int, message string) {
+	c.JSON(status, Envelope{
+		Error: &message,
+		Code:  status,
+	})
+}
+
+// AbortWithError 返回错误响应并中止后续处理，data可携带额外的错误细节
+func AbortWithError(c *gin.Context, status int, message string, data interface{}) {
+	c.AbortWithStatusJSON(status, Envelope{
+		Data:  data,
+		Error: &message,
+		Code:  status,
+	})
+}